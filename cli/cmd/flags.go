@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// serializedLines prefixes the values copied by the cli package between the
+// names of a linesFlag.
+const serializedLines = "lines:"
+
+// linesValue holds the values of a linesFlag.
+type linesValue struct {
+	values []string
+	// fromEnv marks the values read from the environment, replaced by the
+	// ones passed on the command line
+	fromEnv bool
+}
+
+func (v *linesValue) Set(s string) error {
+	if data, ok := strings.CutPrefix(s, serializedLines); ok {
+		return json.Unmarshal([]byte(data), &v.values)
+	}
+	if v.fromEnv {
+		v.values, v.fromEnv = nil, false
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			v.values = append(v.values, line)
+		}
+	}
+	return nil
+}
+
+func (v *linesValue) String() string {
+	return strings.Join(v.values, "\n")
+}
+
+func (v *linesValue) Serialize() string {
+	data, _ := json.Marshal(v.values)
+	return serializedLines + string(data)
+}
+
+// linesFlag is a repeatable string flag whose values may contain commas
+// (e.g., webhook body templates): unlike cli.StringSliceFlag, the multiple
+// values passed via the environment variable are split on newlines.
+type linesFlag struct {
+	*cli.GenericFlag
+}
+
+func newLinesFlag(name string, aliases []string, usage, env string) linesFlag {
+	return linesFlag{&cli.GenericFlag{
+		Name:    name,
+		Aliases: aliases,
+		Usage:   usage,
+		EnvVars: []string{env},
+		Value:   &linesValue{},
+	}}
+}
+
+func (f linesFlag) Apply(set *flag.FlagSet) error {
+	if err := f.GenericFlag.Apply(set); err != nil {
+		return err
+	}
+	v := f.Value.(*linesValue)
+	v.fromEnv = len(v.values) > 0
+	return nil
+}
+
+// lines returns the values of the linesFlag `name`.
+func lines(cCtx *cli.Context, name string) []string {
+	if v, ok := cCtx.Generic(name).(*linesValue); ok {
+		return v.values
+	}
+	return nil
+}
@@ -20,12 +20,17 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/ddflare/ddflare/pkg/logging"
 	"github.com/ddflare/ddflare/pkg/net"
 	"github.com/urfave/cli/v2"
 )
 
 const pubIP = "PublicIP"
 
+// systemResolver is the resolver of the get results resolved via the system
+// resolver (/etc/hosts, /etc/resolv.conf).
+const systemResolver = "system"
+
 func newGetCommand() *cli.Command {
 	cmd := &cli.Command{
 		Name:  "get",
@@ -37,25 +42,48 @@ func newGetCommand() *cli.Command {
 				Value:   false,
 				Usage:   "quiet mode",
 			},
+			newOutputFlag(),
+			&cli.StringFlag{
+				Name:  "resolver",
+				Usage: "name server ('host[:port]') queried directly for the A and AAAA records, reporting their TTL with the json and yaml outputs (default: the system resolver)",
+			},
 		},
 		Action: func(cCtx *cli.Context) error {
 			fqdn := cCtx.Args().First()
 			if fqdn == "" {
 				fqdn = pubIP
 			}
-			var ipAdd string
-			var err error
 			var quiet = cCtx.Bool("quiet")
 
-			switch fqdn {
-			case pubIP:
-				ipAdd, err = net.GetMyPub()
-			default:
-				ipAdd, err = net.Resolve(fqdn)
+			format, err := parseOutputFormat(cCtx.String("output"))
+			if err != nil {
+				return err
+			}
+			resolver := cCtx.String("resolver")
+			if fqdn == pubIP && resolver != "" {
+				return fmt.Errorf("--resolver cannot be used retrieving the public address")
 			}
 
+			res, err := lookup(fqdn, resolver)
 			if err != nil {
-				slog.Error("IP retrieval failed", "fqdn", fqdn, "error", err)
+				slog.Error("IP retrieval failed", logging.FQDN, fqdn, "resolver", resolver, logging.Error, err)
+				return err
+			}
+			if format != outputText {
+				return printResult(format, res)
+			}
+
+			// the text output reports the first IPv4 address only
+			var ipAdd string
+			for _, a := range res.Addresses {
+				if a.Type == "A" || fqdn == pubIP {
+					ipAdd = a.Address
+					break
+				}
+			}
+			if ipAdd == "" {
+				err = fmt.Errorf("no IPv4 address found for %q", fqdn)
+				slog.Error("IP retrieval failed", logging.FQDN, fqdn, "resolver", resolver, logging.Error, err)
 				return err
 			}
 			if quiet {
@@ -68,3 +96,54 @@ func newGetCommand() *cli.Command {
 	}
 	return cmd
 }
+
+// lookup returns all the addresses of `fqdn`, resolved via the system
+// resolver or, if not empty, queried to the `resolver` name server. For
+// pubIP it returns the current public address.
+func lookup(fqdn, resolver string) (getResult, error) {
+	res := getResult{FQDN: fqdn, Addresses: []addressResult{}}
+	switch {
+	case fqdn == pubIP:
+		ip, err := net.GetMyPub()
+		if err != nil {
+			return res, err
+		}
+		v4, _, err := net.SplitAddresses(ip)
+		if err != nil {
+			return res, fmt.Errorf("unexpected public address: %w", err)
+		}
+		typ := "AAAA"
+		if len(v4) > 0 {
+			typ = "A"
+		}
+		res.Resolver = net.PublicIPService
+		res.Addresses = append(res.Addresses, addressResult{Type: typ, Address: ip})
+
+	case resolver == "":
+		v4, v6, err := net.ResolveAll(fqdn)
+		if err != nil {
+			return res, err
+		}
+		if len(v4)+len(v6) == 0 {
+			return res, fmt.Errorf("cannot resolve %q: no such host", fqdn)
+		}
+		res.Resolver = systemResolver
+		for _, a := range v4 {
+			res.Addresses = append(res.Addresses, addressResult{Type: "A", Address: a})
+		}
+		for _, a := range v6 {
+			res.Addresses = append(res.Addresses, addressResult{Type: "AAAA", Address: a})
+		}
+
+	default:
+		records, err := net.LookupAddresses(fqdn, resolver)
+		if err != nil {
+			return res, err
+		}
+		res.Resolver = resolver
+		for _, r := range records {
+			res.Addresses = append(res.Addresses, addressResult{Type: r.Type, Address: r.Address, TTL: r.TTL})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/health"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// startListeners starts the HTTP listeners serving the metrics on
+// `metricsAddr` and the `status` health endpoints on `healthAddr`: empty
+// addresses disable the endpoints, equal ones share the listener.
+func startListeners(metricsAddr, healthAddr string, status *health.Tracker) error {
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	if metricsAddr != "" {
+		buildInfo.WithLabelValues(version.Version).Set(1)
+		mux(metricsAddr).Handle("/metrics", promhttp.Handler())
+	}
+	if healthAddr != "" {
+		status.Register(mux(healthAddr))
+	}
+
+	for addr, m := range muxes {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("cannot start HTTP listener: %w", err)
+		}
+		server := &http.Server{Handler: m, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(l); err != nil {
+				slog.Error("HTTP listener failed", "addr", addr, logging.Error, err)
+			}
+		}()
+		slog.Info("HTTP listener started", "addr", l.Addr().String())
+	}
+	return nil
+}
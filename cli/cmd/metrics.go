@@ -0,0 +1,89 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ipSource labels the public address retrieval metrics.
+const ipSource = "ipify"
+
+var (
+	updateAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ddflare_update_attempts_total",
+		Help: "FQDN update cycles attempted, including the ones finding the FQDN already up to date.",
+	}, []string{"fqdn", "provider"})
+	updateSuccesses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ddflare_update_successes_total",
+		Help: "FQDN update cycles succeeded.",
+	}, []string{"fqdn", "provider"})
+	updateFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ddflare_update_failures_total",
+		Help: "FQDN update cycles failed.",
+	}, []string{"fqdn", "provider"})
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ddflare_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful FQDN update cycle.",
+	}, []string{"fqdn", "provider"})
+	publicIPInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ddflare_public_ip_info",
+		Help: "Current public IP address, the value is always 1.",
+	}, []string{"ip"})
+	ipSourceDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ddflare_ip_source_duration_seconds",
+		Help: "Duration of the public IP address retrievals.",
+	}, []string{"source"})
+	ipSourceErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ddflare_ip_source_errors_total",
+		Help: "Public IP address retrieval failures.",
+	}, []string{"source"})
+	dyndnsReturnCodes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ddflare_dyndns_return_codes_total",
+		Help: "Return codes of the DynDNS update protocol providers (e.g., \"good\" or \"nochg\").",
+	}, []string{"provider", "code"})
+	buildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ddflare_build_info",
+		Help: "ddflare build information, the value is always 1.",
+	}, []string{"version"})
+)
+
+func recordUpdate(fqdn, provider string, err error) {
+	updateAttempts.WithLabelValues(fqdn, provider).Inc()
+	if err != nil {
+		updateFailures.WithLabelValues(fqdn, provider).Inc()
+		return
+	}
+	updateSuccesses.WithLabelValues(fqdn, provider).Inc()
+	lastSuccess.WithLabelValues(fqdn, provider).Set(float64(time.Now().Unix()))
+}
+
+func setPublicIP(ip string) {
+	publicIPInfo.Reset()
+	publicIPInfo.WithLabelValues(ip).Set(1)
+}
+
+// recordResponse counts the reply of the `provider` to an update, reported
+// by the DynDNS update protocol backends only (see ddman.Responder).
+func recordResponse(provider, response string) {
+	if response != "" {
+		dyndnsReturnCodes.WithLabelValues(provider, response).Inc()
+	}
+}
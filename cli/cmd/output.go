@@ -0,0 +1,249 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormat is the encoding of the command results printed on stdout.
+type outputFormat string
+
+const (
+	outputText outputFormat = "text"
+	outputJSON outputFormat = "json"
+	outputYAML outputFormat = "yaml"
+)
+
+// Exit codes of the commands run with --detailed-exitcode: in dry-run mode
+// "changed" means changes are pending.
+const (
+	exitUnchanged = 0
+	exitError     = 1
+	exitChanged   = 2
+)
+
+// Result values reported in setResult.
+const (
+	resultChanged   = "changed"
+	resultUnchanged = "unchanged"
+	resultError     = "error"
+)
+
+// statusPending is the providerResult status of the dry-run changes.
+const statusPending = "pending"
+
+func newOutputFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Usage:   "output format [" + strings.Join([]string{string(outputText), string(outputJSON), string(outputYAML)}, ", ") + "]",
+		EnvVars: []string{OUTPUT},
+		Value:   string(outputText),
+	}
+}
+
+func parseOutputFormat(name string) (outputFormat, error) {
+	switch f := outputFormat(name); f {
+	case outputText, outputJSON, outputYAML:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q", name)
+}
+
+// printResult prints `v` on stdout encoded as `format`: a JSON object per line
+// or a YAML document, so that the results of the loop mode cycles can be
+// streamed.
+func printResult(format outputFormat, v any) error {
+	switch format {
+	case outputJSON:
+		return json.NewEncoder(os.Stdout).Encode(v)
+	case outputYAML:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(os.Stdout, "---\n%s", buf.Bytes())
+		return err
+	}
+	return fmt.Errorf("cannot print results as %q", format)
+}
+
+// getResult is the structured result of the get command.
+type getResult struct {
+	FQDN      string          `json:"fqdn" yaml:"fqdn"`
+	Addresses []addressResult `json:"addresses" yaml:"addresses"`
+	// Resolver is the name server queried, "system" for the system resolver
+	// or, for the public address, the service URL.
+	Resolver string `json:"resolver" yaml:"resolver"`
+}
+
+type addressResult struct {
+	Type    string `json:"type" yaml:"type"`
+	Address string `json:"address" yaml:"address"`
+	TTL     uint32 `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+}
+
+// setResult is the structured result of a set command update cycle.
+type setResult struct {
+	FQDN string `json:"fqdn" yaml:"fqdn"`
+	// Previous is the address the FQDN had before the update, empty if
+	// unknown.
+	Previous string `json:"previous" yaml:"previous"`
+	New      string `json:"new" yaml:"new"`
+	// Result is "changed", "unchanged" or "error". In dry-run mode
+	// "changed" means the update would change the FQDN.
+	Result string `json:"result" yaml:"result"`
+	DryRun bool   `json:"dry_run" yaml:"dry_run"`
+	// Updated is true if the service providers were asked to update the
+	// FQDN, false if the update was skipped.
+	Updated   bool             `json:"updated" yaml:"updated"`
+	Providers []providerResult `json:"providers" yaml:"providers"`
+	Error     string           `json:"error,omitempty" yaml:"error,omitempty"`
+	Started   time.Time        `json:"started" yaml:"started"`
+	Duration  float64          `json:"duration_seconds" yaml:"duration_seconds"`
+}
+
+type providerResult struct {
+	Name string `json:"name" yaml:"name"`
+	// Status is "updated", "unchanged", "failed" or "skipped", or "pending"
+	// in dry-run mode.
+	Status string `json:"status" yaml:"status"`
+	// Response is the reply of the service provider, if reported.
+	Response string `json:"response,omitempty" yaml:"response,omitempty"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Changes are the record changes planned in dry-run mode.
+	Changes []recordChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+type recordChange struct {
+	Name       string            `json:"name" yaml:"name"`
+	Type       string            `json:"type" yaml:"type"`
+	Old        string            `json:"old" yaml:"old"`
+	New        string            `json:"new" yaml:"new"`
+	Changed    bool              `json:"changed" yaml:"changed"`
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+}
+
+func (r *setResult) addProvider(name string, status ddflare.UpdateStatus, response string, err error) {
+	pr := providerResult{Name: name, Status: status.String(), Response: response}
+	if err != nil {
+		pr.Error = err.Error()
+	}
+	r.Providers = append(r.Providers, pr)
+}
+
+// addPlan adds the dry-run `changes` planned for the provider `name`.
+func (r *setResult) addPlan(name string, changes []ddflare.RecordChange, err error) {
+	pr := providerResult{Name: name, Status: ddflare.StatusUnchanged.String(), Changes: []recordChange{}}
+	if err != nil {
+		pr.Status, pr.Error = ddflare.StatusFailed.String(), err.Error()
+	}
+	for _, c := range changes {
+		if c.Changed() {
+			pr.Status = statusPending
+		}
+		pr.Changes = append(pr.Changes, recordChange{
+			Name:       c.Name,
+			Type:       c.Type,
+			Old:        c.Old,
+			New:        c.New,
+			Changed:    c.Changed(),
+			Attributes: c.Attributes,
+		})
+	}
+	r.Providers = append(r.Providers, pr)
+}
+
+// done completes the result of the update cycle failed with `err`, if not nil.
+func (r *setResult) done(err error) {
+	r.Duration = time.Since(r.Started).Seconds()
+	switch {
+	case err != nil:
+		r.Result, r.Error = resultError, err.Error()
+	case r.DryRun && slices.ContainsFunc(r.Providers, func(p providerResult) bool { return p.Status == statusPending }):
+		r.Result = resultChanged
+	case r.Updated && !sameAddresses(r.Previous, r.New):
+		r.Result = resultChanged
+	default:
+		r.Result = resultUnchanged
+	}
+}
+
+// exitCode returns the --detailed-exitcode exit code of the result.
+func (r *setResult) exitCode() int {
+	switch r.Result {
+	case resultChanged:
+		return exitChanged
+	case resultError:
+		return exitError
+	}
+	return exitUnchanged
+}
+
+// printPlan writes the dry-run changes of `r` to `w` as a diff: "~" marks
+// the records to change, "=" the ones already up to date and "!" the
+// providers whose records could not be looked up.
+func printPlan(w io.Writer, r *setResult) {
+	fmt.Fprintf(w, "%s: %s (dry run)\n", r.FQDN, r.New)
+	for _, p := range r.Providers {
+		if p.Error != "" {
+			fmt.Fprintf(w, "! %s: %s\n", p.Name, p.Error)
+			continue
+		}
+		for _, c := range p.Changes {
+			if !c.Changed {
+				state := "up to date"
+				if c.Attributes["lookup"] == ddflare.LookupDNS {
+					state = "up to date as resolved via DNS, provider not queried"
+				}
+				fmt.Fprintf(w, "= %s: %s %s %s (%s)\n", p.Name, c.Type, c.Name, c.New, state)
+				continue
+			}
+			fmt.Fprintf(w, "~ %s: %s %s\n", p.Name, c.Type, c.Name)
+			old := c.Old
+			if old == "" {
+				old = "(no record)"
+			}
+			fmt.Fprintf(w, "    - %s\n", old)
+			fmt.Fprintf(w, "    + %s\n", c.New)
+			for _, k := range slices.Sorted(maps.Keys(c.Attributes)) {
+				v := c.Attributes[k]
+				if k == "lookup" && v == ddflare.LookupDNS {
+					v += " (resolved via DNS, provider not queried)"
+				}
+				fmt.Fprintf(w, "      %s: %s\n", k, v)
+			}
+		}
+	}
+}
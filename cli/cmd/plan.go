@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"slices"
+
+	"github.com/urfave/cli/v2"
+)
+
+// planIgnored are the set flags meaningless for a single dry-run cycle: plan
+// is otherwise the same of 'set --dry-run'.
+var planIgnored = []string{
+	"dry-run", "interval", "loop", "watch", "debounce",
+	"pre-hook", "post-hook", "failure-hook", "hook-timeout",
+	"notify", "notify-events", "notify-title", "notify-body", "notify-rate-limit",
+	"metrics-addr", "health-addr", "ready-failures", "otlp-endpoint",
+}
+
+func newPlanCommand() *cli.Command {
+	var flags []cli.Flag
+	for _, f := range setFlags() {
+		if !slices.Contains(planIgnored, f.Names()[0]) {
+			flags = append(flags, f)
+		}
+	}
+
+	cmd := &cli.Command{
+		Name:  "plan",
+		Usage: "prints the changes 'set' would apply to the fqdn passed as argument, without applying them",
+		Description: "Shorthand of 'set --dry-run' for a single update cycle: it takes the same service provider,\n" +
+			"address and output flags of 'set', the ones affecting only the updates (e.g., the hooks and the\n" +
+			"notifications) or the daemon mode (e.g., --interval) are not available.\n" +
+			"The exit code is 0 on success and 1 on errors, also with the structured --output formats: pass\n" +
+			"--detailed-exitcode to exit with 2 when changes are pending.",
+		Args:      true,
+		ArgsUsage: "fqdn",
+		Flags:     flags,
+		Action: func(cCtx *cli.Context) error {
+			conf, err := newSetConf(cCtx)
+			if err != nil {
+				cli.ShowSubcommandHelp(cCtx)
+				return err
+			}
+			conf.dryRun, conf.interval = true, 0
+
+			if err = conf.cycle(cCtx.Context); err != nil {
+				return err
+			}
+			if cCtx.Bool("detailed-exitcode") {
+				return cli.Exit("", conf.result.exitCode())
+			}
+			return nil
+		},
+	}
+	return cmd
+}
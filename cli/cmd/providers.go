@@ -0,0 +1,60 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ddflare/ddflare"
+	"github.com/urfave/cli/v2"
+)
+
+func newProvidersCommand() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "providers",
+		Usage: "list the supported DDNS service providers",
+		Action: func(cCtx *cli.Context) error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tCREDENTIALS\tRECORDS\tMULTI-ADDRESS\tOPTIONS\tDESCRIPTION")
+			for _, p := range ddflare.Providers() {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Name, p.Credentials,
+					strings.Join(p.RecordTypes, ","), yesNo(p.MultipleAddresses),
+					yesNo(p.Configurable), p.Description)
+			}
+			return w.Flush()
+		},
+	}
+	return cmd
+}
+
+func providerNames() []string {
+	var names []string
+	for _, p := range ddflare.Providers() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
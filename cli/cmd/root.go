@@ -18,16 +18,23 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
 	"strings"
 
+	"github.com/ddflare/ddflare/pkg/logging"
 	"github.com/urfave/cli/v2"
 )
 
 const (
-	LOGLEVEL = "DDFLARE_LOGLEVEL"
+	LOGLEVEL   = "DDFLARE_LOGLEVEL"
+	LOGFORMAT  = "DDFLARE_LOG_FORMAT"
+	LOGFILE    = "DDFLARE_LOG_FILE"
+	LOGSIZE    = "DDFLARE_LOG_MAX_SIZE"
+	LOGBACKUPS = "DDFLARE_LOG_MAX_BACKUPS"
+	OUTPUT     = "DDFLARE_OUTPUT"
 )
 
 // This is called by main.main().
@@ -37,6 +44,8 @@ func Execute() {
 		Commands: []*cli.Command{
 			newGetCommand(),
 			newSetCommand(),
+			newPlanCommand(),
+			newProvidersCommand(),
 			newVersionCommand(),
 		},
 		Flags: []cli.Flag{
@@ -58,6 +67,29 @@ func Execute() {
 				Usage:   "verbose output (shorthand for '--log DEBUG')",
 				Value:   false,
 			},
+			&cli.StringFlag{
+				Name:    "log-format",
+				Usage:   "set the log format [" + string(logging.Text) + "," + string(logging.JSON) + "]",
+				EnvVars: []string{LOGFORMAT},
+				Value:   string(logging.Text),
+			},
+			&cli.StringFlag{
+				Name:    "log-file",
+				Usage:   "write the logs to this file instead of stderr",
+				EnvVars: []string{LOGFILE},
+			},
+			&cli.IntFlag{
+				Name:    "log-max-size",
+				Usage:   "size in MB at which the log file is rotated (0 to disable rotation)",
+				EnvVars: []string{LOGSIZE},
+				Value:   10,
+			},
+			&cli.IntFlag{
+				Name:    "log-max-backups",
+				Usage:   "number of rotated log files to keep",
+				EnvVars: []string{LOGBACKUPS},
+				Value:   3,
+			},
 		},
 		Before: func(cCtx *cli.Context) error {
 			loglevel := cCtx.String("loglevel")
@@ -79,9 +111,21 @@ func Execute() {
 			default:
 				return fmt.Errorf("unknown log level: %s", loglevel)
 			}
-			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slogLvl}))
+			format, err := logging.ParseFormat(cCtx.String("log-format"))
+			if err != nil {
+				return err
+			}
+			var out io.Writer = os.Stderr
+			if path := cCtx.String("log-file"); path != "" {
+				// the file is left open until exit to log the final errors too
+				maxSize := int64(cCtx.Int("log-max-size")) << 20
+				if out, err = logging.OpenFile(path, maxSize, cCtx.Int("log-max-backups")); err != nil {
+					return err
+				}
+			}
+			logger := slog.New(logging.NewHandler(out, format, slogLvl))
 			slog.SetDefault(logger)
-			slog.Debug("logging started", "Log Level", slogLvl.String())
+			slog.Debug("logging started", "Log Level", slogLvl.String(), "format", format)
 			return nil
 		},
 	}
@@ -17,12 +17,24 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/ddflare/ddflare"
+	"github.com/ddflare/ddflare/pkg/health"
+	"github.com/ddflare/ddflare/pkg/hooks"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/netwatch"
+	"github.com/ddflare/ddflare/pkg/notify"
+	"github.com/ddflare/ddflare/pkg/tracing"
 	"github.com/ddflare/ddflare/pkg/version"
 	"github.com/urfave/cli/v2"
 )
@@ -35,59 +47,39 @@ const (
 	SVC       = "DDFLARE_SERVICE_PROVIDER"
 	USER      = "DDFLARE_USER"
 	PASSWD    = "DDFLARE_PASSWORD"
+	ENDPOINT  = "DDFLARE_API_ENDPOINT"
+	OPTIONS   = "DDFLARE_SERVICE_OPTIONS"
+	MIRRORS   = "DDFLARE_MIRRORS"
+	FANOUT    = "DDFLARE_FAN_OUT"
+	WATCH     = "DDFLARE_WATCH"
+	DEBOUNCE  = "DDFLARE_DEBOUNCE"
+	PREHOOK   = "DDFLARE_PRE_HOOK"
+	POSTHOOK  = "DDFLARE_POST_HOOK"
+	FAILHOOK  = "DDFLARE_FAILURE_HOOK"
+	HOOKTIME  = "DDFLARE_HOOK_TIMEOUT"
+	NOTIFY    = "DDFLARE_NOTIFY"
+	NEVENTS   = "DDFLARE_NOTIFY_EVENTS"
+	NTITLE    = "DDFLARE_NOTIFY_TITLE"
+	NBODY     = "DDFLARE_NOTIFY_BODY"
+	NRATE     = "DDFLARE_NOTIFY_RATE_LIMIT"
+	METRICS   = "DDFLARE_METRICS_ADDR"
+	HEALTH    = "DDFLARE_HEALTH_ADDR"
+	READYFAIL = "DDFLARE_READY_FAILURES"
+	OTLP      = "DDFLARE_OTLP_ENDPOINT"
+	EXITCODE  = "DDFLARE_DETAILED_EXITCODE"
+	DRYRUN    = "DDFLARE_DRY_RUN"
 )
 
 func newSetCommand() *cli.Command {
 	cmd := &cli.Command{
-		Name:      "set",
-		Usage:     "updates the A record of the fqdn passed as argument",
+		Name:  "set",
+		Usage: "updates the A record of the fqdn passed as argument",
+		Description: "The exit code is 0 on success and 1 on errors: the structured --output formats report the\n" +
+			"update result but do not change it, pass --detailed-exitcode to exit with 2 when the FQDN is\n" +
+			"(or, with --dry-run, would be) changed.",
 		Args:      true,
 		ArgsUsage: "fqdn",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:    "address",
-				Aliases: []string{"a"},
-				Usage:   "IP address to set (current public address if not specified)",
-				EnvVars: []string{IPADDR},
-			},
-			&cli.StringFlag{
-				Name:    "api-token",
-				Aliases: []string{"t"},
-				Usage:   "API authentication token",
-				EnvVars: []string{TOKEN},
-			},
-			&cli.DurationFlag{
-				Name:    "interval",
-				Aliases: []string{"i"},
-				Usage:   "interval between consecutive updates",
-				EnvVars: []string{INTERVAL},
-			},
-			&cli.BoolFlag{
-				Name:    "loop",
-				Aliases: []string{"l"},
-				Usage:   "shorthand for --interval 5m",
-				Value:   false,
-			},
-			&cli.StringFlag{
-				Name:    "svc",
-				Aliases: []string{"s"},
-				Usage:   "DDNS service provider [cflare, dyn, noip, ddns, $URL]",
-				EnvVars: []string{SVC},
-				Value:   "cflare",
-			},
-			&cli.StringFlag{
-				Name:    "user",
-				Aliases: []string{"u"},
-				Usage:   "username (alternative to the 'api-token')",
-				EnvVars: []string{USER},
-			},
-			&cli.StringFlag{
-				Name:    "password",
-				Aliases: []string{"p"},
-				Usage:   "password (alternative to the 'api-token')",
-				EnvVars: []string{PASSWD},
-			},
-		},
+		Flags:     setFlags(),
 		Action: func(cCtx *cli.Context) error {
 			var (
 				conf *setConf
@@ -97,26 +89,50 @@ func newSetCommand() *cli.Command {
 				cli.ShowSubcommandHelp(cCtx)
 				return err
 			}
-			dm := conf.dm
 
-			for {
-				ip := conf.address
-				if ip == "" {
-					if ip, err = ddflare.GetPublicIP(); err != nil {
-						slog.Error("IP Public retrieval failed", "error", err)
-						return err
+			if ep := cCtx.String("otlp-endpoint"); ep != "" {
+				shutdown, err := tracing.Setup(cCtx.Context, ep)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if err := shutdown(ctx); err != nil {
+						slog.Warn("traces export failed", logging.Error, err)
 					}
+				}()
+			}
+
+			if err = startListeners(cCtx.String("metrics-addr"), cCtx.String("health-addr"), conf.status); err != nil {
+				return err
+			}
+
+			var changes <-chan netwatch.Event
+			if conf.watch {
+				ctx := cCtx.Context
+				events, err := netwatch.Watch(ctx)
+				if err != nil {
+					slog.Warn("network changes watch unavailable, falling back to interval checks", "interval", conf.interval, logging.Error, err)
+				} else {
+					changes = netwatch.Debounce(ctx, events, conf.debounce)
 				}
-				if err = dm.UpdateFQDN(conf.fqdn, ip); err != nil {
-					slog.Error("FQDN update failed", "fqdn", conf.fqdn, "ip", ip, "error", err)
+			}
+
+			for {
+				err = conf.cycle(cCtx.Context)
+				conf.status.CycleDone(conf.lastIP, err, conf.interval)
+				if err != nil && conf.interval == 0 {
 					return err
 				}
-				slog.Info("FQDN update successful", "fqdn", conf.fqdn, "ip", ip)
-
 				if conf.interval == 0 {
+					if cCtx.Bool("detailed-exitcode") {
+						return cli.Exit("", conf.result.exitCode())
+					}
 					return nil
 				}
-				time.Sleep(conf.interval)
+				// in loop mode failures are retried at the next cycle
+				changes = waitNextCycle(conf.interval, changes)
 			}
 		},
 	}
@@ -124,12 +140,490 @@ func newSetCommand() *cli.Command {
 	return cmd
 }
 
+// setFlags returns the flags of the set command.
+func setFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "dry-run",
+			Usage:   "look up the records and print the changes the update would apply, without applying them (with the providers not exposing the records, e.g., the DynDNS protocol ones, the current addresses are resolved via DNS instead)",
+			EnvVars: []string{DRYRUN},
+		},
+		&cli.StringFlag{
+			Name:    "address",
+			Aliases: []string{"a"},
+			Usage:   "IP address to set (current public address if not specified), some services accept a comma separated list of IPv4 and IPv6 addresses",
+			EnvVars: []string{IPADDR},
+		},
+		&cli.StringFlag{
+			Name:    "api-token",
+			Aliases: []string{"t"},
+			Usage:   "API authentication token",
+			EnvVars: []string{TOKEN},
+		},
+		&cli.DurationFlag{
+			Name:    "interval",
+			Aliases: []string{"i"},
+			Usage:   "interval between consecutive updates",
+			EnvVars: []string{INTERVAL},
+		},
+		&cli.BoolFlag{
+			Name:    "loop",
+			Aliases: []string{"l"},
+			Usage:   "shorthand for --interval 5m",
+			Value:   false,
+		},
+		&cli.BoolFlag{
+			Name:    "watch",
+			Aliases: []string{"w"},
+			Usage:   "update as soon as the local addresses or routes change (Linux only), checking also every --interval (5m by default)",
+			EnvVars: []string{WATCH},
+			Value:   false,
+		},
+		&cli.DurationFlag{
+			Name:    "debounce",
+			Usage:   "in watch mode, wait for the network changes to settle for this duration before updating",
+			EnvVars: []string{DEBOUNCE},
+			Value:   3 * time.Second,
+		},
+		&cli.StringFlag{
+			Name:    "pre-hook",
+			Usage:   "shell command run before each update, the update is aborted if it fails (details in the DDFLARE_FQDN, DDFLARE_OLD_IP, DDFLARE_NEW_IP and DDFLARE_PROVIDER env vars)",
+			EnvVars: []string{PREHOOK},
+		},
+		&cli.StringFlag{
+			Name:    "post-hook",
+			Usage:   "shell command run after each successful update (same env vars of --pre-hook)",
+			EnvVars: []string{POSTHOOK},
+		},
+		&cli.StringFlag{
+			Name:    "failure-hook",
+			Usage:   "shell command run after each failed update (same env vars of --pre-hook, plus DDFLARE_ERROR)",
+			EnvVars: []string{FAILHOOK},
+		},
+		&cli.DurationFlag{
+			Name:    "hook-timeout",
+			Usage:   "maximum duration of the hook commands",
+			EnvVars: []string{HOOKTIME},
+			Value:   hooks.DefaultTimeout,
+		},
+		newLinesFlag("notify", nil,
+			"notification service URL [webhook://, ntfy://, gotify://, slack://, discord://, smtp://, smtps://] (can be repeated, newline separated in the env var)",
+			NOTIFY),
+		&cli.StringFlag{
+			Name:    "notify-events",
+			Usage:   "comma separated list of the notified events [change, failure, recovery]",
+			EnvVars: []string{NEVENTS},
+			Value:   "change,failure,recovery",
+		},
+		&cli.StringFlag{
+			Name:    "notify-title",
+			Usage:   "notification title template (fields: .Event, .FQDN, .OldIP, .NewIP, .Provider, .Error, .Time)",
+			EnvVars: []string{NTITLE},
+		},
+		&cli.StringFlag{
+			Name:    "notify-body",
+			Usage:   "notification body template (same fields of --notify-title)",
+			EnvVars: []string{NBODY},
+		},
+		&cli.DurationFlag{
+			Name:    "notify-rate-limit",
+			Usage:   "minimum interval between notifications, the ones in between are dropped (0 to disable)",
+			EnvVars: []string{NRATE},
+			Value:   10 * time.Minute,
+		},
+		&cli.StringFlag{
+			Name:    "metrics-addr",
+			Usage:   "address ('host:port') of the HTTP listener exposing the Prometheus metrics at /metrics (disabled if empty)",
+			EnvVars: []string{METRICS},
+		},
+		&cli.StringFlag{
+			Name:    "health-addr",
+			Usage:   "address ('host:port') of the HTTP listener exposing the /healthz, /readyz and /status endpoints (disabled if empty, can be the same of --metrics-addr)",
+			EnvVars: []string{HEALTH},
+		},
+		&cli.IntFlag{
+			Name:    "ready-failures",
+			Usage:   "number of consecutive failed update cycles making /readyz fail",
+			EnvVars: []string{READYFAIL},
+			Value:   health.DefaultFailureThreshold,
+		},
+		newOutputFlag(),
+		&cli.BoolFlag{
+			Name:    "detailed-exitcode",
+			Usage:   "exit with 0 if the FQDN was already up to date, 1 on errors and 2 if the FQDN was (or, in dry-run mode, would be) changed (ignored in loop mode); without it the exit code is 0 on success and 1 on errors, whatever the --output format",
+			EnvVars: []string{EXITCODE},
+		},
+		&cli.StringFlag{
+			Name:    "otlp-endpoint",
+			Usage:   "OTLP/HTTP URL where to export the OpenTelemetry traces of the update cycles, e.g., 'http://localhost:4318/v1/traces' (disabled if empty); the provider API calls are traced for cflare, ovh and the DynDNS protocol providers only",
+			EnvVars: []string{OTLP},
+		},
+		&cli.StringFlag{
+			Name:    "svc",
+			Aliases: []string{"s"},
+			Usage:   "DDNS service provider [" + strings.Join(append(providerNames(), "$URL"), ", ") + "]",
+			EnvVars: []string{SVC},
+			Value:   "cflare",
+		},
+		&cli.StringFlag{
+			Name:    "endpoint",
+			Aliases: []string{"e"},
+			Usage:   "override the API endpoint of the DDNS service provider",
+			EnvVars: []string{ENDPOINT},
+		},
+		newLinesFlag("option", []string{"o"},
+			"DDNS service provider specific option in the 'key=value' form (can be repeated, newline separated in the env var)",
+			OPTIONS),
+		&cli.StringFlag{
+			Name:    "user",
+			Aliases: []string{"u"},
+			Usage:   "username (alternative to the 'api-token')",
+			EnvVars: []string{USER},
+		},
+		&cli.StringFlag{
+			Name:    "password",
+			Aliases: []string{"p"},
+			Usage:   "password (alternative to the 'api-token')",
+			EnvVars: []string{PASSWD},
+		},
+		newLinesFlag("mirror", []string{"m"},
+			"additional DDNS service provider to update, in the URL query form 'svc=SVC&api-token=TOKEN&endpoint=URL&option=KEY%3DVALUE&name=NAME', NAME defaults to SVC and must be unique (can be repeated, newline separated in the env var)",
+			MIRRORS),
+		&cli.StringFlag{
+			Name:    "fan-out",
+			Usage:   "how mirror failures are handled [all (all providers must succeed), best-effort (at least one), primary ('svc' must succeed, then mirrors are updated)]",
+			EnvVars: []string{FANOUT},
+			Value:   ddflare.FanOutAll.String(),
+		},
+	}
+}
+
+// waitNextCycle waits for the `interval` to elapse or a network change to be
+// received from `changes`. It returns the channel to wait on for the next
+// cycle, nil if the changes watch stopped.
+func waitNextCycle(interval time.Duration, changes <-chan netwatch.Event) <-chan netwatch.Event {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return changes
+		case ev, ok := <-changes:
+			if !ok {
+				slog.Warn("network changes watch stopped, falling back to interval checks", "interval", interval)
+				changes = nil
+				continue
+			}
+			slog.Info("network change detected, updating", "event", ev.Type)
+			return changes
+		}
+	}
+}
+
+// cycle retrieves the address to set and updates the FQDN, notifying the
+// outcome. The cycle is traced as a single span.
+func (c *setConf) cycle(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "ddflare.cycle", tracing.FQDN.String(c.fqdn))
+	defer func() { tracing.End(span, err) }()
+	c.attempt++
+	start := time.Now()
+	log := slog.Default().With(logging.FQDN, c.fqdn, logging.Provider, c.provider, logging.Attempt, c.attempt)
+	c.result = &setResult{FQDN: c.fqdn, Providers: []providerResult{}, Started: start}
+	defer func() {
+		c.result.done(err)
+		if c.output == outputText {
+			return
+		}
+		if err := printResult(c.output, c.result); err != nil {
+			log.Warn("cannot print the update result", logging.Error, err)
+		}
+	}()
+
+	ip := c.address
+	if ip == "" {
+		start := time.Now()
+		ip, err = ddflare.GetPublicIPContext(ctx)
+		ipSourceDuration.WithLabelValues(ipSource).Observe(time.Since(start).Seconds())
+		if err != nil {
+			log.Error("IP Public retrieval failed", logging.Error, err, logging.Duration, time.Since(start))
+			ipSourceErrors.WithLabelValues(ipSource).Inc()
+			if !c.dryRun {
+				// no provider was reached: this is not an update attempt
+				// for the metrics, just an IP source error
+				for _, p := range c.providers {
+					c.status.RecordUpdate(c.fqdn, p, "", err)
+				}
+				c.notify(notify.Failure, hooks.Env{FQDN: c.fqdn, OldIP: c.lastIP, Provider: c.provider}, err)
+			}
+			return err
+		}
+	}
+	setPublicIP(ip)
+	c.result.New = ip
+	span.SetAttributes(tracing.IP.String(ip))
+	if c.dryRun {
+		if err = c.plan(ctx, ip); err != nil {
+			log.Error("FQDN update plan failed", logging.IP, ip, logging.Error, err, logging.Duration, time.Since(start))
+			return err
+		}
+		log.Info("FQDN update plan done", logging.IP, ip, logging.Duration, time.Since(start))
+		return nil
+	}
+	if err = c.update(ctx, ip); err != nil {
+		log.Error("FQDN update failed", logging.IP, ip, logging.OldIP, c.lastIP, logging.Error, err, logging.Duration, time.Since(start))
+		return err
+	}
+	log.Info("FQDN update successful", logging.IP, ip, logging.Duration, time.Since(start))
+	return nil
+}
+
+// update updates the FQDN to `ip`, if not already done, on all the service
+// providers, running the hooks and notifying the outcome.
+func (c *setConf) update(ctx context.Context, ip string) error {
+	if ip == c.lastIP {
+		c.result.Previous = ip
+		for _, p := range c.providers {
+			c.result.addProvider(p, ddflare.StatusUnchanged, "", nil)
+		}
+		c.recordAll(ip, nil)
+		if c.failing {
+			c.notify(notify.Recovery, hooks.Env{FQDN: c.fqdn, OldIP: ip, NewIP: ip, Provider: c.provider}, nil)
+		}
+		return nil
+	}
+	env := hooks.Env{FQDN: c.fqdn, OldIP: c.lastIP, NewIP: ip, Provider: c.provider}
+	if env.OldIP == "" && (c.hooks.Configured() || c.notifier != nil || c.output != outputText) {
+		// best effort: the current record may not exist yet
+		_, span := tracing.Start(ctx, "ddflare.resolve", tracing.FQDN.String(c.fqdn))
+		env.OldIP = c.resolvePrevious(ip)
+		span.End()
+	}
+	c.result.Previous = env.OldIP
+
+	if err := c.hooks.Run(hooks.PreUpdate, env); err != nil {
+		err = fmt.Errorf("update aborted: %w", err)
+		for _, p := range c.providers {
+			c.result.addProvider(p, ddflare.StatusSkipped, "", nil)
+		}
+		c.recordAll(ip, err)
+		c.runHook(hooks.OnFailure, env, err)
+		c.notify(notify.Failure, env, err)
+		return err
+	}
+
+	done, err := c.updateFQDN(ctx, ip)
+	if err != nil {
+		c.runHook(hooks.OnFailure, env, err)
+		c.notify(notify.Failure, env, err)
+		return err
+	}
+	// on the first cycle the record may already hold the address: there is
+	// no change to report then
+	changed := !sameAddresses(env.OldIP, ip)
+	if changed {
+		c.runHook(hooks.PostUpdate, env, nil)
+	}
+	switch {
+	case c.failing:
+		c.notify(notify.Recovery, env, nil)
+	case changed:
+		c.notify(notify.AddressChange, env, nil)
+	}
+	if done {
+		c.lastIP = ip
+	}
+	return nil
+}
+
+// resolvePrevious returns the comma separated list of the current addresses of
+// the FQDN in the address families of the `ip` list, or an empty string if
+// they cannot be resolved. A single IPv4 address is resolved via the service
+// provider, the address lists via the system resolver, which returns all the
+// addresses of each family.
+func (c *setConf) resolvePrevious(ip string) string {
+	newV4, newV6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return ""
+	}
+	if len(newV4) == 1 && len(newV6) == 0 {
+		old, _ := c.dm.Resolve(c.fqdn)
+		return old
+	}
+	curV4, curV6, err := net.ResolveAll(c.fqdn)
+	if err != nil {
+		return ""
+	}
+	var old []string
+	if len(newV4) > 0 {
+		old = append(old, curV4...)
+	}
+	if len(newV6) > 0 {
+		old = append(old, curV6...)
+	}
+	return strings.Join(old, ",")
+}
+
+// sameAddresses returns true if the comma separated lists of addresses `a`
+// and `b` hold the same addresses, in any order.
+func sameAddresses(a, b string) bool {
+	if a == b {
+		return true
+	}
+	aV4, aV6, errA := net.SplitAddresses(a)
+	bV4, bV6, errB := net.SplitAddresses(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	aAll, bAll := append(aV4, aV6...), append(bV4, bV6...)
+	slices.Sort(aAll)
+	slices.Sort(bAll)
+	return slices.Equal(aAll, bAll)
+}
+
+// updateFQDN updates the FQDN to `ip` on all the service providers. It
+// returns true if all of them were updated: with mirrors, some may fail
+// without an error being returned (see the --fan-out modes).
+func (c *setConf) updateFQDN(ctx context.Context, ip string) (bool, error) {
+	c.result.Updated = true
+	if c.multi == nil {
+		err := c.dm.UpdateFQDNContext(ctx, c.fqdn, ip)
+		status := ddflare.StatusUpdated
+		if err != nil {
+			status = ddflare.StatusFailed
+		}
+		c.result.addProvider(c.providers[0], status, c.dm.LastResponse(), err)
+		c.record(c.providers[0], ip, err)
+		recordResponse(c.providers[0], c.dm.LastResponse())
+		return err == nil, err
+	}
+
+	results, err := c.multi.UpdateFQDNContext(ctx, c.fqdn, ip)
+	done := true
+	for _, r := range results {
+		c.result.addProvider(r.Name, r.Status, r.Response, r.Err)
+		if r.Status != ddflare.StatusUpdated && r.Status != ddflare.StatusUnchanged {
+			done = false
+		}
+		if r.Status != ddflare.StatusSkipped {
+			c.record(r.Name, ip, r.Err)
+		}
+		if r.Status == ddflare.StatusUpdated || r.Status == ddflare.StatusFailed {
+			recordResponse(r.Name, r.Response)
+		}
+		if r.Err != nil {
+			slog.Warn("FQDN provider update failed", logging.Provider, r.Name, logging.FQDN, c.fqdn, logging.IP, ip, logging.Error, r.Err)
+			continue
+		}
+		slog.Debug("FQDN provider update", logging.Provider, r.Name, logging.FQDN, c.fqdn, logging.IP, ip, "status", r.Status)
+	}
+	return done, err
+}
+
+// plan looks up the changes the update of the FQDN to `ip` would apply on
+// all the service providers, without applying them. In text output mode the
+// changes are printed as a diff.
+func (c *setConf) plan(ctx context.Context, ip string) error {
+	c.result.DryRun = true
+	var err error
+	if c.multi == nil {
+		var changes []ddflare.RecordChange
+		changes, err = c.dm.PlanFQDN(ctx, c.fqdn, ip)
+		c.result.addPlan(c.providers[0], changes, err)
+	} else {
+		var plans []ddflare.BackendPlan
+		plans, err = c.multi.PlanFQDN(ctx, c.fqdn, ip)
+		for _, p := range plans {
+			c.result.addPlan(p.Name, p.Changes, p.Err)
+		}
+	}
+	// the previous value is the one of the primary service provider
+	var old []string
+	for _, ch := range c.result.Providers[0].Changes {
+		old = append(old, ch.Old)
+	}
+	c.result.Previous = strings.Join(old, ",")
+
+	if c.output == outputText {
+		printPlan(os.Stdout, c.result)
+	}
+	return err
+}
+
+// runHook runs the `stage` hook: failures are just logged.
+func (c *setConf) runHook(stage hooks.Stage, env hooks.Env, updateErr error) {
+	if updateErr != nil {
+		env.Error = updateErr.Error()
+	}
+	if err := c.hooks.Run(stage, env); err != nil {
+		slog.Warn("hook failed", "hook", stage, logging.FQDN, c.fqdn, logging.Error, err)
+	}
+}
+
+// recordAll records the outcome of an update cycle which did not reach the
+// service providers.
+func (c *setConf) recordAll(ip string, err error) {
+	for _, p := range c.providers {
+		c.record(p, ip, err)
+	}
+}
+
+// record records the outcome of the update to `ip` on the `provider` in the
+// metrics and the status.
+func (c *setConf) record(provider, ip string, err error) {
+	recordUpdate(c.fqdn, provider, err)
+	c.status.RecordUpdate(c.fqdn, provider, ip, err)
+}
+
+// notify sends the `event` notification, tracking the failures to notify the
+// recovery.
+func (c *setConf) notify(event notify.Event, env hooks.Env, err error) {
+	c.failing = event == notify.Failure
+	if c.notifier == nil {
+		return
+	}
+	msg := notify.Message{
+		Event:    event,
+		FQDN:     env.FQDN,
+		OldIP:    env.OldIP,
+		NewIP:    env.NewIP,
+		Provider: env.Provider,
+	}
+	if err != nil {
+		msg.Error = err.Error()
+	}
+	c.notifier.Notify(msg)
+}
+
 type setConf struct {
 	fqdn     string
 	address  string
 	interval time.Duration
 	loop     bool
+	watch    bool
+	debounce time.Duration
 	dm       *ddflare.DNSManager
+	// multi is set when mirrors are configured: it includes dm as primary.
+	multi *ddflare.MultiDNSManager
+	// providers are the names of the service providers, provider joins them
+	// for the hooks environment and the notifications.
+	providers []string
+	provider  string
+	hooks     hooks.Set
+	notifier  *notify.Dispatcher
+	status    *health.Tracker
+	// output is the format of the update cycle results printed on stdout,
+	// result is the result of the last cycle.
+	output outputFormat
+	result *setResult
+	// dryRun is true if the updates are only planned.
+	dryRun bool
+	// attempt counts the update cycles.
+	attempt int
+	// failing is true if the last update failed.
+	failing bool
+	// lastIP is the address the FQDN was last updated to on all the service
+	// providers.
+	lastIP string
 }
 
 func newSetConf(cCtx *cli.Context) (*setConf, error) {
@@ -140,26 +634,6 @@ func newSetConf(cCtx *cli.Context) (*setConf, error) {
 		return nil, errors.New("'fqdn' arg is missing")
 	}
 
-	svc := cCtx.String("svc")
-	var err error
-	switch svc {
-	case "cflare":
-		conf.dm, err = ddflare.NewDNSManager(ddflare.Cloudflare)
-	case "dyn":
-		conf.dm, err = ddflare.NewDNSManager(ddflare.Dyn)
-	case "noip":
-		conf.dm, err = ddflare.NewDNSManager(ddflare.NoIP)
-	case "ddns":
-		conf.dm, err = ddflare.NewDNSManager(ddflare.DDNS)
-	default:
-		conf.dm, err = ddflare.NewDNSManager(ddflare.DDNS)
-		if err == nil {
-			conf.dm.SetApiEndpoint(svc)
-		}
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to create DNS manager for service %q: %w", svc, err)
-	}
 	token := cCtx.String("api-token")
 	if token == "" {
 		user := cCtx.String("user")
@@ -169,18 +643,192 @@ func newSetConf(cCtx *cli.Context) (*setConf, error) {
 		}
 		token = user + ":" + passwd
 	}
-	if err := conf.dm.Init(token); err != nil {
-		return nil, fmt.Errorf("DNS Manager auth initialization failed: %w", err)
+	svc := cCtx.String("svc")
+	var err error
+	if conf.dm, err = newDNSManager(svc, cCtx.String("endpoint"), lines(cCtx, "option"), token); err != nil {
+		return nil, err
+	}
+	conf.address = cCtx.String("address")
+	if err := checkAddress(conf.dm, conf.address); err != nil {
+		return nil, err
 	}
 
-	conf.dm.SetUserAgent(USERAGENT + version.Version)
+	if mirrors := lines(cCtx, "mirror"); len(mirrors) > 0 {
+		mode, err := ddflare.ParseFanOutMode(cCtx.String("fan-out"))
+		if err != nil {
+			return nil, err
+		}
+		conf.multi = ddflare.NewMultiDNSManager(mode)
+		conf.multi.Add(svc, conf.dm)
+		conf.providers = []string{svc}
+		for i, m := range mirrors {
+			name, dm, err := newMirror(m)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mirror #%d: %w", i+1, err)
+			}
+			if err := checkAddress(dm, conf.address); err != nil {
+				return nil, fmt.Errorf("invalid mirror #%d: %w", i+1, err)
+			}
+			if err := conf.multi.Add(name, dm); err != nil {
+				return nil, fmt.Errorf("invalid mirror #%d: %w, set a unique 'name'", i+1, err)
+			}
+			conf.providers = append(conf.providers, name)
+		}
+	} else {
+		conf.providers = []string{svc}
+	}
+	conf.provider = strings.Join(conf.providers, ",")
+	conf.hooks = hooks.Set{
+		PreUpdate:  cCtx.String("pre-hook"),
+		PostUpdate: cCtx.String("post-hook"),
+		OnFailure:  cCtx.String("failure-hook"),
+		Timeout:    cCtx.Duration("hook-timeout"),
+	}
+
+	if urls := lines(cCtx, "notify"); len(urls) > 0 {
+		if conf.notifier, err = newNotifier(cCtx, urls); err != nil {
+			return nil, err
+		}
+	}
+
+	conf.status = health.NewTracker(cCtx.Int("ready-failures"))
+	conf.dryRun = cCtx.Bool("dry-run")
+
+	if conf.output, err = parseOutputFormat(cCtx.String("output")); err != nil {
+		return nil, err
+	}
 
-	conf.address = cCtx.String("address")
 	conf.interval = cCtx.Duration("interval")
 	conf.loop = cCtx.Bool("loop")
-	if conf.loop && conf.interval == time.Duration(0) {
+	conf.watch = cCtx.Bool("watch")
+	conf.debounce = cCtx.Duration("debounce")
+	if (conf.loop || conf.watch) && conf.interval == time.Duration(0) {
 		conf.interval = 5 * time.Minute
 	}
 
 	return conf, nil
 }
+
+// checkAddress returns an error if the fixed --address `ip` is not supported
+// by the `dm` service provider: the public address retrieved on each cycle is
+// checked on update.
+func checkAddress(dm *ddflare.DNSManager, ip string) error {
+	if ip == "" {
+		return nil
+	}
+	if err := dm.CheckAddresses(ip); err != nil {
+		return fmt.Errorf("invalid address %q: %w", ip, err)
+	}
+	return nil
+}
+
+// newDNSManager returns a DNSManager for the `svc` service provider,
+// initialized with the `endpoint` (if not empty), the 'key=value' `options`
+// and the `token` auth credential.
+func newDNSManager(svc, endpoint string, options []string, token string) (*ddflare.DNSManager, error) {
+	var (
+		dm  *ddflare.DNSManager
+		err error
+	)
+	switch _, known := ddflare.LookupProvider(svc); {
+	case known:
+		dm, err = ddflare.NewDNSManagerByName(svc)
+	case isEndpointURL(svc):
+		// a DynDNS protocol service at a custom endpoint
+		dm, err = ddflare.NewDNSManagerByName("dyn")
+		if err == nil {
+			dm.SetApiEndpoint(svc)
+		}
+	default:
+		return nil, fmt.Errorf("unknown service provider %q (run 'ddflare providers' to list them)", svc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNS manager for service %q: %w", svc, err)
+	}
+	if endpoint != "" {
+		dm.SetApiEndpoint(endpoint)
+	}
+	for _, opt := range options {
+		key, value, found := strings.Cut(opt, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid option %q: 'key=value' format expected", opt)
+		}
+		if err := dm.SetOption(key, value); err != nil {
+			return nil, fmt.Errorf("invalid option %q for service %q: %w", key, svc, err)
+		}
+	}
+	if err := dm.Init(token); err != nil {
+		return nil, fmt.Errorf("DNS Manager auth initialization failed: %w", err)
+	}
+
+	dm.SetUserAgent(USERAGENT + version.Version)
+	return dm, nil
+}
+
+// newMirror returns the name and the DNSManager of a mirror service provider,
+// described by `spec` in the URL query form, with keys named as the set
+// command flags: "svc", "api-token", "user", "password", "endpoint" and
+// "option" (can be repeated), e.g.,
+// "svc=hetzner&api-token=TOKEN&option=key%3Dvalue". The optional "name" key
+// sets the name of the mirror in the logs, results and metrics ("svc" by
+// default): it must be unique among the service providers updated.
+func newMirror(spec string) (string, *ddflare.DNSManager, error) {
+	q, err := url.ParseQuery(spec)
+	if err != nil {
+		return "", nil, err
+	}
+	for key := range q {
+		switch key {
+		case "name", "svc", "api-token", "user", "password", "endpoint", "option":
+		default:
+			return "", nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	svc := q.Get("svc")
+	if svc == "" {
+		return "", nil, errors.New("'svc' is missing")
+	}
+	token := q.Get("api-token")
+	if token == "" {
+		if q.Get("user") == "" || q.Get("password") == "" {
+			return "", nil, errors.New("auth credential missing ('api-token' or 'user' + 'password')")
+		}
+		token = q.Get("user") + ":" + q.Get("password")
+	}
+	name := q.Get("name")
+	if name == "" {
+		name = svc
+	}
+	dm, err := newDNSManager(svc, q.Get("endpoint"), q["option"], token)
+	return name, dm, err
+}
+
+// newNotifier returns the Dispatcher of the notifications to the `urls`
+// services.
+func newNotifier(cCtx *cli.Context, urls []string) (*notify.Dispatcher, error) {
+	var senders []notify.Sender
+	for i, u := range urls {
+		s, err := notify.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification service #%d: %w", i+1, err)
+		}
+		senders = append(senders, s)
+	}
+	events, err := notify.ParseEvents(cCtx.String("notify-events"))
+	if err != nil {
+		return nil, err
+	}
+	return notify.NewDispatcher(notify.Config{
+		Events:    events,
+		Title:     cCtx.String("notify-title"),
+		Body:      cCtx.String("notify-body"),
+		RateLimit: cCtx.Duration("notify-rate-limit"),
+	}, senders...)
+}
+
+// isEndpointURL returns true if `svc` is an http(s) URL, used as the endpoint
+// of a DynDNS protocol service.
+func isEndpointURL(svc string) bool {
+	u, err := url.Parse(svc)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,374 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ddflare/ddflare"
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/health"
+	"github.com/ddflare/ddflare/pkg/hooks"
+	"github.com/ddflare/ddflare/pkg/notify"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/urfave/cli/v2"
+)
+
+const fakeProvider = "test-fake"
+
+func init() {
+	ddflare.Register(fakeProvider, func() ddman.DNSManager { return &fakeBackend{} }, ddflare.ProviderInfo{
+		RecordTypes: []string{"A"},
+	})
+}
+
+// fakeBackend is a DNS backend holding the record in memory.
+type fakeBackend struct {
+	mu   sync.Mutex
+	addr string
+}
+
+func (f *fakeBackend) GetApiEndpoint() string { return "" }
+func (f *fakeBackend) SetApiEndpoint(string)  {}
+func (f *fakeBackend) GetUserAgent() string   { return "" }
+func (f *fakeBackend) SetUserAgent(string)    {}
+func (f *fakeBackend) Init(string) error      { return nil }
+
+func (f *fakeBackend) Resolve(string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addr, nil
+}
+
+func (f *fakeBackend) Update(_, ip string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addr = ip
+	return nil
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (r *recorder) Send(n notify.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, n.Event)
+	return nil
+}
+
+func TestSetConf_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		record     string
+		ip         string
+		failing    bool
+		events     []notify.Event
+		postUpdate bool
+	}{
+		"first cycle, same address": {
+			record: "10.0.0.1",
+			ip:     "10.0.0.1",
+		},
+		"first cycle, new record": {
+			ip:         "10.0.0.1",
+			events:     []notify.Event{notify.AddressChange},
+			postUpdate: true,
+		},
+		"first cycle, new address": {
+			record:     "10.0.0.1",
+			ip:         "10.0.0.2",
+			events:     []notify.Event{notify.AddressChange},
+			postUpdate: true,
+		},
+		"recovery, same address": {
+			record:  "10.0.0.1",
+			ip:      "10.0.0.1",
+			failing: true,
+			events:  []notify.Event{notify.Recovery},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dm, err := ddflare.NewDNSManagerByName(fakeProvider)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dm.DNSManager.(*fakeBackend).addr = tt.record
+
+			rec := &recorder{}
+			notifier, err := notify.NewDispatcher(notify.Config{}, rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			marker := filepath.Join(t.TempDir(), "post-update")
+			c := &setConf{
+				fqdn:      "test.example.com",
+				dm:        dm,
+				providers: []string{fakeProvider},
+				provider:  fakeProvider,
+				hooks:     hooks.Set{PostUpdate: "touch " + marker},
+				notifier:  notifier,
+				status:    health.NewTracker(1),
+				result:    &setResult{FQDN: "test.example.com"},
+				failing:   tt.failing,
+			}
+
+			if err := c.update(context.Background(), tt.ip); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.lastIP != tt.ip {
+				t.Errorf("expected last address %q, got %q", tt.ip, c.lastIP)
+			}
+			if len(rec.events) != len(tt.events) {
+				t.Fatalf("expected notifications %v, got %v", tt.events, rec.events)
+			}
+			for i := range tt.events {
+				if rec.events[i] != tt.events[i] {
+					t.Errorf("expected notifications %v, got %v", tt.events, rec.events)
+				}
+			}
+			_, err = os.Stat(marker)
+			if ran := err == nil; ran != tt.postUpdate {
+				t.Errorf("expected post-update hook run %t, got %t", tt.postUpdate, ran)
+			}
+		})
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	t.Parallel()
+
+	r := &setResult{FQDN: "test.example.com", New: "10.0.0.2"}
+	r.addPlan("cflare", []ddflare.RecordChange{
+		{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.2", Attributes: map[string]string{"zone": "example.com"}},
+	}, nil)
+	r.addPlan("dyn", []ddflare.RecordChange{
+		{Name: "test.example.com", Type: "A", New: "10.0.0.2", Attributes: map[string]string{"lookup": ddflare.LookupDNS}},
+	}, nil)
+	r.addPlan("he", []ddflare.RecordChange{
+		{Name: "test.example.com", Type: "A", Old: "10.0.0.2", New: "10.0.0.2", Attributes: map[string]string{"lookup": ddflare.LookupDNS}},
+	}, nil)
+	r.addPlan("vultr", []ddflare.RecordChange{
+		{Name: "test.example.com", Type: "A", Old: "10.0.0.2", New: "10.0.0.2", Attributes: map[string]string{"zone": "example.com"}},
+	}, nil)
+	r.addPlan("linode", nil, errors.New("not authorized"))
+
+	var out strings.Builder
+	printPlan(&out, r)
+	expected := `test.example.com: 10.0.0.2 (dry run)
+~ cflare: A test.example.com
+    - 10.0.0.1
+    + 10.0.0.2
+      zone: example.com
+~ dyn: A test.example.com
+    - (no record)
+    + 10.0.0.2
+      lookup: dns (resolved via DNS, provider not queried)
+= he: A test.example.com 10.0.0.2 (up to date as resolved via DNS, provider not queried)
+= vultr: A test.example.com 10.0.0.2 (up to date)
+! linode: not authorized
+`
+	if out.String() != expected {
+		t.Errorf("Expected plan:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	t.Parallel()
+
+	recordUpdate("metrics.example.com", fakeProvider, nil)
+	recordUpdate("metrics.example.com", fakeProvider, errors.New("update failure"))
+	recordResponse(fakeProvider, "nochg")
+	recordResponse(fakeProvider, "")
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`ddflare_update_attempts_total{fqdn="metrics.example.com",provider="test-fake"} 2`,
+		`ddflare_update_successes_total{fqdn="metrics.example.com",provider="test-fake"} 1`,
+		`ddflare_update_failures_total{fqdn="metrics.example.com",provider="test-fake"} 1`,
+		`ddflare_dyndns_return_codes_total{code="nochg",provider="test-fake"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("expected metric %q, got:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+func TestLinesFlag(t *testing.T) {
+	t.Setenv("DDFLARE_TEST_LINES", "a=1,2\nb=3\n")
+
+	tests := map[string]struct {
+		args     []string
+		expected []string
+	}{
+		"env":      {nil, []string{"a=1,2", "b=3"}},
+		"override": {[]string{"-o", "c=4,5"}, []string{"c=4,5"}},
+		"repeated": {[]string{"-o", "c=4", "-o", "d=6,7"}, []string{"c=4", "d=6,7"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var values []string
+			app := &cli.App{
+				Flags: []cli.Flag{newLinesFlag("opt", []string{"o"}, "test option", "DDFLARE_TEST_LINES")},
+				Action: func(cCtx *cli.Context) error {
+					values = lines(cCtx, "opt")
+					return nil
+				},
+			}
+			if err := app.Run(append([]string{"ddflare"}, tt.args...)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(values, tt.expected) {
+				t.Errorf("expected values %q, got %q", tt.expected, values)
+			}
+		})
+	}
+}
+
+func TestNewSetConf_Mirrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		address   string
+		mirrors   []string
+		providers []string
+		errorMsg  string
+	}{
+		"distinct": {
+			mirrors:   []string{"svc=test-fake&api-token=t1&name=second", "svc=test-fake&api-token=t2&name=third"},
+			providers: []string{fakeProvider, "second", "third"},
+		},
+		"same_as_primary": {
+			mirrors:  []string{"svc=test-fake&api-token=t1"},
+			errorMsg: `invalid mirror #1: duplicate backend name "test-fake"`,
+		},
+		"same_name": {
+			mirrors:  []string{"svc=test-fake&api-token=t1&name=copy", "svc=test-fake&api-token=t2&name=copy"},
+			errorMsg: `invalid mirror #2: duplicate backend name "copy"`,
+		},
+		"supported_address": {
+			address:   "10.0.0.1",
+			mirrors:   []string{"svc=hetzner&api-token=t1"},
+			providers: []string{fakeProvider, "hetzner"},
+		},
+		"unsupported_family": {
+			address:  "fd00::1",
+			errorMsg: `invalid address "fd00::1": test-fake: AAAA records not supported`,
+		},
+		"multiple_addresses": {
+			address:  "10.0.0.1,10.0.0.2",
+			errorMsg: `invalid address "10.0.0.1,10.0.0.2": test-fake: multiple addresses not supported`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var conf *setConf
+			app := &cli.App{
+				Flags: setFlags(),
+				Action: func(cCtx *cli.Context) (err error) {
+					conf, err = newSetConf(cCtx)
+					return err
+				},
+			}
+			args := []string{"ddflare", "--svc", fakeProvider, "--api-token", "token"}
+			if tt.address != "" {
+				args = append(args, "--address", tt.address)
+			}
+			for _, m := range tt.mirrors {
+				args = append(args, "--mirror", m)
+			}
+			err := app.Run(append(args, "test.example.com"))
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(conf.providers, tt.providers) {
+				t.Errorf("expected providers %v, got %v", tt.providers, conf.providers)
+			}
+		})
+	}
+}
+
+func TestSameAddresses(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		a, b     string
+		expected bool
+	}{
+		"equal":          {"10.0.0.1", "10.0.0.1", true},
+		"different":      {"10.0.0.1", "10.0.0.2", false},
+		"reordered":      {"fd00::1,10.0.0.1", "10.0.0.1,fd00::1", true},
+		"ipv6_canonical": {"fd00:0::1", "fd00::1", true},
+		"missing_family": {"10.0.0.1", "10.0.0.1,fd00::1", false},
+		"unknown":        {"", "10.0.0.1", false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if res := sameAddresses(tt.a, tt.b); res != tt.expected {
+				t.Errorf("sameAddresses(%q, %q): expected %v, got %v", tt.a, tt.b, tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	res, err := lookup("localhost", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Resolver != systemResolver {
+		t.Errorf("expected resolver %q, got %q", systemResolver, res.Resolver)
+	}
+	if !slices.Contains(res.Addresses, addressResult{Type: "A", Address: "127.0.0.1"}) {
+		t.Errorf("expected 127.0.0.1 among the localhost addresses, got %v", res.Addresses)
+	}
+
+	if _, err := lookup("ddflare.invalid", ""); err == nil {
+		t.Error("expected an error resolving a not existing name")
+	}
+}
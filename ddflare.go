@@ -18,12 +18,12 @@ limitations under the License.
 package ddflare
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/ddflare/ddflare/pkg/cflare"
 	"github.com/ddflare/ddflare/pkg/ddman"
-	"github.com/ddflare/ddflare/pkg/dyn"
 	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/tracing"
 )
 
 // DNSManagerType identifies the service type used for DDNS updates.
@@ -34,26 +34,69 @@ const (
 	Dyn
 	DDNS
 	NoIP
+	DeSEC
+	DeSECDyn
+	Hetzner
+	DigitalOcean
+	Gandi
+	PowerDNS
+	GoogleCloud
+	Azure
+	Porkbun
+	Namecheap
+	OVH
+	GoDaddy
+	Linode
+	Vultr
+	Scaleway
+	HurricaneElectric
+	FreeDNS
+	Dynv6
+	Webhook
+	Plugin
+)
+
+// ErrValidation is matched (via errors.Is) by the update errors due to a
+// request rejected as invalid by the DNS provider: the details are available
+// extracting the *ValidationError (via errors.As).
+var ErrValidation = ddman.ErrValidation
+
+type (
+	ValidationError = ddman.ValidationError
+	FieldError      = ddman.FieldError
+	RecordChange    = ddman.RecordChange
 )
 
 // DNSManager represents a DDNS service instance and exposes the methods
 // to read and update the managed DNS records.
 type DNSManager struct {
 	ddman.DNSManager
+	// name is the registered name of the backend.
+	name             string
 	lastSetAddresses map[string]string
 }
 
 // GetPublicIP returns the current Public IP address by querying the
 // "api.ipify.org" service.
 func GetPublicIP() (string, error) {
+	return GetPublicIPContext(context.Background())
+}
+
+// GetPublicIPContext is GetPublicIP, tracing the lookup as a child of the
+// span in `ctx`.
+func GetPublicIPContext(ctx context.Context) (string, error) {
 	var (
 		ip  string
 		err error
 	)
 
+	_, span := tracing.Start(ctx, "ddflare.public_ip")
+	defer func() { tracing.End(span, err) }()
 	if ip, err = net.GetMyPub(); err != nil {
-		return "", fmt.Errorf("cannot retrieve public address: %w", err)
+		err = fmt.Errorf("cannot retrieve public address: %w", err)
+		return "", err
 	}
+	span.SetAttributes(tracing.IP.String(ip))
 
 	return ip, nil
 }
@@ -67,24 +110,39 @@ func Resolve(fqdn string) (string, error) {
 // NewDNSManager() returns a new DNSManager of the give DNSManagerType.
 // It returns an error which is not nil only if a wrong DNSManagerType
 // is passed to NewDNSManager.
+// The built-in backends are also available by name via
+// NewDNSManagerByName().
 func NewDNSManager(dt DNSManagerType) (*DNSManager, error) {
-	dm := &DNSManager{}
-
-	switch dt {
-	case Cloudflare:
-		dm.DNSManager = cflare.New()
-	case Dyn:
-		dm.DNSManager = dyn.New()
-	case DDNS:
-		dm.DNSManager = dyn.NewWithEndpoint("https://update.ddns.org")
-	case NoIP:
-		dm.DNSManager = dyn.NewWithEndpoint("https://dynupdate.no-ip.com")
-	default:
+	name, ok := typeNames[dt]
+	if !ok {
 		return nil, fmt.Errorf("invalid DNS manager backend (%d)", dt)
 	}
+	return NewDNSManagerByName(name)
+}
 
-	dm.lastSetAddresses = make(map[string]string)
-	return dm, nil
+// SetOption() sets the backend specific option `key` to `value`.
+// It returns an error if the DNSManager backend does not support options
+// or rejects the option passed.
+func (d *DNSManager) SetOption(key, value string) error {
+	c, ok := d.DNSManager.(ddman.Configurable)
+	if !ok {
+		return fmt.Errorf("DNS manager backend does not support options")
+	}
+	return c.SetOption(key, value)
+}
+
+// CheckAddresses() returns an error if the comma separated list of addresses
+// `ip` is not supported by the DNSManager backend, according to the
+// ProviderInfo it was registered with.
+func (d *DNSManager) CheckAddresses(ip string) error {
+	p, ok := LookupProvider(d.name)
+	if !ok {
+		return nil
+	}
+	if err := p.CheckAddresses(ip); err != nil {
+		return fmt.Errorf("%s: %w", d.name, err)
+	}
+	return nil
 }
 
 // UpdateFQDN() updates `fqdn` to `ip` using the DNSManager backend.
@@ -92,20 +150,100 @@ func NewDNSManager(dt DNSManagerType) (*DNSManager, error) {
 // the update operation can be skipped if the `fqdn` and `ip` addresses
 // are the same of the previous operation.
 func (d *DNSManager) UpdateFQDN(fqdn, ip string) error {
+	return d.UpdateFQDNContext(context.Background(), fqdn, ip)
+}
+
+// UpdateFQDNContext() is UpdateFQDN(), tracing the update as a child of the
+// span in `ctx`: the backends implementing ddman.ContextUpdater get `ctx` to
+// trace their API calls, the span of the other ones has the
+// "ddflare.instrumented" attribute set to false.
+func (d *DNSManager) UpdateFQDNContext(ctx context.Context, fqdn, ip string) error {
 	if ip == d.lastSetAddresses[fqdn] {
 		return nil
 	}
-	if err := d.Update(fqdn, ip); err != nil {
+	if err := d.CheckAddresses(ip); err != nil {
 		return fmt.Errorf("update failed: %w", err)
 	}
+	ctx, span := tracing.Start(ctx, "ddflare.update",
+		tracing.Provider.String(d.name), tracing.FQDN.String(fqdn), tracing.IP.String(ip))
+	var err error
+	cu, ok := d.DNSManager.(ddman.ContextUpdater)
+	span.SetAttributes(tracing.Instrumented.Bool(ok))
+	if ok {
+		err = cu.UpdateContext(ctx, fqdn, ip)
+	} else {
+		err = d.Update(fqdn, ip)
+	}
+	if err != nil {
+		err = fmt.Errorf("update failed: %w", err)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
 	d.lastSetAddresses[fqdn] = ip
 	return nil
 }
 
+// LookupDNS is the "lookup" attribute of the record changes planned by
+// resolving the FQDN, without querying the DNS provider.
+const LookupDNS = ddman.LookupDNS
+
+// PlanFQDN() returns the changes updating `fqdn` to `ip` would apply, without
+// updating it. The backends implementing ddman.Planner look up the records
+// via their API. For the others the current addresses are resolved via the
+// local resolver and the changes have the "lookup" attribute set to
+// LookupDNS: the records may differ from the resolved addresses (e.g.,
+// because of caching or proxying) and the zone and the credentials are not
+// checked.
+func (d *DNSManager) PlanFQDN(ctx context.Context, fqdn, ip string) ([]RecordChange, error) {
+	var (
+		changes []RecordChange
+		err     error
+	)
+	ctx, span := tracing.Start(ctx, "ddflare.plan",
+		tracing.Provider.String(d.name), tracing.FQDN.String(fqdn), tracing.IP.String(ip))
+	defer func() { tracing.End(span, err) }()
+
+	if err = d.CheckAddresses(ip); err != nil {
+		err = fmt.Errorf("plan failed: %w", err)
+		return nil, err
+	}
+	if p, ok := d.DNSManager.(ddman.Planner); ok {
+		if changes, err = p.Plan(ctx, fqdn, ip); err != nil {
+			err = fmt.Errorf("plan failed: %w", err)
+			return nil, err
+		}
+		return changes, nil
+	}
+
+	attrs := map[string]string{"endpoint": d.GetApiEndpoint()}
+	if changes, err = ddman.ResolvePlan(fqdn, ip, attrs); err != nil {
+		err = fmt.Errorf("plan failed: %w", err)
+		return nil, err
+	}
+	return changes, nil
+}
+
+// LastResponse() returns the reply of the DNS provider to the last update, if
+// reported by the DNSManager backend (see ddman.Responder).
+func (d *DNSManager) LastResponse() string {
+	if r, ok := d.DNSManager.(ddman.Responder); ok {
+		return r.LastResponse()
+	}
+	return ""
+}
+
 // IsFQDNUpToDate() checks if the `fqdn` was already set to the desired `ip`.
 // First the local cache is checked for previously updated value: if local cache
 // is different, then the `fqdn` is resolved and checked against the passed `ip`.
 func (d *DNSManager) IsFQDNUpToDate(fqdn, ip string) (bool, error) {
+	return d.IsFQDNUpToDateContext(context.Background(), fqdn, ip)
+}
+
+// IsFQDNUpToDateContext() is IsFQDNUpToDate(), tracing the DNS verification
+// as a child of the span in `ctx`.
+func (d *DNSManager) IsFQDNUpToDateContext(ctx context.Context, fqdn, ip string) (bool, error) {
 	var (
 		resIP string
 		err   error
@@ -113,9 +251,14 @@ func (d *DNSManager) IsFQDNUpToDate(fqdn, ip string) (bool, error) {
 	if ip == d.lastSetAddresses[fqdn] {
 		return true, nil
 	}
+	_, span := tracing.Start(ctx, "ddflare.dns_verify",
+		tracing.Provider.String(d.name), tracing.FQDN.String(fqdn), tracing.IP.String(ip))
+	defer func() { tracing.End(span, err) }()
 	if resIP, err = d.Resolve(fqdn); err != nil {
-		return false, fmt.Errorf("resolve failed: %w", err)
+		err = fmt.Errorf("resolve failed: %w", err)
+		return false, err
 	}
+	span.SetAttributes(tracing.Result.Bool(resIP == ip))
 	if resIP == ip {
 		return true, nil
 	}
@@ -0,0 +1,308 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ddflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+)
+
+// FanOutMode sets how a MultiDNSManager handles the failure of its backends.
+type FanOutMode int
+
+const (
+	// FanOutAll updates all the backends and fails if any of them fails.
+	FanOutAll FanOutMode = iota
+	// FanOutBestEffort updates all the backends and fails only if all of
+	// them fail.
+	FanOutBestEffort
+	// FanOutPrimary updates the first backend (the primary) and then, only if
+	// it succeeds, the others: it fails only if the primary fails.
+	FanOutPrimary
+)
+
+var fanOutModeNames = map[FanOutMode]string{
+	FanOutAll:        "all",
+	FanOutBestEffort: "best-effort",
+	FanOutPrimary:    "primary",
+}
+
+func (m FanOutMode) String() string {
+	if name, ok := fanOutModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("FanOutMode(%d)", int(m))
+}
+
+// ParseFanOutMode returns the FanOutMode named `name` ("all", "best-effort"
+// or "primary").
+func ParseFanOutMode(name string) (FanOutMode, error) {
+	for m, n := range fanOutModeNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown fan-out mode %q", name)
+}
+
+// UpdateStatus is the outcome of the update of a single backend.
+type UpdateStatus int
+
+const (
+	// StatusUpdated means the backend was updated.
+	StatusUpdated UpdateStatus = iota
+	// StatusUnchanged means the update was not needed as the backend was
+	// already updated to the same address.
+	StatusUnchanged
+	// StatusFailed means the backend update failed.
+	StatusFailed
+	// StatusSkipped means the backend update was not attempted.
+	StatusSkipped
+)
+
+func (s UpdateStatus) String() string {
+	switch s {
+	case StatusUpdated:
+		return "updated"
+	case StatusUnchanged:
+		return "unchanged"
+	case StatusFailed:
+		return "failed"
+	case StatusSkipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("UpdateStatus(%d)", int(s))
+}
+
+// BackendResult reports the update outcome of a MultiDNSManager backend.
+type BackendResult struct {
+	Name   string
+	Status UpdateStatus
+	// Err is the update error, set if Status is StatusFailed.
+	Err error
+	// Response is the reply of the DNS provider, if reported by the backend.
+	Response string
+}
+
+// BackendPlan reports the changes a MultiDNSManager backend update would
+// apply.
+type BackendPlan struct {
+	Name    string
+	Changes []RecordChange
+	// Err is the error looking up the records to change.
+	Err error
+}
+
+type namedManager struct {
+	name string
+	dm   *DNSManager
+}
+
+var (
+	_ ddman.DNSManager     = (*MultiDNSManager)(nil)
+	_ ddman.ContextUpdater = (*MultiDNSManager)(nil)
+)
+
+// MultiDNSManager updates the same FQDNs on multiple DNSManager backends,
+// keeping all the DNS providers consistent. It is itself a ddman.DNSManager,
+// usable where a single backend is expected.
+type MultiDNSManager struct {
+	mode     FanOutMode
+	backends []namedManager
+}
+
+// NewMultiDNSManager returns an empty MultiDNSManager handling the backend
+// failures according to `mode`.
+func NewMultiDNSManager(mode FanOutMode) *MultiDNSManager {
+	return &MultiDNSManager{mode: mode}
+}
+
+// Add appends the already initialized `dm` backend, identified by `name` in
+// the update reports. The first backend added is the primary one. The names
+// must be unique: they key the backend results, metrics and status.
+func (m *MultiDNSManager) Add(name string, dm *DNSManager) error {
+	for _, b := range m.backends {
+		if b.name == name {
+			return fmt.Errorf("duplicate backend name %q", name)
+		}
+	}
+	m.backends = append(m.backends, namedManager{name: name, dm: dm})
+	return nil
+}
+
+// GetApiEndpoint returns the API endpoint of the primary backend.
+func (m *MultiDNSManager) GetApiEndpoint() string {
+	if len(m.backends) == 0 {
+		return ""
+	}
+	return m.backends[0].dm.GetApiEndpoint()
+}
+
+// SetApiEndpoint sets the API endpoint of the primary backend: the endpoints
+// of the others are specific to their DNS providers.
+func (m *MultiDNSManager) SetApiEndpoint(ep string) {
+	if len(m.backends) > 0 {
+		m.backends[0].dm.SetApiEndpoint(ep)
+	}
+}
+
+// GetUserAgent returns the user agent of the primary backend.
+func (m *MultiDNSManager) GetUserAgent() string {
+	if len(m.backends) == 0 {
+		return ""
+	}
+	return m.backends[0].dm.GetUserAgent()
+}
+
+// SetUserAgent sets the user agent of all the backends.
+func (m *MultiDNSManager) SetUserAgent(ua string) {
+	for _, b := range m.backends {
+		b.dm.SetUserAgent(ua)
+	}
+}
+
+// Init only checks there are backends: they are added already initialized,
+// each one with its own credentials.
+func (m *MultiDNSManager) Init(string) error {
+	if len(m.backends) == 0 {
+		return errors.New("no DNS manager backends")
+	}
+	return nil
+}
+
+// Resolve returns the IP address assigned to `fqdn`, as resolved by the
+// primary backend.
+func (m *MultiDNSManager) Resolve(fqdn string) (string, error) {
+	if len(m.backends) == 0 {
+		return "", errors.New("no DNS manager backends")
+	}
+	return m.backends[0].dm.Resolve(fqdn)
+}
+
+// Update updates `fqdn` to `ip` on the backends, failing according to the
+// FanOutMode: see UpdateFQDN() for the per backend results.
+func (m *MultiDNSManager) Update(fqdn, ip string) error {
+	_, err := m.UpdateFQDNContext(context.Background(), fqdn, ip)
+	return err
+}
+
+// UpdateContext is Update(), tracing the backend updates as children of the
+// span in `ctx`.
+func (m *MultiDNSManager) UpdateContext(ctx context.Context, fqdn, ip string) error {
+	_, err := m.UpdateFQDNContext(ctx, fqdn, ip)
+	return err
+}
+
+// UpdateFQDN() updates `fqdn` to `ip` on the backends, in the order they were
+// added, and returns the outcome of each of them.
+// The returned error depends on the FanOutMode and joins the errors of the
+// failed backends.
+func (m *MultiDNSManager) UpdateFQDN(fqdn, ip string) ([]BackendResult, error) {
+	return m.UpdateFQDNContext(context.Background(), fqdn, ip)
+}
+
+// UpdateFQDNContext() is UpdateFQDN(), tracing the backend updates as
+// children of the span in `ctx`.
+func (m *MultiDNSManager) UpdateFQDNContext(ctx context.Context, fqdn, ip string) ([]BackendResult, error) {
+	if len(m.backends) == 0 {
+		return nil, errors.New("no DNS manager backends")
+	}
+
+	results := make([]BackendResult, len(m.backends))
+	var errs []error
+	failed := 0
+	for i, b := range m.backends {
+		results[i].Name = b.name
+		if m.mode == FanOutPrimary && i > 0 && results[0].Status == StatusFailed {
+			results[i].Status = StatusSkipped
+			continue
+		}
+
+		unchanged := b.dm.lastSetAddresses[fqdn] == ip
+		err := b.dm.UpdateFQDNContext(ctx, fqdn, ip)
+		if !unchanged {
+			results[i].Response = b.dm.LastResponse()
+		}
+		if err != nil {
+			results[i].Status, results[i].Err = StatusFailed, err
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, err))
+			failed++
+			slog.Debug("backend update failed", "backend", b.name, logging.FQDN, fqdn, logging.Error, err)
+			continue
+		}
+		if unchanged {
+			results[i].Status = StatusUnchanged
+		}
+		slog.Debug("backend update done", "backend", b.name, logging.FQDN, fqdn, "status", results[i].Status)
+	}
+
+	ok := failed == 0
+	switch m.mode {
+	case FanOutBestEffort:
+		ok = failed < len(m.backends)
+	case FanOutPrimary:
+		ok = results[0].Status != StatusFailed
+	}
+	if ok {
+		return results, nil
+	}
+	return results, fmt.Errorf("%d of %d backends failed: %w", failed, len(m.backends), errors.Join(errs...))
+}
+
+// PlanFQDN() returns the changes updating `fqdn` to `ip` would apply on each
+// backend, without updating them. The returned error joins the errors of the
+// backends whose records could not be looked up.
+func (m *MultiDNSManager) PlanFQDN(ctx context.Context, fqdn, ip string) ([]BackendPlan, error) {
+	plans := make([]BackendPlan, len(m.backends))
+	var errs []error
+	for i, b := range m.backends {
+		plans[i].Name = b.name
+		if plans[i].Changes, plans[i].Err = b.dm.PlanFQDN(ctx, fqdn, ip); plans[i].Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, plans[i].Err))
+		}
+	}
+	if len(errs) > 0 {
+		return plans, fmt.Errorf("%d of %d backends failed: %w", len(errs), len(m.backends), errors.Join(errs...))
+	}
+	return plans, nil
+}
+
+// IsFQDNUpToDate() checks if the `fqdn` was already set to the desired `ip`
+// on all the backends.
+func (m *MultiDNSManager) IsFQDNUpToDate(fqdn, ip string) (bool, error) {
+	return m.IsFQDNUpToDateContext(context.Background(), fqdn, ip)
+}
+
+// IsFQDNUpToDateContext() is IsFQDNUpToDate(), tracing the DNS verifications
+// as children of the span in `ctx`.
+func (m *MultiDNSManager) IsFQDNUpToDateContext(ctx context.Context, fqdn, ip string) (bool, error) {
+	for _, b := range m.backends {
+		ok, err := b.dm.IsFQDNUpToDateContext(ctx, fqdn, ip)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", b.name, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
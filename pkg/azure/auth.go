@@ -0,0 +1,121 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLoginEP = "https://login.microsoftonline.com"
+	defaultIMDSEP  = "http://169.254.169.254"
+	// expiryDelta is how early the access token is refreshed before its
+	// expiration.
+	expiryDelta = time.Minute
+)
+
+// credentials tracks the identity used to request the ARM access tokens:
+// when secret is empty the managed identity is used, with clientID
+// selecting a user assigned identity if not empty.
+type credentials struct {
+	tenant   string
+	clientID string
+	secret   string
+}
+
+func (cr *credentials) managedIdentity() bool {
+	return cr.secret == ""
+}
+
+type tokenReply struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresIn is a number for Entra ID and a string for the managed
+	// identity endpoint.
+	ExpiresIn json.RawMessage `json:"expires_in"`
+	Error     string          `json:"error"`
+	ErrorDesc string          `json:"error_description"`
+}
+
+// accessToken returns a valid ARM access token, requesting a new one when
+// the cached one is missing or expiring.
+func (c *Client) accessToken() (string, error) {
+	if c.token != "" && time.Now().Add(expiryDelta).Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	var (
+		req *http.Request
+		err error
+	)
+	resource := strings.TrimSuffix(c.endpoint, "/")
+	if c.creds.managedIdentity() {
+		q := url.Values{}
+		q.Set("api-version", "2018-02-01")
+		q.Set("resource", resource+"/")
+		if c.creds.clientID != "" {
+			q.Set("client_id", c.creds.clientID)
+		}
+		if req, err = http.NewRequest("GET", c.imdsEndpoint+"/metadata/identity/oauth2/token?"+q.Encode(), nil); err != nil {
+			return "", err
+		}
+		req.Header.Add("Metadata", "true")
+	} else {
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		form.Set("client_id", c.creds.clientID)
+		form.Set("client_secret", c.creds.secret)
+		form.Set("scope", resource+"/.default")
+		tokenURL := c.loginEndpoint + "/" + url.PathEscape(c.creds.tenant) + "/oauth2/v2.0/token"
+		if req, err = http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode())); err != nil {
+			return "", err
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot retrieve access token: connection to %s failed: %w", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot retrieve access token: failure reading %q reply: %w", req.URL.Host, err)
+	}
+
+	var reply tokenReply
+	if err = json.Unmarshal(data, &reply); err != nil {
+		return "", fmt.Errorf("cannot retrieve access token: %s returned %d (%s)", req.URL.Host, res.StatusCode, res.Status)
+	}
+	if res.StatusCode != http.StatusOK || reply.AccessToken == "" {
+		return "", fmt.Errorf("cannot retrieve access token: %s: %s", reply.Error, reply.ErrorDesc)
+	}
+
+	expiresIn, err := strconv.Atoi(strings.Trim(string(reply.ExpiresIn), `"`))
+	if err != nil {
+		return "", fmt.Errorf("cannot retrieve access token: invalid expires_in %s", reply.ExpiresIn)
+	}
+	c.token = reply.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	return c.token, nil
+}
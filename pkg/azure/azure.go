@@ -0,0 +1,331 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package azure implements a DNSManager for Azure DNS using the Azure
+// Resource Manager REST API specified at
+// https://learn.microsoft.com/en-us/rest/api/dns/record-sets .
+//
+// Requests are authenticated with the client credentials of a service
+// principal or with a managed identity.
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager   = (*Client)(nil)
+	_ ddman.Configurable = (*Client)(nil)
+	_ ddman.Planner      = (*Client)(nil)
+)
+
+const (
+	// ManagedIdentityAuth is the auth string to pass to Init() to use the
+	// system assigned managed identity. A user assigned identity is selected
+	// with ManagedIdentityAuth + ":" + its client id.
+	ManagedIdentityAuth = "msi"
+
+	defaultAPIEP     = "https://management.azure.com"
+	defaultUserAgent = "ddflare-azure-"
+	defaultTTL       = 300
+	apiVersion       = "2018-05-01"
+)
+
+type Client struct {
+	endpoint      string
+	loginEndpoint string
+	imdsEndpoint  string
+	userAgent     string
+	subscription  string
+	resourceGroup string
+	zone          string
+	creds         *credentials
+	token         string
+	tokenExpiry   time.Time
+	*restapi.API
+}
+
+type zoneInfo struct {
+	Name string `json:"name"`
+}
+
+type recordSet struct {
+	Properties recordSetProperties `json:"properties"`
+}
+
+type recordSetProperties struct {
+	TTL         int          `json:"TTL"`
+	ARecords    []aRecord    `json:"ARecords,omitempty"`
+	AAAARecords []aaaaRecord `json:"AAAARecords,omitempty"`
+}
+
+type aRecord struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type aaaaRecord struct {
+	IPv6Address string `json:"ipv6Address"`
+}
+
+// NewWithEndpoint initializes a new Azure DNS client which uses 'endpoint'
+// as Azure Resource Manager endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:      ep,
+		loginEndpoint: defaultLoginEP,
+		imdsEndpoint:  defaultIMDSEP,
+		userAgent:     defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// SetOption sets the Azure DNS specific options:
+//   - "subscription": the subscription id (mandatory)
+//   - "resource-group": the resource group hosting the DNS zone (mandatory)
+//   - "zone": the DNS zone name (looked up in the resource group if not set)
+func (c *Client) SetOption(key, value string) error {
+	if value == "" {
+		return fmt.Errorf("invalid empty %q option", key)
+	}
+	switch key {
+	case "subscription":
+		c.subscription = value
+	case "resource-group":
+		c.resourceGroup = value
+	case "zone":
+		c.zone = strings.TrimSuffix(value, ".")
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Init sets up the credentials used to authenticate the requests: `auth`
+// is either "tenant:clientID:clientSecret" for a service principal or
+// ManagedIdentityAuth, optionally followed by ":clientID", for a managed
+// identity.
+func (c *Client) Init(auth string) error {
+	c.token = ""
+	if id, ok := strings.CutPrefix(auth, ManagedIdentityAuth); ok && (id == "" || id[0] == ':') {
+		c.creds = &credentials{clientID: strings.TrimPrefix(id, ":")}
+	} else {
+		parts := strings.SplitN(auth, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return fmt.Errorf("cannot initialize Azure DNS client: 'tenant:clientID:clientSecret' or %q credentials expected", ManagedIdentityAuth)
+		}
+		c.creds = &credentials{tenant: parts[0], clientID: parts[1], secret: parts[2]}
+	}
+
+	api, err := restapi.New(c.endpoint, c.userAgent, nil)
+	if err != nil {
+		return err
+	}
+	api.ErrorMessage = errorMessage
+	api.Authorize = c.authorize
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: the A and
+// AAAA record sets are replaced with all the addresses of the matching
+// family, keeping their TTL.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[recordSet], error) {
+	if c.API == nil {
+		return restapi.Records[recordSet]{}, fmt.Errorf("not authorized")
+	}
+	if c.subscription == "" || c.resourceGroup == "" {
+		return restapi.Records[recordSet]{}, fmt.Errorf("missing \"subscription\" or \"resource-group\" option")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	zone, err := c.getZone(fqdn)
+	if err != nil {
+		return restapi.Records[recordSet]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, zone)
+	if name == "" {
+		name = "@"
+	}
+	log.Debug("DNS zone found", "zone", zone, "name", name)
+
+	path := c.zonesPath() + "/" + url.PathEscape(zone) + "/"
+	return restapi.Records[recordSet]{
+		Find: func(rType string) ([]recordSet, error) {
+			var current recordSet
+			if err := c.do("GET", path+rType+"/"+url.PathEscape(name), nil, &current); err != nil {
+				if restapi.IsNotFound(err) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			log.Debug("record set found", "type", rType, "data", current.Properties)
+			return []recordSet{current}, nil
+		},
+		Update: func(rType string, found []recordSet, addrs []string) error {
+			want := recordSet{Properties: recordSetProperties{TTL: defaultTTL}}
+			if len(found) > 0 && found[0].Properties.TTL != 0 {
+				want.Properties.TTL = found[0].Properties.TTL
+			}
+			for _, a := range addrs {
+				if rType == "A" {
+					want.Properties.ARecords = append(want.Properties.ARecords, aRecord{a})
+				} else {
+					want.Properties.AAAARecords = append(want.Properties.AAAARecords, aaaaRecord{a})
+				}
+			}
+			if err := c.do("PUT", path+rType+"/"+url.PathEscape(name), want, nil); err != nil {
+				return err
+			}
+			log.Debug("record set updated", "type", rType, "data", want.Properties)
+			return nil
+		},
+		Addresses: func(rs recordSet) []string {
+			var addrs []string
+			for _, r := range rs.Properties.ARecords {
+				addrs = append(addrs, r.IPv4Address)
+			}
+			for _, r := range rs.Properties.AAAARecords {
+				addrs = append(addrs, r.IPv6Address)
+			}
+			return addrs
+		},
+		Zone: zone,
+	}, nil
+}
+
+func (c *Client) zonesPath() string {
+	return "/subscriptions/" + url.PathEscape(c.subscription) +
+		"/resourceGroups/" + url.PathEscape(c.resourceGroup) +
+		"/providers/Microsoft.Network/dnsZones"
+}
+
+// getZone returns the configured zone or, if not set, looks for the zone
+// in the resource group which best matches `fqdn`.
+func (c *Client) getZone(fqdn string) (string, error) {
+	if c.zone != "" {
+		if fqdn != c.zone && !strings.HasSuffix(fqdn, "."+c.zone) {
+			return "", fmt.Errorf("%q does not belong to zone %q", fqdn, c.zone)
+		}
+		return c.zone, nil
+	}
+
+	var zones struct {
+		Value []zoneInfo `json:"value"`
+	}
+	if err := c.do("GET", c.zonesPath(), nil, &zones); err != nil {
+		return "", err
+	}
+	return net.LookupZone(fqdn, func(name string) (bool, error) {
+		return slices.ContainsFunc(zones.Value, func(z zoneInfo) bool { return z.Name == name }), nil
+	})
+}
+
+// do sends the request to the `path` ARM API (see restapi.API.Do()), adding
+// the API version.
+func (c *Client) do(method, path string, in, out any) error {
+	return c.Do(method, path+"?api-version="+apiVersion, in, out)
+}
+
+// authorize adds the ARM access token to the API requests.
+func (c *Client) authorize(req *http.Request, _ []byte) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// errorMessage extracts the error code and message from the ARM API error
+// reply.
+func errorMessage(body []byte) string {
+	var reply struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &reply) != nil || reply.Error.Message == "" {
+		return ""
+	}
+	return reply.Error.Code + ": " + reply.Error.Message
+}
@@ -0,0 +1,401 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+}
+
+func TestClient_Init(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		auth     string
+		expected credentials
+		fails    bool
+	}{
+		"service_principal": {"tenant:client:se:cr:et", credentials{"tenant", "client", "se:cr:et"}, false},
+		"system_identity":   {"msi", credentials{}, false},
+		"user_identity":     {"msi:client", credentials{clientID: "client"}, false},
+		"empty":             {"", credentials{}, true},
+		"missing_secret":    {"tenant:client", credentials{}, true},
+		"empty_secret":      {"tenant:client:", credentials{}, true},
+		"msi_prefix":        {"msix:client:secret", credentials{"msix", "client", "secret"}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := New()
+			err := client.Init(tt.auth)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected failure with auth %q", tt.auth)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected failure: %v", err)
+			}
+			if *client.creds != tt.expected {
+				t.Fatalf("expected credentials %+v, got %+v", tt.expected, *client.creds)
+			}
+		})
+	}
+}
+
+func TestClient_SetOption(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	for key, value := range map[string]string{"subscription": "sub", "resource-group": "rg", "zone": "example.com."} {
+		if err := client.SetOption(key, value); err != nil {
+			t.Fatalf("unexpected failure setting %q: %v", key, err)
+		}
+	}
+	if client.subscription != "sub" || client.resourceGroup != "rg" || client.zone != "example.com" {
+		t.Fatalf("unexpected options: %q %q %q", client.subscription, client.resourceGroup, client.zone)
+	}
+	if err := client.SetOption("zone", ""); err == nil {
+		t.Error("expected failure setting an empty option")
+	}
+	if err := client.SetOption("location", "westeurope"); err == nil {
+		t.Error("expected failure setting an unknown option")
+	}
+}
+
+func TestClient_UpdateMissingConfig(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+
+	if err = client.Init(ManagedIdentityAuth); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	err = client.Update("test.example.com", "192.168.1.1")
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected missing options error, got %v", err)
+	}
+}
+
+type request struct {
+	path string
+	set  recordSet
+}
+
+type azureStub struct {
+	*httptest.Server
+	t      *testing.T
+	puts   []request
+	tokens int
+}
+
+// newAzureStub returns a fake ARM endpoint, which also acts as Entra ID and
+// managed identity token endpoint. The "sub" subscription "rg" resource group
+// contains the "example.com" and "sub.example.com" zones: the first one
+// contains an A record set with TTL 60 for "test".
+func newAzureStub(t *testing.T) *azureStub {
+	stub := &azureStub{t: t}
+	stub.Server = httptest.NewServer(http.HandlerFunc(stub.serveHTTP))
+	return stub
+}
+
+func (s *azureStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	t := s.t
+	switch r.URL.Path {
+	case "/tenant/oauth2/v2.0/token":
+		if r.FormValue("client_id") != "client" || r.FormValue("client_secret") != "secret" ||
+			r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != s.URL+"/.default" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client", "error_description": "AADSTS7000215: Invalid client secret provided."}`))
+			return
+		}
+		s.tokens++
+		w.Write([]byte(`{"token_type": "Bearer", "expires_in": 3599, "access_token": "secret"}`))
+		return
+	case "/metadata/identity/oauth2/token":
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != s.URL+"/" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_request", "error_description": "Required metadata header not specified"}`))
+			return
+		}
+		s.tokens++
+		w.Write([]byte(`{"access_token": "secret", "expires_in": "86399", "token_type": "Bearer"}`))
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"code": "InvalidAuthenticationToken", "message": "The access token is invalid."}}`))
+		return
+	}
+	if r.URL.Query().Get("api-version") != apiVersion {
+		t.Errorf("unexpected api-version %q", r.URL.Query().Get("api-version"))
+	}
+	path, found := strings.CutPrefix(r.URL.Path, "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/dnsZones")
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": "ResourceGroupNotFound", "message": "Resource group could not be found."}}`))
+		return
+	}
+	switch {
+	case r.Method == "GET" && path == "":
+		w.Write([]byte(`{"value": [{"name": "sub.example.com"}, {"name": "example.com"}]}`))
+	case r.Method == "GET" && path == "/example.com/A/test":
+		w.Write([]byte(`{"name": "test", "properties": {"TTL": 60, "ARecords": [{"ipv4Address": "10.0.0.1"}]}}`))
+	case r.Method == "GET":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code": "NotFound", "message": "The resource record was not found."}`))
+	case r.Method == "PUT":
+		var set recordSet
+		if err := json.NewDecoder(r.Body).Decode(&set); err != nil {
+			t.Errorf("cannot decode PUT body: %v", err)
+		}
+		s.puts = append(s.puts, request{path, set})
+		w.Write([]byte(`{}`))
+	default:
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		auth     string
+		group    string
+		zone     string
+		expected []request
+		errorMsg string
+	}{
+		"service_principal": {
+			fqdn: "test.example.com",
+			ip:   "192.168.1.1",
+			auth: "tenant:client:secret",
+			expected: []request{
+				{"/example.com/A/test", recordSet{recordSetProperties{TTL: 60, ARecords: []aRecord{{"192.168.1.1"}}}}},
+			},
+		},
+		"managed_identity": {
+			fqdn: "test.example.com",
+			ip:   "192.168.1.1,2001:db8::1,2001:db8::2",
+			auth: ManagedIdentityAuth,
+			expected: []request{
+				{"/example.com/A/test", recordSet{recordSetProperties{TTL: 60, ARecords: []aRecord{{"192.168.1.1"}}}}},
+				{"/example.com/AAAA/test", recordSet{recordSetProperties{TTL: defaultTTL, AAAARecords: []aaaaRecord{{"2001:db8::1"}, {"2001:db8::2"}}}}},
+			},
+		},
+		"longest_zone": {
+			fqdn: "a.sub.example.com",
+			ip:   "192.168.1.1",
+			auth: ManagedIdentityAuth,
+			expected: []request{
+				{"/sub.example.com/A/a", recordSet{recordSetProperties{TTL: defaultTTL, ARecords: []aRecord{{"192.168.1.1"}}}}},
+			},
+		},
+		"configured_zone": {
+			fqdn: "a.sub.example.com",
+			ip:   "192.168.1.1",
+			auth: ManagedIdentityAuth,
+			zone: "example.com",
+			expected: []request{
+				{"/example.com/A/a.sub", recordSet{recordSetProperties{TTL: defaultTTL, ARecords: []aRecord{{"192.168.1.1"}}}}},
+			},
+		},
+		"apex": {
+			fqdn: "example.com",
+			ip:   "192.168.1.1",
+			auth: ManagedIdentityAuth,
+			expected: []request{
+				{"/example.com/A/@", recordSet{recordSetProperties{TTL: defaultTTL, ARecords: []aRecord{{"192.168.1.1"}}}}},
+			},
+		},
+		"wrong_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			auth:     ManagedIdentityAuth,
+			zone:     "example.com",
+			errorMsg: "does not belong to zone",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			auth:     ManagedIdentityAuth,
+			errorMsg: "no zone found",
+		},
+		"unknown_group": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			auth:     ManagedIdentityAuth,
+			group:    "other",
+			errorMsg: "ResourceGroupNotFound",
+		},
+		"bad_secret": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			auth:     "tenant:client:wrong",
+			errorMsg: "Invalid client secret",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := newAzureStub(t)
+			defer stub.Close()
+
+			client := NewWithEndpoint(stub.URL)
+			client.loginEndpoint = stub.URL
+			client.imdsEndpoint = stub.URL
+			if tt.group == "" {
+				tt.group = "rg"
+			}
+			options := map[string]string{"subscription": "sub", "resource-group": tt.group}
+			if tt.zone != "" {
+				options["zone"] = tt.zone
+			}
+			for key, value := range options {
+				if err := client.SetOption(key, value); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+			if err := client.Init(tt.auth); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(stub.puts) != 0 {
+					t.Fatalf("Expected no updates, got %+v", stub.puts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stub.tokens != 1 {
+				t.Errorf("Expected a single access token request, got %d", stub.tokens)
+			}
+			if !reflect.DeepEqual(stub.puts, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, stub.puts)
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := newAzureStub(t)
+			defer stub.Close()
+
+			client := NewWithEndpoint(stub.URL)
+			client.imdsEndpoint = stub.URL
+			for key, value := range map[string]string{"subscription": "sub", "resource-group": "rg"} {
+				if err := client.SetOption(key, value); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+			if err := client.Init(ManagedIdentityAuth); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(stub.puts) != 0 {
+				t.Errorf("Expected no updates, got %+v", stub.puts)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -20,17 +20,27 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	cf "github.com/cloudflare/cloudflare-go"
 	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
 	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/tracing"
 )
 
-var _ ddman.DNSManager = (*Cloudflare)(nil)
+var (
+	_ ddman.DNSManager     = (*Cloudflare)(nil)
+	_ ddman.ContextUpdater = (*Cloudflare)(nil)
+	_ ddman.Planner        = (*Cloudflare)(nil)
+)
 
 type Cloudflare struct {
 	api *cf.API
+	// endpoint keeps the API endpoint set before Init() is called
+	endpoint string
 }
 
 func New() *Cloudflare {
@@ -38,10 +48,17 @@ func New() *Cloudflare {
 }
 
 func (c *Cloudflare) GetApiEndpoint() string {
+	if c.api == nil {
+		return c.endpoint
+	}
 	return c.api.BaseURL
 }
 
 func (c *Cloudflare) SetApiEndpoint(ep string) {
+	if c.api == nil {
+		c.endpoint = ep
+		return
+	}
 	c.api.BaseURL = ep
 }
 
@@ -56,8 +73,13 @@ func (c *Cloudflare) SetUserAgent(ua string) {
 func (c *Cloudflare) Init(token string) error {
 	var err error
 	// Never returns error when no options are passed (like in this case)
-	c.api, err = cf.NewWithAPIToken(token)
-	return err
+	if c.api, err = cf.NewWithAPIToken(token); err != nil {
+		return err
+	}
+	if c.endpoint != "" {
+		c.api.BaseURL = c.endpoint
+	}
+	return nil
 }
 
 func (c *Cloudflare) Resolve(fqdn string) (string, error) {
@@ -65,38 +87,23 @@ func (c *Cloudflare) Resolve(fqdn string) (string, error) {
 }
 
 func (c *Cloudflare) Update(fqdn, ip string) error {
+	return c.UpdateContext(context.Background(), fqdn, ip)
+}
+
+// UpdateContext is Update, tracing the zone lookup, the record list and the
+// record update API calls as children of the span in `ctx`.
+func (c *Cloudflare) UpdateContext(ctx context.Context, fqdn, ip string) error {
 	if c.api == nil {
 		return fmt.Errorf("not authorized")
 	}
 
-	var err error
-	ctx := context.Background()
-	log := slog.Default().With("fqdn", fqdn)
-	zone := ""
-
-	if zone, err = getZone(fqdn); err != nil {
-		return fmt.Errorf("cannot identify DNS zone: %w", err)
-	}
-
-	zoneID, err := c.api.ZoneIDByName(zone)
-	if err != nil {
-		return fmt.Errorf("cannot retrieve DNS zone id: %w", err)
-	}
+	start := time.Now()
+	log := slog.Default().With(logging.Provider, "cflare", logging.FQDN, fqdn, logging.IP, ip)
 
-	log.Debug("DNS zone found", "zone", zone, "zoneID", zoneID)
-
-	dnsRecs, _, err := c.api.ListDNSRecords(ctx, cf.ZoneIdentifier(zoneID),
-		cf.ListDNSRecordsParams{Name: fqdn})
+	_, zoneID, rec, err := c.lookup(ctx, log, fqdn)
 	if err != nil {
 		return err
 	}
-	for _, d := range dnsRecs {
-		log.Debug("record found", "data", d)
-	}
-	if len(dnsRecs) != 1 {
-		return fmt.Errorf("found %d matching records", len(dnsRecs))
-	}
-	rec := dnsRecs[0]
 
 	updateRec := cf.UpdateDNSRecordParams{
 		Type:    rec.Type,
@@ -108,14 +115,80 @@ func (c *Cloudflare) Update(fqdn, ip string) error {
 		TTL:     rec.TTL,
 	}
 
-	if rec, err = c.api.UpdateDNSRecord(ctx, cf.ZoneIdentifier(zoneID), updateRec); err != nil {
+	updateCtx, span := tracing.Start(ctx, "cloudflare.record_update",
+		tracing.FQDN.String(fqdn), tracing.IP.String(ip))
+	rec, err = c.api.UpdateDNSRecord(updateCtx, cf.ZoneIdentifier(zoneID), updateRec)
+	tracing.End(span, err)
+	if err != nil {
 		return err
 	}
-	log.Debug("record updated", "data", rec)
+	log.Debug("record updated", "data", rec, logging.Duration, time.Since(start))
 
 	return nil
 }
 
+// Plan looks up the DNS zone and the record of `fqdn` and returns the change
+// an update to `ip` would apply, without updating the record.
+func (c *Cloudflare) Plan(ctx context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	if c.api == nil {
+		return nil, fmt.Errorf("not authorized")
+	}
+
+	log := slog.Default().With(logging.Provider, "cflare", logging.FQDN, fqdn, logging.IP, ip)
+	zone, zoneID, rec, err := c.lookup(ctx, log, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]string{
+		"zone":      zone,
+		"zone_id":   zoneID,
+		"record_id": rec.ID,
+		"ttl":       strconv.Itoa(rec.TTL),
+	}
+	if rec.Proxied != nil {
+		attrs["proxied"] = strconv.FormatBool(*rec.Proxied)
+	}
+	return []ddman.RecordChange{{
+		Name:       rec.Name,
+		Type:       rec.Type,
+		Old:        rec.Content,
+		New:        ip,
+		Attributes: attrs,
+	}}, nil
+}
+
+// lookup returns the DNS zone of `fqdn`, its id and the record to update.
+func (c *Cloudflare) lookup(ctx context.Context, log *slog.Logger, fqdn string) (string, string, cf.DNSRecord, error) {
+	zone, err := getZone(fqdn)
+	if err != nil {
+		return "", "", cf.DNSRecord{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+
+	_, span := tracing.Start(ctx, "cloudflare.zone_lookup", tracing.Zone.String(zone))
+	zoneID, err := c.api.ZoneIDByName(zone)
+	tracing.End(span, err)
+	if err != nil {
+		return "", "", cf.DNSRecord{}, fmt.Errorf("cannot retrieve DNS zone id: %w", err)
+	}
+
+	log.Debug("DNS zone found", "zone", zone, "zoneID", zoneID)
+
+	listCtx, span := tracing.Start(ctx, "cloudflare.record_list", tracing.FQDN.String(fqdn))
+	dnsRecs, _, err := c.api.ListDNSRecords(listCtx, cf.ZoneIdentifier(zoneID),
+		cf.ListDNSRecordsParams{Name: fqdn})
+	tracing.End(span, err)
+	if err != nil {
+		return "", "", cf.DNSRecord{}, err
+	}
+	for _, d := range dnsRecs {
+		log.Debug("record found", "data", d)
+	}
+	if len(dnsRecs) != 1 {
+		return "", "", cf.DNSRecord{}, fmt.Errorf("found %d matching records", len(dnsRecs))
+	}
+	return zone, zoneID, dnsRecs[0], nil
+}
+
 func getZone(fqdn string) (string, error) {
 	domain := strings.Split(fqdn, ".")
 	if len(domain) < 2 || domain[len(domain)-2] == "" || domain[len(domain)-1] == "" {
@@ -20,9 +20,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	cf "github.com/cloudflare/cloudflare-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNew(t *testing.T) {
@@ -82,6 +90,24 @@ func TestCloudflare_GetSetApiEndpoint(t *testing.T) {
 	}
 }
 
+func TestCloudflare_SetApiEndpointBeforeInit(t *testing.T) {
+	t.Parallel()
+
+	c := New()
+	customEndpoint := "https://custom.api.endpoint.com"
+	c.SetApiEndpoint(customEndpoint)
+	if got := c.GetApiEndpoint(); got != customEndpoint {
+		t.Errorf("Expected API endpoint %q, got %q", customEndpoint, got)
+	}
+
+	if err := c.Init("test-token"); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if c.api.BaseURL != customEndpoint {
+		t.Errorf("Expected API endpoint %q after Init, got %q", customEndpoint, c.api.BaseURL)
+	}
+}
+
 func TestCloudflare_GetSetUserAgent(t *testing.T) {
 	t.Parallel()
 
@@ -374,3 +400,136 @@ func TestCloudflare_UpdateWithMock(t *testing.T) {
 		})
 	}
 }
+
+func TestCloudflare_UpdateContextTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/zones":
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[{"id":"zone123","name":"example.com"}],
+				"result_info":{"page":1,"per_page":50,"count":1,"total_count":1,"total_pages":1}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/zones/zone123/dns_records":
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[{"id":"rec1","name":"test.example.com","type":"A","content":"1.2.3.4","ttl":300}],
+				"result_info":{"page":1,"per_page":100,"count":1,"total_count":1,"total_pages":1}}`)
+		case r.Method == http.MethodPatch && r.URL.Path == "/zones/zone123/dns_records/rec1":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"success":false,"errors":[{"code":9005,"message":"Content for A record is invalid"}],"messages":[],"result":null}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	client := New()
+	client.SetApiEndpoint(server.URL)
+	if err := client.Init("token"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	err := client.UpdateContext(ctx, "test.example.com", "192.168.1.1")
+	root.End()
+	if err == nil || !strings.Contains(err.Error(), "Content for A record is invalid") {
+		t.Fatalf("Expected record update error, got %v", err)
+	}
+
+	expected := []struct {
+		name   string
+		status codes.Code
+	}{
+		{"cloudflare.zone_lookup", codes.Unset},
+		{"cloudflare.record_list", codes.Unset},
+		{"cloudflare.record_update", codes.Error},
+	}
+	spans := exp.GetSpans()
+	if len(spans) != len(expected)+1 {
+		t.Fatalf("Expected %d spans, got %d", len(expected)+1, len(spans))
+	}
+	for i, e := range expected {
+		s := spans[i]
+		if s.Name != e.name || s.Status.Code != e.status {
+			t.Errorf("Expected span %q with status %v, got %q with status %v", e.name, e.status, s.Name, s.Status.Code)
+		}
+		if s.Parent.SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("Expected span %q to be child of the root span", s.Name)
+		}
+	}
+}
+
+func TestCloudflare_Plan(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/zones":
+			fmt.Fprint(w, `{"success":true,"errors":[],"messages":[],"result":[{"id":"zone123","name":"example.com"}],
+				"result_info":{"page":1,"per_page":50,"count":1,"total_count":1,"total_pages":1}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/zones/zone123/dns_records":
+			result := "[]"
+			if r.URL.Query().Get("name") == "test.example.com" {
+				result = `[{"id":"rec1","name":"test.example.com","type":"A","content":"1.2.3.4","ttl":300,"proxied":false}]`
+			}
+			fmt.Fprintf(w, `{"success":true,"errors":[],"messages":[],"result":%s,
+				"result_info":{"page":1,"per_page":100,"count":1,"total_count":1,"total_pages":1}}`, result)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	attrs := map[string]string{"zone": "example.com", "zone_id": "zone123", "record_id": "rec1", "ttl": "300", "proxied": "false"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		changed  bool
+		errorMsg string
+	}{
+		"change":     {"test.example.com", "192.168.1.1", true, ""},
+		"up_to_date": {"test.example.com", "1.2.3.4", false, ""},
+		"no_record":  {"other.example.com", "192.168.1.1", false, "found 0 matching records"},
+		"bad_zone":   {"invalid", "192.168.1.1", false, "cannot identify DNS zone"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := New()
+			client.SetApiEndpoint(server.URL)
+			if err := client.Init("token"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(changes) != 1 {
+				t.Fatalf("Expected 1 change, got %d", len(changes))
+			}
+			c := changes[0]
+			if c.Name != tt.fqdn || c.Type != "A" || c.Old != "1.2.3.4" || c.New != tt.ip || c.Changed() != tt.changed {
+				t.Errorf("unexpected change %+v", c)
+			}
+			if !maps.Equal(c.Attributes, attrs) {
+				t.Errorf("Expected attributes %v, got %v", attrs, c.Attributes)
+			}
+		})
+	}
+
+	if _, err := New().Plan(context.Background(), "test.example.com", "192.168.1.1"); err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
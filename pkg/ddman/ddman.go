@@ -16,6 +16,17 @@ limitations under the License.
 
 package ddman
 
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/net"
+)
+
+// DNSManager is implemented by the DNS backends. The API endpoint should be
+// set before calling Init(), which may build the API client with it.
 type DNSManager interface {
 	GetApiEndpoint() string
 	SetApiEndpoint(ep string)
@@ -25,3 +36,89 @@ type DNSManager interface {
 	Resolve(fqdn string) (string, error)
 	Update(fqdn, ip string) error
 }
+
+// Configurable is implemented by the DNSManagers accepting backend specific
+// options. Options should be set before calling Init().
+type Configurable interface {
+	SetOption(key, value string) error
+}
+
+// Responder is implemented by the DNSManagers reporting the reply of the DNS
+// provider to the last update, e.g., the DynDNS protocol return code.
+type Responder interface {
+	LastResponse() string
+}
+
+// ContextUpdater is implemented by the DNSManagers accepting a context in the
+// updates, used for cancellation and to trace the backend API calls.
+type ContextUpdater interface {
+	UpdateContext(ctx context.Context, fqdn, ip string) error
+}
+
+// RecordChange describes the change an update would apply to a DNS record.
+type RecordChange struct {
+	Name string
+	// Type is the record type, "A" or "AAAA".
+	Type string
+	// Old is the current record content, empty if the record is missing.
+	Old string
+	New string
+	// Attributes are the backend specific details of the record, e.g., the
+	// zone and the TTL.
+	Attributes map[string]string
+}
+
+// Changed returns true if the update would change the record content.
+func (r RecordChange) Changed() bool {
+	return r.Old != r.New
+}
+
+// LookupDNS is the "lookup" attribute of the record changes whose current
+// content was resolved via DNS, as the DNS provider does not expose it.
+const LookupDNS = "dns"
+
+// ResolvePlan returns the changes updating `fqdn` to `ip` would apply,
+// resolving the current addresses via the local resolver: it backs the plans
+// of the DNS providers not exposing the records. The changes have the
+// `attrs` attributes and the "lookup" one set to LookupDNS.
+func ResolvePlan(fqdn, ip string, attrs map[string]string) ([]RecordChange, error) {
+	newV4, newV6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return nil, err
+	}
+	curV4, curV6, err := net.ResolveAll(fqdn)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []RecordChange
+	for _, r := range []struct {
+		typ      string
+		cur, new []string
+	}{{"A", curV4, newV4}, {"AAAA", curV6, newV6}} {
+		if len(r.new) == 0 {
+			continue
+		}
+		slices.Sort(r.cur)
+		slices.Sort(r.new)
+		a := maps.Clone(attrs)
+		if a == nil {
+			a = map[string]string{}
+		}
+		a["lookup"] = LookupDNS
+		changes = append(changes, RecordChange{
+			Name:       fqdn,
+			Type:       r.typ,
+			Old:        strings.Join(r.cur, ","),
+			New:        strings.Join(r.new, ","),
+			Attributes: a,
+		})
+	}
+	return changes, nil
+}
+
+// Planner is implemented by the DNSManagers able to look up the records an
+// update would change, without changing them.
+type Planner interface {
+	Plan(ctx context.Context, fqdn, ip string) ([]RecordChange, error)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ddman
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrValidation is matched (via errors.Is) by the errors returned when the
+// DNS provider rejects a request as invalid.
+var ErrValidation = errors.New("validation failed")
+
+// FieldError describes a request field rejected by the DNS provider.
+type FieldError struct {
+	Path    string
+	Code    string
+	Message string
+}
+
+// ValidationError is returned when the DNS provider rejects a request as
+// invalid, reporting the provider error code and the offending fields.
+type ValidationError struct {
+	Code    string
+	Message string
+	Fields  []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("%s: %s", ErrValidation, e.Message)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	var fields []string
+	for _, f := range e.Fields {
+		fields = append(fields, f.Path+": "+f.Message)
+	}
+	if len(fields) > 0 {
+		msg += ": " + strings.Join(fields, "; ")
+	}
+	return msg
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
@@ -0,0 +1,221 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package desec implements a DNSManager for the deSEC.io DNS hosting service
+// using the REST API specified at https://desec.readthedocs.io/en/latest/dns/rrsets.html .
+package desec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	// DynEndpoint is the deSEC dyndns compatible update endpoint, to be used
+	// with the dyn package.
+	DynEndpoint = "https://update.dedyn.io"
+
+	defaultAPIEP     = "https://desec.io/api/v1"
+	defaultUserAgent = "ddflare-desec-"
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type domain struct {
+	Name       string `json:"name"`
+	MinimumTTL int    `json:"minimum_ttl"`
+}
+
+type rrset struct {
+	Subname string   `json:"subname"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+// NewWithEndpoint initializes a new deSEC client which uses 'endpoint' as API
+// endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the deSEC API token
+// passed as parameter.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize deSEC client: missing token")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"Authorization": {"Token " + token}})
+	if err != nil {
+		return err
+	}
+	api.ErrorMessage = errorMessage
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: both the
+// A and AAAA RRsets are replaced in a single request.
+func (c *Client) Update(fqdn, ip string) error {
+	var changes []rrset
+	recs, err := c.records(fqdn, &changes)
+	if err != nil {
+		return err
+	}
+	if err = recs.Upsert(ip); err != nil {
+		return err
+	}
+
+	if err = c.Do("PATCH", "/domains/"+recs.Zone+"/rrsets/", changes, nil); err != nil {
+		return fmt.Errorf("RRsets update failed: %w", err)
+	}
+	slog.Debug("RRsets updated", logging.Endpoint, c.endpoint, logging.FQDN, fqdn, "data", changes)
+
+	return nil
+}
+
+// Plan looks up the DNS zone and the RRsets of `fqdn` and returns the changes
+// an update to `ip` would apply, without updating the RRsets.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA RRsets:
+// their updates are appended to `changes`.
+func (c *Client) records(fqdn string, changes *[]rrset) (restapi.Records[rrset], error) {
+	if c.API == nil {
+		return restapi.Records[rrset]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	dom, err := c.getDomain(fqdn)
+	if err != nil {
+		return restapi.Records[rrset]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	subname := net.RecordName(fqdn, dom.Name)
+	log.Debug("DNS zone found", "zone", dom.Name, "subname", subname)
+
+	var current []rrset
+	if err = c.Do("GET", "/domains/"+dom.Name+"/rrsets/?subname="+url.QueryEscape(subname), nil, &current); err != nil {
+		return restapi.Records[rrset]{}, fmt.Errorf("cannot retrieve RRsets: %w", err)
+	}
+	return restapi.Records[rrset]{
+		Find: func(rType string) ([]rrset, error) {
+			var found []rrset
+			for _, r := range current {
+				if r.Type == rType {
+					log.Debug("RRset found", "type", r.Type, "ttl", r.TTL, "records", r.Records)
+					found = append(found, r)
+				}
+			}
+			return found, nil
+		},
+		Update: func(rType string, found []rrset, addrs []string) error {
+			rs := rrset{Subname: subname, Type: rType, TTL: dom.MinimumTTL, Records: addrs}
+			if len(found) > 0 && found[0].TTL != 0 {
+				rs.TTL = found[0].TTL
+			}
+			*changes = append(*changes, rs)
+			return nil
+		},
+		Addresses: func(r rrset) []string { return r.Records },
+		Zone:      dom.Name,
+	}, nil
+}
+
+// getDomain returns the deSEC domain which is authoritative for `fqdn`.
+func (c *Client) getDomain(fqdn string) (*domain, error) {
+	var doms []domain
+	if err := c.Do("GET", "/domains/?owns_qname="+url.QueryEscape(fqdn), nil, &doms); err != nil {
+		return nil, err
+	}
+	if len(doms) != 1 {
+		return nil, fmt.Errorf("no domain found for %q", fqdn)
+	}
+	return &doms[0], nil
+}
+
+// errorMessage extracts the error detail from the deSEC API error reply.
+func errorMessage(body []byte) string {
+	var reply struct {
+		Detail string `json:"detail"`
+	}
+	if json.Unmarshal(body, &reply) != nil {
+		return ""
+	}
+	return reply.Detail
+}
@@ -0,0 +1,264 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package desec
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+}
+
+func TestClient_Init(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		token string
+		fails bool
+	}{
+		"empty": {"", true},
+		"valid": {"i-T3b1h_OI-H9ab8tRS98stGtURe", false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := New()
+			err := client.Init(tt.token)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected failure with token %q", tt.token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected failure: %v", err)
+			}
+			if client.API == nil {
+				t.Fatal("expected the API connection to be set up")
+			}
+		})
+	}
+}
+
+func TestClient_UpdateUninitialized(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+// newDeSECStub returns a fake deSEC API server hosting the "example.com"
+// domain, which already contains an A RRset for "test.example.com".
+func newDeSECStub(t *testing.T, patches *[][]rrset) *httptest.Server {
+	auth := restapitest.Auth{Header: "Authorization", Value: "Token secret", Reply: `{"detail": "Invalid token."}`}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, rrsets *[]rrset) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/domains/":
+			if strings.HasSuffix(r.URL.Query().Get("owns_qname"), "example.com") {
+				w.Write([]byte(`[{"name": "example.com", "minimum_ttl": 3600}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		case r.Method == "GET" && r.URL.Path == "/domains/example.com/rrsets/":
+			if r.URL.Query().Get("subname") == "test" {
+				w.Write([]byte(`[{"subname": "test", "type": "A", "ttl": 7200, "records": ["10.0.0.1"]}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		case r.Method == "PATCH" && r.URL.Path == "/domains/example.com/rrsets/":
+			*patches = append(*patches, *rrsets)
+			w.Write([]byte(`[]`))
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		token    string
+		expected []rrset
+		errorMsg string
+	}{
+		"ipv4": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			expected: []rrset{{Subname: "test", Type: "A", TTL: 7200, Records: []string{"192.168.1.1"}}},
+		},
+		"ipv4_and_ipv6": {
+			fqdn:  "test.example.com.",
+			ip:    "192.168.1.1,2001:db8::1",
+			token: "secret",
+			expected: []rrset{
+				{Subname: "test", Type: "A", TTL: 7200, Records: []string{"192.168.1.1"}},
+				{Subname: "test", Type: "AAAA", TTL: 3600, Records: []string{"2001:db8::1"}},
+			},
+		},
+		"apex": {
+			fqdn:     "example.com",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			expected: []rrset{{Subname: "", Type: "A", TTL: 3600, Records: []string{"192.168.1.1"}}},
+		},
+		"unknown_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "no domain found",
+		},
+		"bad_token": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "wrong",
+			errorMsg: "Invalid token.",
+		},
+		"bad_ip": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1",
+			token:    "secret",
+			errorMsg: "invalid IP address",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var patches [][]rrset
+			server := newDeSECStub(t, &patches)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(patches) != 0 {
+					t.Fatalf("Expected no updates, got %v", patches)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(patches) != 1 {
+				t.Fatalf("Expected a single PATCH request, got %d", len(patches))
+			}
+			if !slices.EqualFunc(patches[0], tt.expected, func(a, b rrset) bool {
+				return a.Subname == b.Subname && a.Type == b.Type && a.TTL == b.TTL && slices.Equal(a.Records, b.Records)
+			}) {
+				t.Fatalf("Expected RRsets %+v, got %+v", tt.expected, patches[0])
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no domain found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var patches [][]rrset
+			server := newDeSECStub(t, &patches)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(patches) != 0 {
+				t.Errorf("Expected no updates, got %+v", patches)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package digitalocean implements a DNSManager for the DigitalOcean DNS
+// service using the domains API specified at
+// https://docs.digitalocean.com/reference/api/digitalocean/#tag/Domain-Records .
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://api.digitalocean.com/v2"
+	defaultUserAgent = "ddflare-digitalocean-"
+	defaultTTL       = 1800
+	pageSize         = 100
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type record struct {
+	ID   int    `json:"id,omitempty"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+// NewWithEndpoint initializes a new DigitalOcean client which uses 'endpoint'
+// as API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the DigitalOcean
+// personal access token passed as parameter.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize DigitalOcean client: missing token")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		return err
+	}
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may contain both an IPv4 and an IPv6 address, comma separated: the
+// A and AAAA records are updated, or created if missing.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	domain, err := c.getDomain(fqdn)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, domain)
+	if name == "" {
+		name = "@"
+	}
+	log.Debug("DNS zone found", "zone", domain)
+
+	path := "/domains/" + domain + "/records"
+	return restapi.Records[record]{
+		Find: func(rType string) ([]record, error) {
+			found, err := c.listRecords(domain, fqdn, name, rType)
+			for _, r := range found {
+				log.Debug("record found", "data", r)
+			}
+			return found, err
+		},
+		Create: func(rType string, addrs []string) error {
+			want := record{Type: rType, Name: name, Data: addrs[0], TTL: defaultTTL}
+			if err := c.Do("POST", path, want, nil); err != nil {
+				return err
+			}
+			log.Debug("record created", "data", want)
+			return nil
+		},
+		Update: func(rType string, found []record, addrs []string) error {
+			want := record{Type: rType, Name: name, Data: addrs[0], TTL: found[0].TTL}
+			if err := c.Do("PUT", path+"/"+strconv.Itoa(found[0].ID), want, nil); err != nil {
+				return err
+			}
+			log.Debug("record updated", "data", want)
+			return nil
+		},
+		Single:    true,
+		Addresses: func(r record) []string { return []string{r.Data} },
+		Zone:      domain,
+	}, nil
+}
+
+// getDomain returns the DigitalOcean domain hosting `fqdn`.
+func (c *Client) getDomain(fqdn string) (string, error) {
+	return net.LookupZone(fqdn, func(name string) (bool, error) {
+		return restapi.Exists(c.Do("GET", "/domains/"+name, nil, nil))
+	})
+}
+
+// listRecords returns the records of type `rType` of the `domain` matching
+// `fqdn`, walking through all the result pages. The records are filtered by
+// the API but `name`, the record name relative to the domain, is checked
+// again on the returned records.
+func (c *Client) listRecords(domain, fqdn, name, rType string) ([]record, error) {
+	var found []record
+	q := url.Values{}
+	q.Set("name", fqdn)
+	q.Set("type", rType)
+	q.Set("per_page", strconv.Itoa(pageSize))
+
+	for page := 1; ; page++ {
+		q.Set("page", strconv.Itoa(page))
+		var reply struct {
+			Records []record `json:"domain_records"`
+			Links   struct {
+				Pages struct {
+					Next string `json:"next"`
+				} `json:"pages"`
+			} `json:"links"`
+		}
+		if err := c.Do("GET", "/domains/"+domain+"/records?"+q.Encode(), nil, &reply); err != nil {
+			return nil, err
+		}
+		for _, r := range reply.Records {
+			if r.Name == name && r.Type == rType {
+				found = append(found, r)
+			}
+		}
+		if reply.Links.Pages.Next == "" {
+			return found, nil
+		}
+	}
+}
@@ -19,16 +19,23 @@ limitations under the License.
 package dyn
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/ddflare/ddflare/pkg/ddman"
 	"github.com/ddflare/ddflare/pkg/dyndnsapi"
+	"github.com/ddflare/ddflare/pkg/logging"
 	"github.com/ddflare/ddflare/pkg/net"
 	"github.com/ddflare/ddflare/pkg/version"
 )
 
-var _ ddman.DNSManager = (*Client)(nil)
+var (
+	_ ddman.DNSManager     = (*Client)(nil)
+	_ ddman.Responder      = (*Client)(nil)
+	_ ddman.ContextUpdater = (*Client)(nil)
+)
 
 const (
 	defaultAPIEP     = "https://members.dyndns.org"
@@ -38,6 +45,8 @@ const (
 type Client struct {
 	endpoint  string
 	userAgent string
+	// lastResponse is the return code of the last update.
+	lastResponse string
 	*dyndnsapi.API
 }
 
@@ -59,10 +68,13 @@ func (c *Client) GetApiEndpoint() string {
 	return c.endpoint
 }
 
-// SetApiEndpoint sets the API Endpoint but would be uneffective if the .Init() has already
-// been called on the client.
+// SetApiEndpoint sets the API Endpoint, also of the already initialized
+// client.
 func (c *Client) SetApiEndpoint(ep string) {
 	c.endpoint = ep
+	if c.API != nil {
+		c.API.SetEndpoint(ep)
+	}
 }
 
 func (c *Client) GetUserAgent() string {
@@ -71,6 +83,9 @@ func (c *Client) GetUserAgent() string {
 
 func (c *Client) SetUserAgent(ua string) {
 	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
 }
 
 // Init
@@ -90,15 +105,32 @@ func (c *Client) Resolve(fqdn string) (string, error) {
 
 // Update updates the `fqdn` to the `ip` address passed as parameter.
 func (c *Client) Update(fqdn, ip string) error {
+	return c.UpdateContext(context.Background(), fqdn, ip)
+}
+
+// UpdateContext is Update(), tracing the update request as a child of the
+// span in `ctx`.
+func (c *Client) UpdateContext(ctx context.Context, fqdn, ip string) error {
 	var err error
 	var retCode dyndnsapi.ReturnCode
-	log := slog.Default().With("endpoint", c.endpoint, "fqdn", fqdn)
+	start := time.Now()
+	log := slog.Default().With(logging.Provider, "dyn", logging.Endpoint, c.endpoint,
+		logging.FQDN, fqdn, logging.IP, ip)
 
-	if retCode, err = c.API.Update(fqdn, ip); err != nil {
+	retCode, err = c.API.UpdateContext(ctx, fqdn, ip)
+	c.lastResponse = retCode.String()
+	if err != nil {
 		return fmt.Errorf("dyn update failed: %w", err)
 	}
 	if retCode == dyndnsapi.MsgNoChg {
-		log.Warn("Dyn API Endpoint replied the FQDN was already set at the right IP", "ip", ip)
+		log.Warn("Dyn API Endpoint replied the FQDN was already set at the right IP")
 	}
+	log.Debug("record updated", "code", retCode, logging.Duration, time.Since(start))
 	return nil
 }
+
+// LastResponse returns the return code of the last update (e.g., "good" or
+// "nochg").
+func (c *Client) LastResponse() string {
+	return c.lastResponse
+}
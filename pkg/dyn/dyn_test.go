@@ -17,6 +17,9 @@ limitations under the License.
 package dyn
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -260,9 +263,30 @@ func TestClient_SetEndpointAfterInit(t *testing.T) {
 		t.Errorf("Expected endpoint %q, got %q", newEndpoint, client.GetApiEndpoint())
 	}
 
-	// Note: According to the comment in the code, this change would be
-	// ineffective for the already initialized API, but the getter should
-	// still return the new value
+}
+
+func TestClient_SetAfterInit(t *testing.T) {
+	t.Parallel()
+
+	var agent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.Header.Get("User-Agent")
+		w.Write([]byte("good"))
+	}))
+	defer server.Close()
+
+	client := New()
+	if err := client.Init("user:password"); err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	client.SetApiEndpoint(server.URL)
+	client.SetUserAgent("custom-agent")
+	if err := client.Update("test.example.com", "192.168.1.1"); err != nil {
+		t.Fatalf("Unexpected update failure: %v", err)
+	}
+	if agent != "custom-agent" {
+		t.Errorf("Expected user agent %q, got %q", "custom-agent", agent)
+	}
 }
 
 func TestClient_FullWorkflow(t *testing.T) {
@@ -328,3 +352,47 @@ func TestDefaultConstants(t *testing.T) {
 		t.Errorf("Expected user agent to end with version %q, got %q", version.Version, ua)
 	}
 }
+
+func TestClient_LastResponse(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("hostname") {
+		case "test.example.com":
+			fmt.Fprint(w, "nochg 192.168.1.1")
+		default:
+			fmt.Fprint(w, "nohost")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := map[string]struct {
+		fqdn     string
+		response string
+		fails    bool
+	}{
+		"nochg":  {"test.example.com", "nochg", false},
+		"nohost": {"other.example.com", "nohost", true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := NewWithEndpoint(server.URL)
+			if client.LastResponse() != "" {
+				t.Errorf("Expected empty response before the first update, got %q", client.LastResponse())
+			}
+			if err := client.Init("test-token"); err != nil {
+				t.Fatalf("Failed to initialize client: %v", err)
+			}
+			err := client.Update(tt.fqdn, "192.168.1.1")
+			if (err != nil) != tt.fails {
+				t.Fatalf("Unexpected update result: %v", err)
+			}
+			if client.LastResponse() != tt.response {
+				t.Errorf("Expected response %q, got %q", tt.response, client.LastResponse())
+			}
+		})
+	}
+}
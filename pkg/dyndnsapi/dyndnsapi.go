@@ -19,12 +19,17 @@ limitations under the License.
 package dyndnsapi
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/tracing"
 )
 
 type API struct {
@@ -69,6 +74,32 @@ var code2Msg = map[int]string{
 	MsgUnknownErr: "protocol error: unknown reply message",
 }
 
+var code2Name = map[ReturnCode]string{
+	MsgGood:       "good",
+	MsgNoChg:      "nochg",
+	MsgBadAuth:    "badauth",
+	MsgNotDonator: "!donator",
+	MsgNotFQDN:    "notfqdn",
+	MsgNoHost:     "nohost",
+	MsgNumHost:    "numhost",
+	MsgAbuse:      "abuse",
+	MsgBadAgent:   "badagent",
+	MsgDNSErr:     "dnserr",
+	Msg911:        "911",
+	MsgUnknownErr: "unknown",
+	MsgDataErr:    "data-error",
+	MsgCommErr:    "comm-error",
+}
+
+// String returns the DynDNS API reply message of the return code, or a
+// description for the codes tracking the client side errors.
+func (r ReturnCode) String() string {
+	if name, ok := code2Name[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("ReturnCode(%d)", int(r))
+}
+
 // New initializes a new DynDNS update connection to the speficied 'endpoint', authenticating
 // with the token parameter and identifying the client via the 'useragent' string.
 func New(endpoint, token, useragent string) (*API, error) {
@@ -85,8 +116,33 @@ func New(endpoint, token, useragent string) (*API, error) {
 	}, nil
 }
 
+// SetEndpoint sets the endpoint of the following updates.
+func (c *API) SetEndpoint(endpoint string) {
+	c.baseURL = endpoint
+}
+
+// SetUserAgent sets the user agent string identifying the client in the
+// following updates.
+func (c *API) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
 // Update updates the `fqdn` to the `ip` address passed as parameters.
 func (c *API) Update(fqdn, ip string) (ReturnCode, error) {
+	return c.UpdateContext(context.Background(), fqdn, ip)
+}
+
+// UpdateContext is Update(), tracing the /nic/update request as a child of
+// the span in `ctx`, which also cancels the request.
+func (c *API) UpdateContext(ctx context.Context, fqdn, ip string) (ReturnCode, error) {
+	ctx, span := tracing.Start(ctx, "dyndns.update", tracing.FQDN.String(fqdn), tracing.IP.String(ip))
+	retCode, err := c.update(ctx, fqdn, ip)
+	span.SetAttributes(tracing.ReturnCode.String(retCode.String()))
+	tracing.End(span, err)
+	return retCode, err
+}
+
+func (c *API) update(ctx context.Context, fqdn, ip string) (ReturnCode, error) {
 	if c.apiToken == "" {
 		return MsgDataErr, fmt.Errorf("no authorization credentials found")
 	}
@@ -103,9 +159,9 @@ func (c *API) Update(fqdn, ip string) (ReturnCode, error) {
 		err error
 	)
 
-	log := slog.Default().With("endpoint", c.baseURL, "fqdn", fqdn)
+	log := slog.Default().With(logging.Endpoint, c.baseURL, logging.FQDN, fqdn, logging.IP, ip)
 
-	if req, err = http.NewRequest("GET", c.baseURL+"/nic/update", nil); err != nil {
+	if req, err = http.NewRequestWithContext(ctx, "GET", c.baseURL+"/nic/update", nil); err != nil {
 		return MsgCommErr, fmt.Errorf("connection to %s failed: %w", c.baseURL, err)
 	}
 	req.Header.Add("Authorization", "Basic "+c.apiToken)
@@ -116,12 +172,13 @@ func (c *API) Update(fqdn, ip string) (ReturnCode, error) {
 	q.Add("myip", ip)
 
 	req.URL.RawQuery = q.Encode()
+	start := time.Now()
 	if res, err = http.DefaultClient.Do(req); err != nil {
 		return MsgCommErr, fmt.Errorf("connection to %s failed: %w", c.baseURL, err)
 	}
 	defer res.Body.Close()
 
-	log.Debug("endpoint connected", "status", res.Status, "code", res.StatusCode)
+	log.Debug("endpoint connected", "status", res.Status, "code", res.StatusCode, logging.Duration, time.Since(start))
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
 		return MsgCommErr, fmt.Errorf("endpoint %q returned %d (%s) status", c.baseURL, res.StatusCode, res.Status)
 	}
@@ -165,7 +222,7 @@ func interpretResponse(resp string) ReturnCode {
 		return MsgBadAuth
 	case "!donator":
 		return MsgNotDonator
-	case "nofqdn":
+	case "notfqdn", "nofqdn":
 		return MsgNotFQDN
 	case "nohost":
 		return MsgNoHost
@@ -17,11 +17,20 @@ limitations under the License.
 package dyndnsapi
 
 import (
+	"context"
 	"encoding/base64"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/ddflare/ddflare/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNew(t *testing.T) {
@@ -299,7 +308,8 @@ func TestInterpretResponse(t *testing.T) {
 		"nochg_with_ip":   {"nochg 192.168.1.1", MsgNoChg},
 		"badauth":         {"badauth", MsgBadAuth},
 		"notdonator":      {"!donator", MsgNotDonator},
-		"notfqdn":         {"nofqdn", MsgNotFQDN},
+		"notfqdn":         {"notfqdn", MsgNotFQDN},
+		"nofqdn":          {"nofqdn", MsgNotFQDN},
 		"nohost":          {"nohost", MsgNoHost},
 		"numhost":         {"numhost", MsgNumHost},
 		"abuse":           {"abuse", MsgAbuse},
@@ -379,6 +389,22 @@ func TestCode2MsgMapping(t *testing.T) {
 	}
 }
 
+func TestReturnCode_String(t *testing.T) {
+	t.Parallel()
+
+	for code := ReturnCode(MsgGood); code < MsgLast; code++ {
+		if _, exists := code2Name[code]; !exists {
+			t.Errorf("Return code %d does not have a corresponding name", code)
+		}
+	}
+	if s := ReturnCode(MsgNotDonator).String(); s != "!donator" {
+		t.Errorf("Expected name %q, got %q", "!donator", s)
+	}
+	if s := ReturnCode(MsgLast).String(); s != fmt.Sprintf("ReturnCode(%d)", MsgLast) {
+		t.Errorf("Unexpected name %q for an invalid code", s)
+	}
+}
+
 func TestAPI_Update_AuthHeaderEncoding(t *testing.T) {
 	t.Parallel()
 
@@ -439,3 +465,63 @@ func TestAPI_Update_ConnectionError(t *testing.T) {
 		t.Errorf("Expected connection error message, got %q", err.Error())
 	}
 }
+
+func TestAPI_UpdateContextTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "nochg 192.168.1.1")
+	}))
+	t.Cleanup(server.Close)
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	api, err := New(server.URL, "user:pass", "test")
+	if err != nil {
+		t.Fatalf("unexpected New failure: %v", err)
+	}
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	code, err := api.UpdateContext(ctx, "test.example.com", "192.168.1.1")
+	root.End()
+	if err != nil || code != MsgNoChg {
+		t.Fatalf("Expected %q return code, got %q (%v)", ReturnCode(MsgNoChg), code, err)
+	}
+
+	// the request is canceled with the context
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if code, err := api.UpdateContext(cancelled, "test.example.com", "192.168.1.1"); err == nil || code != MsgCommErr {
+		t.Errorf("Expected %q return code on canceled context, got %q (%v)", ReturnCode(MsgCommErr), code, err)
+	}
+
+	expected := []struct {
+		code   string
+		status codes.Code
+	}{
+		{ReturnCode(MsgNoChg).String(), codes.Unset},
+		{ReturnCode(MsgCommErr).String(), codes.Error},
+	}
+	var spans []tracetest.SpanStub
+	for _, s := range exp.GetSpans() {
+		if s.Name == "dyndns.update" {
+			spans = append(spans, s)
+		}
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("Expected %d dyndns.update spans, got %d", len(expected), len(spans))
+	}
+	for i, e := range expected {
+		s := spans[i]
+		if s.Status.Code != e.status {
+			t.Errorf("Expected span #%d with status %v, got %v", i, e.status, s.Status.Code)
+		}
+		if s.Parent.SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("Expected span #%d to be child of the root span", i)
+		}
+		if !slices.Contains(s.Attributes, tracing.ReturnCode.String(e.code)) {
+			t.Errorf("Expected return code %q among the span attributes %v", e.code, s.Attributes)
+		}
+	}
+}
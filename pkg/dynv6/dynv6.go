@@ -0,0 +1,211 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dynv6 implements a DNSManager for the dynv6 zones using the HTTP
+// update API specified at https://dynv6.com/docs/apis .
+package dynv6
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager   = (*Client)(nil)
+	_ ddman.Configurable = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP        = "https://dynv6.com"
+	defaultUserAgent    = "ddflare-dynv6-"
+	defaultPrefixLength = 64
+)
+
+// ReturnCode tracks the outcome of an update request.
+type ReturnCode int
+
+const (
+	MsgUpdated   ReturnCode = iota // The zone addresses have been updated.
+	MsgUnchanged                   // The zone was already set to the addresses.
+	MsgUnknown                     // Unknown reply message.
+)
+
+type Client struct {
+	endpoint     string
+	userAgent    string
+	token        string
+	prefixLength int
+}
+
+// NewWithEndpoint initializes a new dynv6 client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:     ep,
+		userAgent:    defaultUserAgent + version.Version,
+		prefixLength: defaultPrefixLength,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// SetOption sets the dynv6 specific options. The only option supported is
+// "ipv6prefix-length": the length of the IPv6 prefix derived from the IPv6
+// address and sent along with it to update the zone hosts (64 by default,
+// 0 to disable).
+func (c *Client) SetOption(key, value string) error {
+	switch key {
+	case "ipv6prefix-length":
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 || length > 128 {
+			return fmt.Errorf("invalid %q option %q: a number between 0 and 128 expected", key, value)
+		}
+		c.prefixLength = length
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Init stores the HTTP token of the zone.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize dynv6 client: missing token")
+	}
+	c.token = token
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` zone to the `ip` address passed as parameter.
+// `ip` may contain both an IPv4 and an IPv6 address, comma separated.
+func (c *Client) Update(fqdn, ip string) error {
+	if c.token == "" {
+		return fmt.Errorf("not authorized")
+	}
+
+	v4, v6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return err
+	}
+	if len(v4) > 1 || len(v6) > 1 {
+		return fmt.Errorf("multiple addresses of the same family are not supported")
+	}
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	q := url.Values{}
+	q.Set("hostname", fqdn)
+	q.Set("token", c.token)
+	if len(v4) > 0 {
+		q.Set("ipv4", v4[0])
+	}
+	if len(v6) > 0 {
+		q.Set("ipv6", v6[0])
+		if c.prefixLength > 0 {
+			prefix, err := netip.MustParseAddr(v6[0]).Prefix(c.prefixLength)
+			if err != nil {
+				return fmt.Errorf("cannot compute IPv6 prefix: %w", err)
+			}
+			q.Set("ipv6prefix", prefix.String())
+		}
+	}
+
+	req, err := http.NewRequest("GET", c.endpoint+"/api/update?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", c.endpoint, err)
+	}
+	req.Header.Add("User-Agent", c.userAgent)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", c.endpoint, err)
+	}
+	defer res.Body.Close()
+
+	log.Debug("endpoint connected", "status", res.Status, "code", res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failure reading endpoint %q reply: %w", c.endpoint, err)
+	}
+	msg := strings.TrimSpace(string(body))
+	log.Debug("parsing reply message", "body", msg)
+
+	// Errors are reported with a non 2xx status code and a plain text
+	// description in the body.
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		if msg == "" {
+			msg = res.Status
+		}
+		return fmt.Errorf("dynv6 update failed: %s", msg)
+	}
+	switch interpretResponse(msg) {
+	case MsgUpdated:
+		return nil
+	case MsgUnchanged:
+		log.Warn("dynv6 replied the FQDN was already set at the right IP", logging.IP, ip)
+		return nil
+	}
+	return fmt.Errorf("dynv6 update failed: protocol error: unknown reply message %q", msg)
+}
+
+// interpretResponse parses the plain text reply of a successful update
+// request.
+func interpretResponse(msg string) ReturnCode {
+	switch msg {
+	case "addresses updated":
+		return MsgUpdated
+	case "addresses unchanged":
+		return MsgUnchanged
+	}
+	return MsgUnknown
+}
@@ -0,0 +1,190 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynv6
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty token")
+	}
+	err := client.Update("test.dynv6.net", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+	for _, value := range []string{"", "-1", "129", "a"} {
+		if err := client.SetOption("ipv6prefix-length", value); err == nil {
+			t.Errorf("Expected SetOption failure with prefix length %q", value)
+		}
+	}
+	if err := client.SetOption("ttl", "60"); err == nil {
+		t.Error("Expected SetOption failure with an unknown option")
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn         string
+		ip           string
+		token        string
+		prefixLength string
+		expected     url.Values
+		errorMsg     string
+	}{
+		"ipv4": {
+			fqdn:     "test.dynv6.net",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			expected: url.Values{"hostname": {"test.dynv6.net"}, "token": {"secret"}, "ipv4": {"192.168.1.1"}},
+		},
+		"dual_stack": {
+			fqdn:  "test.dynv6.net.",
+			ip:    "192.168.1.1,2001:db8:1:2:3:4:5:6",
+			token: "secret",
+			expected: url.Values{"hostname": {"test.dynv6.net"}, "token": {"secret"}, "ipv4": {"192.168.1.1"},
+				"ipv6": {"2001:db8:1:2:3:4:5:6"}, "ipv6prefix": {"2001:db8:1:2::/64"}},
+		},
+		"prefix_length": {
+			fqdn:         "test.dynv6.net",
+			ip:           "2001:db8:1:2:3:4:5:6",
+			token:        "secret",
+			prefixLength: "56",
+			expected: url.Values{"hostname": {"test.dynv6.net"}, "token": {"secret"},
+				"ipv6": {"2001:db8:1:2:3:4:5:6"}, "ipv6prefix": {"2001:db8:1::/56"}},
+		},
+		"no_prefix": {
+			fqdn:         "test.dynv6.net",
+			ip:           "2001:db8::1",
+			token:        "secret",
+			prefixLength: "0",
+			expected:     url.Values{"hostname": {"test.dynv6.net"}, "token": {"secret"}, "ipv6": {"2001:db8::1"}},
+		},
+		"unchanged": {
+			fqdn:     "test.dynv6.net",
+			ip:       "10.0.0.1",
+			token:    "secret",
+			expected: url.Values{"hostname": {"test.dynv6.net"}, "token": {"secret"}, "ipv4": {"10.0.0.1"}},
+		},
+		"bad_token": {
+			fqdn:     "test.dynv6.net",
+			ip:       "192.168.1.1",
+			token:    "wrong",
+			errorMsg: "invalid authentication token",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "zone not found",
+		},
+		"multiple_addresses": {
+			fqdn:     "test.dynv6.net",
+			ip:       "192.168.1.1,192.168.1.2",
+			token:    "secret",
+			errorMsg: "multiple addresses",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var query url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				switch {
+				case r.URL.Path != "/api/update":
+					w.WriteHeader(http.StatusNotFound)
+				case q.Get("token") != "secret":
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte("invalid authentication token"))
+				case !strings.HasSuffix(q.Get("hostname"), ".dynv6.net"):
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte("zone not found"))
+				case q.Get("ipv4") == "10.0.0.1":
+					query = q
+					w.Write([]byte("addresses unchanged"))
+				default:
+					query = q
+					w.Write([]byte("addresses updated"))
+				}
+			}))
+			defer server.Close()
+
+			client := NewWithEndpoint(server.URL)
+			if tt.prefixLength != "" {
+				if err := client.SetOption("ipv6prefix-length", tt.prefixLength); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(query, tt.expected) {
+				t.Fatalf("Expected query %v, got %v", tt.expected, query)
+			}
+		})
+	}
+}
+
+func TestInterpretResponse(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]ReturnCode{
+		"addresses updated":   MsgUpdated,
+		"addresses unchanged": MsgUnchanged,
+		"good 192.168.1.1":    MsgUnknown,
+		"":                    MsgUnknown,
+	}
+	for msg, code := range tests {
+		if got := interpretResponse(msg); got != code {
+			t.Errorf("interpretResponse(%q): expected %d, got %d", msg, code, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package freedns implements a DNSManager for the FreeDNS (afraid.org)
+// dynamic DNS v2 interface, as specified at https://freedns.afraid.org/dynamic/v2/ .
+//
+// The update token, unique for each dynamic record, is passed in the URL
+// path: the FQDN is not part of the request.
+package freedns
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var _ ddman.DNSManager = (*Client)(nil)
+
+const (
+	defaultAPIEP     = "https://sync.afraid.org"
+	defaultUserAgent = "ddflare-freedns-"
+)
+
+// ReturnCode tracks the outcome of an update request.
+type ReturnCode int
+
+const (
+	MsgUpdated  ReturnCode = iota // The record has been updated.
+	MsgNoChange                   // The record was already set to the address.
+	MsgError                      // The update has been refused.
+	MsgUnknown                    // Unknown reply message.
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	token     string
+}
+
+// NewWithEndpoint initializes a new FreeDNS client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// Init stores the update token of the dynamic record.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize FreeDNS client: missing update token")
+	}
+	c.token = token
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the record identified by the update token to the `ip`
+// address passed as parameter: `fqdn` is used for logging only.
+func (c *Client) Update(fqdn, ip string) error {
+	if c.token == "" {
+		return fmt.Errorf("not authorized")
+	}
+	if ip == "" {
+		return fmt.Errorf("ip address is missing")
+	}
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	req, err := http.NewRequest("GET", c.endpoint+"/u/"+url.PathEscape(c.token)+"/?myip="+url.QueryEscape(ip), nil)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", c.endpoint, err)
+	}
+	req.Header.Add("User-Agent", c.userAgent)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", c.endpoint, err)
+	}
+	defer res.Body.Close()
+
+	log.Debug("endpoint connected", "status", res.Status, "code", res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failure reading endpoint %q reply: %w", c.endpoint, err)
+	}
+	log.Debug("parsing reply message", "body", string(body))
+
+	retCode, msg := interpretResponse(string(body))
+	switch retCode {
+	case MsgUpdated:
+		return nil
+	case MsgNoChange:
+		log.Warn("FreeDNS replied the FQDN was already set at the right IP", logging.IP, ip)
+		return nil
+	case MsgError:
+		return fmt.Errorf("freedns update failed: %s", msg)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("endpoint %q returned %d (%s) status", c.endpoint, res.StatusCode, res.Status)
+	}
+	return fmt.Errorf("freedns update failed: protocol error: unknown reply message %q", msg)
+}
+
+// interpretResponse parses the plain text reply of the update endpoint,
+// returning the ReturnCode and the reply message.
+func interpretResponse(body string) (ReturnCode, string) {
+	msg := strings.TrimSpace(body)
+	switch {
+	case strings.HasPrefix(msg, "Updated "):
+		return MsgUpdated, msg
+	case strings.HasPrefix(msg, "No IP change detected"), strings.Contains(msg, "has not changed"):
+		return MsgNoChange, msg
+	case strings.HasPrefix(msg, "ERROR:"):
+		return MsgError, strings.TrimSpace(strings.TrimPrefix(msg, "ERROR:"))
+	}
+	return MsgUnknown, msg
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package freedns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+const (
+	replyUpdated  = "Updated 1 host(s) test.example.com to 192.168.1.1 in 0.198 seconds\n"
+	replyNoChange = "No IP change detected for test.example.com with IP 10.0.0.1, skipping update\n"
+	replyV1NoChg  = "ERROR: Address 10.0.0.1 has not changed.\n"
+	replyNotFound = "ERROR: Unable to locate this record (changed password recently? deleted and re-created this dns entry?) (double check username/password are correct)\n"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty token")
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+func TestInterpretResponse(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		body string
+		code ReturnCode
+		msg  string
+	}{
+		"updated":   {replyUpdated, MsgUpdated, strings.TrimSpace(replyUpdated)},
+		"no_change": {replyNoChange, MsgNoChange, strings.TrimSpace(replyNoChange)},
+		"v1_nochg":  {replyV1NoChg, MsgNoChange, strings.TrimSpace(replyV1NoChg)},
+		"not_found": {replyNotFound, MsgError, "Unable to locate this record (changed password recently? deleted and re-created this dns entry?) (double check username/password are correct)"},
+		"dyndns":    {"good 192.168.1.1", MsgUnknown, "good 192.168.1.1"},
+		"empty":     {"", MsgUnknown, ""},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			code, msg := interpretResponse(tt.body)
+			if code != tt.code || msg != tt.msg {
+				t.Fatalf("Expected (%d, %q), got (%d, %q)", tt.code, tt.msg, code, msg)
+			}
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		ip       string
+		token    string
+		errorMsg string
+	}{
+		"updated":   {"192.168.1.1", "tok3n", ""},
+		"no_change": {"10.0.0.1", "tok3n", ""},
+		"ipv6":      {"2001:db8::1", "tok3n", ""},
+		"bad_token": {"192.168.1.1", "wrong", "Unable to locate this record"},
+		"unknown":   {"192.168.1.2", "tok3n", "unknown reply message"},
+		"status":    {"192.168.1.3", "tok3n", "returned 503"},
+		"missingip": {"", "tok3n", "ip address is missing"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/u/tok3n/" {
+			w.Write([]byte(replyNotFound))
+			return
+		}
+		switch ip := r.URL.Query().Get("myip"); ip {
+		case "10.0.0.1":
+			w.Write([]byte(replyNoChange))
+		case "192.168.1.2":
+			w.Write([]byte("maintenance"))
+		case "192.168.1.3":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("Updated 1 host(s) test.example.com to " + ip + " in 0.198 seconds\n"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update("test.example.com", tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gandi implements a DNSManager for the Gandi LiveDNS service using
+// the v5 API specified at https://api.gandi.net/docs/livedns/ .
+package gandi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://api.gandi.net/v5/livedns"
+	defaultUserAgent = "ddflare-gandi-"
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type rrset struct {
+	TTL    int      `json:"rrset_ttl,omitempty"`
+	Values []string `json:"rrset_values"`
+}
+
+// NewWithEndpoint initializes a new Gandi LiveDNS client which uses 'endpoint'
+// as API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the Gandi Personal
+// Access Token passed as parameter.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize Gandi client: missing token")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		return err
+	}
+	api.ErrorMessage = errorMessage
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: the A and
+// AAAA RRsets are replaced with all the addresses of the matching family,
+// keeping the TTL of the existing RRsets.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[rrset], error) {
+	if c.API == nil {
+		return restapi.Records[rrset]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	domain, err := c.getDomain(fqdn)
+	if err != nil {
+		return restapi.Records[rrset]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, domain)
+	if name == "" {
+		name = "@"
+	}
+	log.Debug("DNS zone found", "zone", domain)
+
+	path := "/domains/" + domain + "/records/" + name + "/"
+	return restapi.Records[rrset]{
+		Find: func(rType string) ([]rrset, error) {
+			var current rrset
+			if err := c.Do("GET", path+rType, nil, &current); err != nil {
+				if restapi.IsNotFound(err) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			log.Debug("RRset found", "type", rType, "data", current)
+			return []rrset{current}, nil
+		},
+		Update: func(rType string, found []rrset, addrs []string) error {
+			want := rrset{Values: addrs}
+			if len(found) > 0 {
+				want.TTL = found[0].TTL
+			}
+			if err := c.Do("PUT", path+rType, want, nil); err != nil {
+				return err
+			}
+			log.Debug("RRset updated", "type", rType, "data", want)
+			return nil
+		},
+		Addresses: func(r rrset) []string { return r.Values },
+		Zone:      domain,
+	}, nil
+}
+
+// getDomain returns the Gandi LiveDNS domain hosting `fqdn`.
+func (c *Client) getDomain(fqdn string) (string, error) {
+	return net.LookupZone(fqdn, func(name string) (bool, error) {
+		return restapi.Exists(c.Do("GET", "/domains/"+name, nil, nil))
+	})
+}
+
+// errorMessage extracts the error message from the Gandi API error reply,
+// prefixed by its cause.
+func errorMessage(body []byte) string {
+	var reply struct {
+		Message string `json:"message"`
+		Cause   string `json:"cause"`
+	}
+	if json.Unmarshal(body, &reply) != nil || reply.Message == "" || reply.Cause == "" {
+		return ""
+	}
+	return reply.Cause + ": " + reply.Message
+}
@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gandi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty token")
+	}
+}
+
+func TestClient_UpdateUninitialized(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+type request struct {
+	path string
+	set  rrset
+}
+
+// newGandiStub returns a fake Gandi LiveDNS API server hosting the
+// "example.com" domain, which contains an A RRset with TTL 600 for
+// "test.example.com".
+func newGandiStub(t *testing.T, reqs *[]request) *httptest.Server {
+	auth := restapitest.Auth{Header: "Authorization", Value: "Bearer secret", Status: http.StatusForbidden,
+		Reply: `{"code": 403, "message": "Access was denied to this resource.", "object": "HTTPForbidden", "cause": "Forbidden"}`}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, set *rrset) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/domains/example.com":
+			w.Write([]byte(`{"fqdn": "example.com"}`))
+		case r.Method == "GET" && r.URL.Path == "/domains/example.com/records/test/A":
+			w.Write([]byte(`{"rrset_name": "test", "rrset_type": "A", "rrset_ttl": 600, "rrset_values": ["10.0.0.1"]}`))
+		case r.Method == "GET":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": 404, "message": "Can't find the DNS record", "object": "dns-record", "cause": "Not Found"}`))
+		case r.Method == "PUT":
+			*reqs = append(*reqs, request{r.URL.Path, *set})
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"message": "DNS Record Created"}`))
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		token    string
+		expected []request
+		errorMsg string
+	}{
+		"keep_ttl": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			expected: []request{{"/domains/example.com/records/test/A", rrset{TTL: 600, Values: []string{"192.168.1.1"}}}},
+		},
+		"multiple_values": {
+			fqdn:  "test.example.com",
+			ip:    "192.168.1.1,2001:db8::1,192.168.1.2",
+			token: "secret",
+			expected: []request{
+				{"/domains/example.com/records/test/A", rrset{TTL: 600, Values: []string{"192.168.1.1", "192.168.1.2"}}},
+				{"/domains/example.com/records/test/AAAA", rrset{Values: []string{"2001:db8::1"}}},
+			},
+		},
+		"apex": {
+			fqdn:     "example.com.",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			expected: []request{{"/domains/example.com/records/@/A", rrset{Values: []string{"192.168.1.1"}}}},
+		},
+		"unknown_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "no zone found",
+		},
+		"bad_token": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "wrong",
+			errorMsg: "Forbidden: Access was denied",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var reqs []request
+			server := newGandiStub(t, &reqs)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(reqs) != 0 {
+					t.Fatalf("Expected no updates, got %v", reqs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.EqualFunc(reqs, tt.expected, func(a, b request) bool {
+				return a.path == b.path && a.set.TTL == b.set.TTL && slices.Equal(a.set.Values, b.set.Values)
+			}) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, reqs)
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var reqs []request
+			server := newGandiStub(t, &reqs)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(reqs) != 0 {
+				t.Errorf("Expected no updates, got %+v", reqs)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcloud
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/restapi"
+)
+
+const (
+	scope           = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+	defaultMetaHost = "metadata.google.internal"
+	// metaHostEnv is the environment variable used by the Google Cloud
+	// libraries to override the metadata server address.
+	metaHostEnv = "GCE_METADATA_HOST"
+	// expiryDelta is how early the access token is refreshed before its
+	// expiration.
+	expiryDelta = time.Minute
+)
+
+// serviceAccount tracks the fields of a service account JSON key used to
+// obtain access tokens.
+type serviceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+type tokenReply struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// parseServiceAccount parses a service account JSON key.
+func parseServiceAccount(data []byte) (*serviceAccount, error) {
+	sa := &serviceAccount{}
+	if err := json.Unmarshal(data, sa); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	if sa.Type != "service_account" {
+		return nil, fmt.Errorf("invalid service account key: unsupported type %q", sa.Type)
+	}
+	if sa.ClientEmail == "" || sa.TokenURI == "" {
+		return nil, errors.New("invalid service account key: missing client_email or token_uri")
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid service account key: cannot decode private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("invalid service account key: %w", err)
+		}
+	}
+	var ok bool
+	if sa.key, ok = key.(*rsa.PrivateKey); !ok {
+		return nil, errors.New("invalid service account key: not an RSA key")
+	}
+	return sa, nil
+}
+
+// assertion returns the signed JWT used to request an access token for the
+// service account.
+func (sa *serviceAccount) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": sa.PrivateKeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   sa.ClientEmail,
+		"scope": scope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("cannot sign JWT: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// accessToken returns a valid access token, requesting a new one when the
+// cached one is missing or expiring.
+func (c *Client) accessToken() (string, error) {
+	if c.token != "" && time.Now().Add(expiryDelta).Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	var (
+		req *http.Request
+		err error
+	)
+	if c.sa != nil {
+		var jwt string
+		if jwt, err = c.sa.assertion(time.Now()); err != nil {
+			return "", err
+		}
+		form := url.Values{}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", jwt)
+		if req, err = http.NewRequest("POST", c.sa.TokenURI, strings.NewReader(form.Encode())); err != nil {
+			return "", err
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		if req, err = http.NewRequest("GET", c.metadataURL("instance/service-accounts/default/token"), nil); err != nil {
+			return "", err
+		}
+		req.Header.Add("Metadata-Flavor", "Google")
+	}
+
+	var data []byte
+	if data, err = doRequest(req); err != nil {
+		return "", fmt.Errorf("cannot retrieve access token: %w", err)
+	}
+	var reply tokenReply
+	if err = json.Unmarshal(data, &reply); err != nil || reply.AccessToken == "" {
+		return "", fmt.Errorf("cannot retrieve access token: invalid reply from %s", req.URL.Host)
+	}
+
+	c.token = reply.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(reply.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// metadataProject returns the project id from the metadata server.
+func (c *Client) metadataProject() (string, error) {
+	req, err := http.NewRequest("GET", c.metadataURL("project/project-id"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Metadata-Flavor", "Google")
+	data, err := doRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot retrieve project id: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (c *Client) metadataURL(path string) string {
+	host := c.metaHost
+	if host == "" {
+		if host = os.Getenv(metaHostEnv); host == "" {
+			host = defaultMetaHost
+		}
+	}
+	return "http://" + host + "/computeMetadata/v1/" + path
+}
+
+// doRequest sends `req` and returns the reply body, or an error if the
+// request failed or did not return a 2xx status code.
+func doRequest(req *http.Request) ([]byte, error) {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("connection to %s failed: %w", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %q reply: %w", req.URL.Host, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg := errorMessage(data)
+		if msg == "" {
+			msg = res.Status
+		}
+		return data, &restapi.Error{Status: res.StatusCode, Message: msg, Body: data}
+	}
+	return data, nil
+}
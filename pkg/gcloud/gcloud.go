@@ -0,0 +1,348 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gcloud implements a DNSManager for Google Cloud DNS using the v1
+// REST API specified at https://cloud.google.com/dns/docs/reference/rest/v1 .
+//
+// Requests are authenticated with a service account JSON key or, when
+// running on Google Cloud, with the credentials of the instance service
+// account retrieved from the metadata server.
+package gcloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager   = (*Client)(nil)
+	_ ddman.Configurable = (*Client)(nil)
+	_ ddman.Planner      = (*Client)(nil)
+)
+
+const (
+	// MetadataAuth is the auth string to pass to Init() to use the metadata
+	// server credentials.
+	MetadataAuth = "metadata"
+
+	defaultAPIEP     = "https://dns.googleapis.com/dns/v1"
+	defaultUserAgent = "ddflare-gcloud-"
+	defaultTTL       = 300
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	project   string
+	// metaHost overrides the metadata server address
+	metaHost string
+	// sa is nil when the metadata server credentials are used
+	sa          *serviceAccount
+	token       string
+	tokenExpiry time.Time
+	*restapi.API
+}
+
+type managedZone struct {
+	Name       string `json:"name"`
+	DNSName    string `json:"dnsName"`
+	Visibility string `json:"visibility"`
+}
+
+type rrset struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Rrdatas []string `json:"rrdatas"`
+}
+
+type change struct {
+	Additions []rrset `json:"additions,omitempty"`
+	Deletions []rrset `json:"deletions,omitempty"`
+	ID        string  `json:"id,omitempty"`
+	Status    string  `json:"status,omitempty"`
+}
+
+// NewWithEndpoint initializes a new Cloud DNS client which uses 'endpoint'
+// as API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// SetOption sets the Cloud DNS specific options. The only option supported
+// is "project", the project id hosting the managed zones: when not set, the
+// project of the service account or the one reported by the metadata server
+// is used.
+func (c *Client) SetOption(key, value string) error {
+	switch key {
+	case "project":
+		if value == "" {
+			return fmt.Errorf("invalid empty %q option", key)
+		}
+		c.project = value
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Init sets up the credentials used to authenticate the requests: `auth`
+// is either the content of or the path to a service account JSON key, or
+// MetadataAuth to use the credentials of the instance service account.
+func (c *Client) Init(auth string) error {
+	var (
+		data []byte
+		err  error
+	)
+	c.token = ""
+	switch {
+	case auth == "":
+		return fmt.Errorf("cannot initialize Cloud DNS client: missing credentials")
+	case auth == MetadataAuth:
+		c.sa = nil
+	case strings.HasPrefix(strings.TrimSpace(auth), "{"):
+		data = []byte(auth)
+	default:
+		if data, err = os.ReadFile(auth); err != nil {
+			return fmt.Errorf("cannot read service account key: %w", err)
+		}
+	}
+	if data != nil {
+		if c.sa, err = parseServiceAccount(data); err != nil {
+			return err
+		}
+	}
+
+	api, err := restapi.New(c.endpoint, c.userAgent, nil)
+	if err != nil {
+		return err
+	}
+	api.ErrorMessage = errorMessage
+	api.Authorize = c.authorize
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: the old A
+// and AAAA RRsets are deleted and the new ones added in a single atomic
+// change, keeping their TTL.
+func (c *Client) Update(fqdn, ip string) error {
+	var chg change
+	recs, zonePath, err := c.records(fqdn, &chg)
+	if err != nil {
+		return err
+	}
+	if err = recs.Upsert(ip); err != nil {
+		return err
+	}
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+	if len(chg.Additions) == 0 {
+		log.Debug("RRsets already up to date")
+		return nil
+	}
+
+	if err = c.Do("POST", zonePath+"/changes", chg, &chg); err != nil {
+		return fmt.Errorf("RRsets update failed: %w", err)
+	}
+	log.Debug("RRsets change submitted", "id", chg.ID, "status", chg.Status, "additions", chg.Additions)
+
+	return nil
+}
+
+// Plan looks up the managed zone and the RRsets of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the RRsets.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, _, err := c.records(fqdn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the managed zone of `fqdn` and returns its A and AAAA
+// RRsets and the API path of the zone: their updates are added to `chg`.
+func (c *Client) records(fqdn string, chg *change) (restapi.Records[rrset], string, error) {
+	if c.API == nil {
+		return restapi.Records[rrset]{}, "", fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".") + "."
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	project, err := c.getProject()
+	if err != nil {
+		return restapi.Records[rrset]{}, "", err
+	}
+	zone, err := c.getManagedZone(project, fqdn)
+	if err != nil {
+		return restapi.Records[rrset]{}, "", fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	log.Debug("DNS zone found", "project", project, "zone", zone.Name, "dnsName", zone.DNSName)
+
+	zonePath := "/projects/" + url.PathEscape(project) + "/managedZones/" + url.PathEscape(zone.Name)
+	var current struct {
+		RRsets []rrset `json:"rrsets"`
+	}
+	if err = c.Do("GET", zonePath+"/rrsets?name="+url.QueryEscape(fqdn), nil, &current); err != nil {
+		return restapi.Records[rrset]{}, "", fmt.Errorf("cannot retrieve RRsets: %w", err)
+	}
+
+	return restapi.Records[rrset]{
+		Find: func(rType string) ([]rrset, error) {
+			var found []rrset
+			for _, rs := range current.RRsets {
+				if rs.Name == fqdn && rs.Type == rType {
+					log.Debug("RRset found", "data", rs)
+					found = append(found, rs)
+				}
+			}
+			return found, nil
+		},
+		Update: func(rType string, found []rrset, addrs []string) error {
+			add := rrset{Name: fqdn, Type: rType, TTL: defaultTTL, Rrdatas: addrs}
+			if len(found) > 0 {
+				old := found[0]
+				if slices.Equal(old.Rrdatas, addrs) {
+					return nil
+				}
+				add.TTL = old.TTL
+				chg.Deletions = append(chg.Deletions, old)
+			}
+			chg.Additions = append(chg.Additions, add)
+			return nil
+		},
+		Addresses: func(rs rrset) []string { return rs.Rrdatas },
+		Zone:      strings.TrimSuffix(zone.DNSName, "."),
+	}, zonePath, nil
+}
+
+// getProject returns the project hosting the managed zones.
+func (c *Client) getProject() (string, error) {
+	if c.project != "" {
+		return c.project, nil
+	}
+	if c.sa != nil && c.sa.ProjectID != "" {
+		return c.sa.ProjectID, nil
+	}
+	if c.sa != nil {
+		return "", fmt.Errorf("no project found: set the \"project\" option")
+	}
+	project, err := c.metadataProject()
+	if err != nil {
+		return "", err
+	}
+	c.project = project
+	return project, nil
+}
+
+// getManagedZone returns the public managed zone hosting `fqdn`.
+func (c *Client) getManagedZone(project, fqdn string) (*managedZone, error) {
+	var found *managedZone
+	_, err := net.LookupZone(fqdn, func(name string) (bool, error) {
+		var zones struct {
+			ManagedZones []managedZone `json:"managedZones"`
+		}
+		path := "/projects/" + url.PathEscape(project) + "/managedZones?dnsName=" + url.QueryEscape(name+".")
+		if err := c.Do("GET", path, nil, &zones); err != nil {
+			return false, err
+		}
+		for i, z := range zones.ManagedZones {
+			if z.DNSName == name+"." && z.Visibility != "private" {
+				found = &zones.ManagedZones[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return found, err
+}
+
+// authorize adds the access token to the API requests.
+func (c *Client) authorize(req *http.Request, _ []byte) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// errorMessage extracts the error message from the Cloud DNS API and the
+// OAuth2 token endpoint error replies.
+func errorMessage(body []byte) string {
+	var reply struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if json.Unmarshal(body, &reply) != nil {
+		return ""
+	}
+	if reply.Error.Message != "" {
+		return reply.Error.Message
+	}
+	return reply.Description
+}
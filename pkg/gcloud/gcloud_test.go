@@ -0,0 +1,430 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcloud
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.SetOption("zone", "example"); err == nil {
+		t.Error("Expected SetOption failure with an unknown option")
+	}
+}
+
+func TestClient_UpdateUninitialized(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+// newServiceAccountKey returns a new RSA key and the JSON service account key
+// embedding it, using 'tokenURI' as token endpoint.
+func newServiceAccountKey(t *testing.T, tokenURI string) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate RSA key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal RSA key: %v", err)
+	}
+	sa, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "sa-project",
+		"private_key_id": "key1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "ddflare@sa-project.iam.gserviceaccount.com",
+		"token_uri":      tokenURI,
+	})
+	return key, string(sa)
+}
+
+func TestClient_Init(t *testing.T) {
+	t.Parallel()
+
+	_, sa := newServiceAccountKey(t, "https://oauth2.googleapis.com/token")
+	saFile := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(saFile, []byte(sa), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		auth     string
+		metadata bool
+		fails    bool
+	}{
+		"empty":       {"", false, true},
+		"metadata":    {MetadataAuth, true, false},
+		"json":        {sa, false, false},
+		"file":        {saFile, false, false},
+		"missingfile": {filepath.Join(t.TempDir(), "missing.json"), false, true},
+		"bad_type":    {`{"type": "authorized_user"}`, false, true},
+		"bad_key":     {`{"type": "service_account", "client_email": "a@b", "token_uri": "u", "private_key": "x"}`, false, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := New()
+			err := client.Init(tt.auth)
+			if tt.fails {
+				if err == nil {
+					t.Fatal("expected failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected failure: %v", err)
+			}
+			if tt.metadata != (client.sa == nil) {
+				t.Fatalf("expected metadata credentials %v, got service account %+v", tt.metadata, client.sa)
+			}
+		})
+	}
+}
+
+type cloudDNSStub struct {
+	*httptest.Server
+	t       *testing.T
+	key     *rsa.PublicKey
+	changes []change
+	tokens  int
+}
+
+// newCloudDNSStub returns a fake Cloud DNS server, which also acts as token
+// endpoint and metadata server. The "sa-project" and "meta-project" projects
+// host the public "example-com" managed zone for "example.com.", which
+// contains an A RRset with TTL 60 for "test.example.com.": a private zone
+// with the same name is present too.
+func newCloudDNSStub(t *testing.T) *cloudDNSStub {
+	stub := &cloudDNSStub{t: t}
+	stub.Server = httptest.NewServer(http.HandlerFunc(stub.serveHTTP))
+	return stub
+}
+
+func (s *cloudDNSStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	t := s.t
+	switch {
+	case r.URL.Path == "/token":
+		if err := s.verifyAssertion(r.FormValue("assertion")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "Invalid JWT Signature."}`))
+			return
+		}
+		s.tokens++
+		w.Write([]byte(`{"access_token": "secret", "expires_in": 3599, "token_type": "Bearer"}`))
+		return
+	case strings.HasPrefix(r.URL.Path, "/computeMetadata/v1/"):
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/computeMetadata/v1/") {
+		case "project/project-id":
+			w.Write([]byte("meta-project"))
+		case "instance/service-accounts/default/token":
+			s.tokens++
+			w.Write([]byte(`{"access_token": "secret", "expires_in": 3599, "token_type": "Bearer"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"code": 401, "message": "Request had invalid authentication credentials."}}`))
+		return
+	}
+	path := r.URL.Path
+	for _, p := range []string{"/projects/sa-project", "/projects/meta-project"} {
+		path = strings.TrimPrefix(path, p)
+	}
+	switch {
+	case strings.HasPrefix(path, "/projects/"):
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"code": 403, "message": "The caller does not have permission"}}`))
+	case r.Method == "GET" && path == "/managedZones":
+		if r.URL.Query().Get("dnsName") == "example.com." {
+			w.Write([]byte(`{"managedZones": [
+				{"name": "example-com-internal", "dnsName": "example.com.", "visibility": "private"},
+				{"name": "example-com", "dnsName": "example.com.", "visibility": "public"}
+			]}`))
+			return
+		}
+		w.Write([]byte(`{"managedZones": []}`))
+	case r.Method == "GET" && path == "/managedZones/example-com/rrsets":
+		if r.URL.Query().Get("name") == "test.example.com." {
+			w.Write([]byte(`{"rrsets": [{"name": "test.example.com.", "type": "A", "ttl": 60, "rrdatas": ["10.0.0.1"]}]}`))
+			return
+		}
+		w.Write([]byte(`{"rrsets": []}`))
+	case r.Method == "POST" && path == "/managedZones/example-com/changes":
+		var chg change
+		if err := json.NewDecoder(r.Body).Decode(&chg); err != nil {
+			t.Errorf("cannot decode change: %v", err)
+		}
+		s.changes = append(s.changes, chg)
+		chg.ID, chg.Status = "1", "pending"
+		json.NewEncoder(w).Encode(chg)
+	default:
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// verifyAssertion checks the JWT signature and claims.
+func (s *cloudDNSStub) verifyAssertion(jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return os.ErrInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(s.key, crypto.SHA256, hash[:], sig); err != nil {
+		return err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims map[string]any
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	if claims["scope"] != scope || claims["aud"] != s.URL+"/token" {
+		return os.ErrInvalid
+	}
+	return nil
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		metadata bool
+		project  string
+		expected *change
+		errorMsg string
+	}{
+		"service_account": {
+			fqdn: "test.example.com",
+			ip:   "192.168.1.1",
+			expected: &change{
+				Deletions: []rrset{{Name: "test.example.com.", Type: "A", TTL: 60, Rrdatas: []string{"10.0.0.1"}}},
+				Additions: []rrset{{Name: "test.example.com.", Type: "A", TTL: 60, Rrdatas: []string{"192.168.1.1"}}},
+			},
+		},
+		"metadata": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1,2001:db8::1",
+			metadata: true,
+			expected: &change{
+				Deletions: []rrset{{Name: "test.example.com.", Type: "A", TTL: 60, Rrdatas: []string{"10.0.0.1"}}},
+				Additions: []rrset{
+					{Name: "test.example.com.", Type: "A", TTL: 60, Rrdatas: []string{"192.168.1.1"}},
+					{Name: "test.example.com.", Type: "AAAA", TTL: defaultTTL, Rrdatas: []string{"2001:db8::1"}},
+				},
+			},
+		},
+		"new_rrset": {
+			fqdn:    "new.example.com",
+			ip:      "192.168.1.1",
+			project: "meta-project",
+			expected: &change{
+				Additions: []rrset{{Name: "new.example.com.", Type: "A", TTL: defaultTTL, Rrdatas: []string{"192.168.1.1"}}},
+			},
+		},
+		"unchanged": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+		"unknown_project": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			project:  "other-project",
+			errorMsg: "does not have permission",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := newCloudDNSStub(t)
+			defer stub.Close()
+			client := NewWithEndpoint(stub.URL)
+			client.metaHost = strings.TrimPrefix(stub.URL, "http://")
+			auth := MetadataAuth
+			if !tt.metadata {
+				var key *rsa.PrivateKey
+				key, auth = newServiceAccountKey(t, stub.URL+"/token")
+				stub.key = &key.PublicKey
+			}
+			if err := client.Init(auth); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			if tt.project != "" {
+				if err := client.SetOption("project", tt.project); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(stub.changes) != 0 {
+					t.Fatalf("Expected no changes, got %+v", stub.changes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stub.tokens != 1 {
+				t.Errorf("Expected a single access token request, got %d", stub.tokens)
+			}
+			if tt.expected == nil {
+				if len(stub.changes) != 0 {
+					t.Fatalf("Expected no changes, got %+v", stub.changes)
+				}
+				return
+			}
+			if len(stub.changes) != 1 {
+				t.Fatalf("Expected a single change, got %+v", stub.changes)
+			}
+			equal := func(a, b rrset) bool {
+				return a.Name == b.Name && a.Type == b.Type && a.TTL == b.TTL && slices.Equal(a.Rrdatas, b.Rrdatas)
+			}
+			if got := stub.changes[0]; !slices.EqualFunc(got.Additions, tt.expected.Additions, equal) ||
+				!slices.EqualFunc(got.Deletions, tt.expected.Deletions, equal) {
+				t.Fatalf("Expected change %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := newCloudDNSStub(t)
+			defer stub.Close()
+			client := NewWithEndpoint(stub.URL)
+			client.metaHost = strings.TrimPrefix(stub.URL, "http://")
+			if err := client.Init(MetadataAuth); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(stub.changes) != 0 {
+				t.Errorf("Expected no updates, got %+v", stub.changes)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
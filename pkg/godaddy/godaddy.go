@@ -0,0 +1,241 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package godaddy implements a DNSManager for the GoDaddy DNS using the
+// domains API specified at https://developer.godaddy.com/doc/endpoint/domains .
+package godaddy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://api.godaddy.com"
+	defaultUserAgent = "ddflare-godaddy-"
+	defaultTTL       = 3600
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type record struct {
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+// NewWithEndpoint initializes a new GoDaddy client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the API key and secret
+// passed in the "key:secret" form.
+func (c *Client) Init(auth string) error {
+	key, secret, _ := strings.Cut(auth, ":")
+	if key == "" || secret == "" {
+		return fmt.Errorf("cannot initialize GoDaddy client: 'key:secret' credentials expected")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"Authorization": {"sso-key " + auth}})
+	if err != nil {
+		return err
+	}
+	api.ErrorMessage = errorMessage
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: the A and
+// AAAA records are replaced with all the addresses of the matching family,
+// keeping their TTL. Requests rejected by GoDaddy as invalid are reported
+// with a *ddman.ValidationError.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	domain, err := c.getDomain(fqdn)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, domain)
+	if name == "" {
+		name = "@"
+	}
+	log.Debug("DNS zone found", "zone", domain, "name", name)
+
+	path := "/v1/domains/" + url.PathEscape(domain) + "/records/"
+	return restapi.Records[record]{
+		Find: func(rType string) ([]record, error) {
+			var current []record
+			if err := c.do("GET", path+rType+"/"+url.PathEscape(name), nil, &current); err != nil {
+				return nil, err
+			}
+			for _, r := range current {
+				log.Debug("record found", "type", rType, "data", r)
+			}
+			return current, nil
+		},
+		Update: func(rType string, found []record, addrs []string) error {
+			ttl := defaultTTL
+			for _, r := range found {
+				ttl = r.TTL
+			}
+			var want []record
+			for _, a := range addrs {
+				want = append(want, record{Data: a, TTL: ttl})
+			}
+			if err := c.do("PUT", path+rType+"/"+url.PathEscape(name), want, nil); err != nil {
+				return err
+			}
+			log.Debug("record updated", "type", rType, "data", want)
+			return nil
+		},
+		Addresses: func(r record) []string { return []string{r.Data} },
+		Zone:      domain,
+	}, nil
+}
+
+// getDomain returns the GoDaddy domain hosting `fqdn`.
+func (c *Client) getDomain(fqdn string) (string, error) {
+	return net.LookupZone(fqdn, func(name string) (bool, error) {
+		return restapi.Exists(c.do("GET", "/v1/domains/"+url.PathEscape(name), nil, nil))
+	})
+}
+
+// errorReply tracks the GoDaddy API error reply.
+type errorReply struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Fields  []struct {
+		Path    string `json:"path"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"fields"`
+}
+
+// errorMessage extracts the error code and message from the GoDaddy API
+// error reply.
+func errorMessage(body []byte) string {
+	var reply errorReply
+	if json.Unmarshal(body, &reply) != nil || reply.Message == "" || reply.Code == "" {
+		return ""
+	}
+	return reply.Code + ": " + reply.Message
+}
+
+// do sends the request to the `path` API (see restapi.API.Do()), converting
+// the validation errors (see parseError()).
+func (c *Client) do(method, path string, in, out any) error {
+	return parseError(c.Do(method, path, in, out))
+}
+
+// parseError converts the 422 (Unprocessable Entity) API error replies to a
+// *ddman.ValidationError: other errors are returned unchanged.
+func parseError(err error) error {
+	var apiErr *restapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity {
+		return err
+	}
+
+	var reply errorReply
+	if json.Unmarshal(apiErr.Body, &reply) != nil || reply.Message == "" {
+		reply.Message = apiErr.Message
+	}
+	vErr := &ddman.ValidationError{Code: reply.Code, Message: reply.Message}
+	for _, f := range reply.Fields {
+		vErr.Fields = append(vErr.Fields, ddman.FieldError{Path: f.Path, Code: f.Code, Message: f.Message})
+	}
+	return vErr
+}
@@ -0,0 +1,344 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package godaddy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	for _, auth := range []string{"", "key", "key:", ":secret"} {
+		if err := client.Init(auth); err == nil {
+			t.Errorf("Expected Init failure with auth %q", auth)
+		}
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	t.Parallel()
+
+	err := parseError(&restapi.Error{Status: http.StatusUnprocessableEntity, Message: "INVALID_BODY: Request body doesn't fulfill schema",
+		Body: []byte(`{"code": "INVALID_BODY", "message": "Request body doesn't fulfill schema, see details in ` + "`fields`" + `",
+		"fields": [{"code": "UNEXPECTED_TYPE", "message": "is not a ipv4", "path": "records[0].data"}]}`)})
+	if !errors.Is(err, ddman.ErrValidation) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	var vErr *ddman.ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("Expected a *ddman.ValidationError, got %T", err)
+	}
+	expected := []ddman.FieldError{{Path: "records[0].data", Code: "UNEXPECTED_TYPE", Message: "is not a ipv4"}}
+	if vErr.Code != "INVALID_BODY" || !reflect.DeepEqual(vErr.Fields, expected) {
+		t.Fatalf("Unexpected validation error content: %+v", vErr)
+	}
+	if !strings.Contains(err.Error(), "records[0].data: is not a ipv4") {
+		t.Errorf("Expected field details in error message, got %q", err.Error())
+	}
+
+	err = parseError(&restapi.Error{Status: http.StatusUnprocessableEntity, Message: "422 Unprocessable Entity", Body: []byte(`<html></html>`)})
+	if !errors.As(err, &vErr) || vErr.Message != "422 Unprocessable Entity" {
+		t.Errorf("Expected a validation error with status message, got %v", err)
+	}
+
+	err = parseError(&restapi.Error{Status: http.StatusUnauthorized, Message: "401 Unauthorized"})
+	if errors.Is(err, ddman.ErrValidation) {
+		t.Errorf("Expected a generic API error, got %v", err)
+	}
+	msg := errorMessage([]byte(`{"code": "UNABLE_TO_AUTHENTICATE", "message": "Unauthorized : Could not authenticate API key/secret"}`))
+	if !strings.HasPrefix(msg, "UNABLE_TO_AUTHENTICATE: ") {
+		t.Errorf("Expected the error code in the message, got %q", msg)
+	}
+}
+
+type request struct {
+	path    string
+	records []record
+}
+
+func TestGetDomain(t *testing.T) {
+	t.Parallel()
+
+	zones := map[string]bool{"example.com": true, "sub.example.com": true, "example.co.uk": true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.EscapedPath(), "/v1/domains/")
+		switch {
+		case name == "fail.example.com":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"code": "ACCESS_DENIED", "message": "lookup failure"}`))
+		case zones[name]:
+			w.Write([]byte(`{"domain": "` + name + `", "status": "ACTIVE"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": "NOT_FOUND", "message": "The given domain is not registered, or does not have a zone file"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewWithEndpoint(server.URL)
+	if err := client.Init("key:secret"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+
+	tests := map[string]struct {
+		fqdn     string
+		zone     string
+		errorMsg string
+	}{
+		"subdomain":      {"sub.example.com", "sub.example.com", ""},
+		"domain":         {"example.com", "example.com", ""},
+		"trailing_dot":   {"test.example.com.", "example.com", ""},
+		"deep_subdomain": {"a.b.sub.example.com", "sub.example.com", ""},
+		"co_uk_domain":   {"test.example.co.uk", "example.co.uk", ""},
+		"missing":        {"test.example.org", "", "no zone found"},
+		"single_word":    {"localhost", "", "no zone found"},
+		"empty":          {"", "", "no zone found"},
+		"failure":        {"a.fail.example.com", "", "lookup failure"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			zone, err := client.getDomain(tt.fqdn)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q for FQDN %q, got zone %q (%v)", tt.errorMsg, tt.fqdn, zone, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error for FQDN %q: %v", tt.fqdn, err)
+			}
+			if zone != tt.zone {
+				t.Errorf("Expected zone %q for FQDN %q, got %q", tt.zone, tt.fqdn, zone)
+			}
+		})
+	}
+}
+
+// newGoDaddyStub returns a fake GoDaddy API endpoint. The account owns the
+// "example.com" domain, which has an A record with TTL 600 for "test".
+// Updates with the "192.0.2.0" address are rejected as invalid.
+func newGoDaddyStub(t *testing.T, puts *[]request) *httptest.Server {
+	auth := restapitest.Auth{Header: "Authorization", Value: "sso-key key:secret",
+		Reply: `{"code": "UNABLE_TO_AUTHENTICATE", "message": "Unauthorized : Could not authenticate API key/secret"}`}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, recs *[]record) {
+		path := r.URL.EscapedPath()
+		switch {
+		case r.Method == "GET" && path == "/v1/domains/example.com":
+			w.Write([]byte(`{"domain": "example.com", "status": "ACTIVE"}`))
+		case r.Method == "GET" && path == "/v1/domains/example.com/records/A/test":
+			w.Write([]byte(`[{"data": "10.0.0.1", "name": "test", "ttl": 600, "type": "A"}]`))
+		case r.Method == "GET" && strings.HasPrefix(path, "/v1/domains/example.com/records/"):
+			w.Write([]byte(`[]`))
+		case r.Method == "PUT" && strings.HasPrefix(path, "/v1/domains/example.com/records/"):
+			if len(*recs) > 0 && (*recs)[0].Data == "192.0.2.0" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte(`{"code": "INVALID_BODY", "message": "Request body doesn't fulfill schema",
+					"fields": [{"code": "INVALID_VALUE", "message": "reserved address", "path": "records[0].data"}]}`))
+				return
+			}
+			*puts = append(*puts, request{path, *recs})
+			w.Write([]byte(`{}`))
+		case r.Method == "GET" && strings.HasPrefix(path, "/v1/domains/"):
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": "NOT_FOUND", "message": "The given domain is not registered, or does not have a zone file"}`))
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn       string
+		ip         string
+		auth       string
+		expected   []request
+		errorMsg   string
+		validation bool
+	}{
+		"update": {
+			fqdn: "test.example.com",
+			ip:   "192.168.1.1",
+			auth: "key:secret",
+			expected: []request{
+				{"/v1/domains/example.com/records/A/test", []record{{"192.168.1.1", 600}}},
+			},
+		},
+		"dual_stack": {
+			fqdn: "a.b.example.com.",
+			ip:   "192.168.1.1,2001:db8::1,2001:db8::2",
+			auth: "key:secret",
+			expected: []request{
+				{"/v1/domains/example.com/records/A/a.b", []record{{"192.168.1.1", defaultTTL}}},
+				{"/v1/domains/example.com/records/AAAA/a.b", []record{{"2001:db8::1", defaultTTL}, {"2001:db8::2", defaultTTL}}},
+			},
+		},
+		"apex": {
+			fqdn: "example.com",
+			ip:   "192.168.1.1",
+			auth: "key:secret",
+			expected: []request{
+				{"/v1/domains/example.com/records/A/@", []record{{"192.168.1.1", defaultTTL}}},
+			},
+		},
+		"unknown_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			auth:     "key:secret",
+			errorMsg: "no zone found",
+		},
+		"bad_secret": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			auth:     "key:wrong",
+			errorMsg: "UNABLE_TO_AUTHENTICATE",
+		},
+		"validation": {
+			fqdn:       "test.example.com",
+			ip:         "192.0.2.0",
+			auth:       "key:secret",
+			errorMsg:   "reserved address",
+			validation: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var puts []request
+			server := newGoDaddyStub(t, &puts)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.auth); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if errors.Is(err, ddman.ErrValidation) != tt.validation {
+					t.Fatalf("Unexpected validation error match for %v", err)
+				}
+				if len(puts) != 0 {
+					t.Fatalf("Expected no updates, got %+v", puts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(puts, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, puts)
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var puts []request
+			server := newGoDaddyStub(t, &puts)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("key:secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(puts) != 0 {
+				t.Errorf("Expected no updates, got %+v", puts)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
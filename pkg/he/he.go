@@ -0,0 +1,125 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package he implements a DNSManager for the Hurricane Electric Free DNS
+// dynamic records, as specified at https://dns.he.net/docs.html .
+//
+// The service speaks the DynDNS update protocol, authenticating with the
+// FQDN as username and the per-host dynamic DNS key as password.
+package he
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/dyndnsapi"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager     = (*Client)(nil)
+	_ ddman.ContextUpdater = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://dyn.dns.he.net"
+	defaultUserAgent = "ddflare-he-"
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	key       string
+}
+
+// NewWithEndpoint initializes a new Hurricane Electric client which uses
+// 'endpoint' as API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// Init stores the dynamic DNS key generated for the host record.
+func (c *Client) Init(key string) error {
+	if key == "" {
+		return fmt.Errorf("cannot initialize Hurricane Electric client: missing dynamic DNS key")
+	}
+	c.key = key
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+func (c *Client) Update(fqdn, ip string) error {
+	return c.UpdateContext(context.Background(), fqdn, ip)
+}
+
+// UpdateContext is Update(), tracing the update request as a child of the
+// span in `ctx`.
+func (c *Client) UpdateContext(ctx context.Context, fqdn, ip string) error {
+	if c.key == "" {
+		return fmt.Errorf("not authorized")
+	}
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	api, err := dyndnsapi.New(c.endpoint, fqdn+":"+c.key, c.userAgent)
+	if err != nil {
+		return err
+	}
+	retCode, err := api.UpdateContext(ctx, fqdn, ip)
+	if err != nil {
+		return fmt.Errorf("he update failed: %w", err)
+	}
+	if retCode == dyndnsapi.MsgNoChg {
+		log.Warn("Hurricane Electric replied the FQDN was already set at the right IP", logging.IP, ip)
+	}
+	return nil
+}
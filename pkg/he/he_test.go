@@ -0,0 +1,107 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package he
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty key")
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		key      string
+		errorMsg string
+	}{
+		"good":      {"test.example.com", "192.168.1.1", "secret", ""},
+		"nochg":     {"test.example.com", "10.0.0.1", "secret", ""},
+		"dot":       {"test.example.com.", "192.168.1.1", "secret", ""},
+		"ipv6":      {"test.example.com", "2001:db8::1", "secret", ""},
+		"bad_key":   {"test.example.com", "192.168.1.1", "wrong", "bad username or password"},
+		"bad_host":  {"other.example.com", "192.168.1.1", "secret", "bad username or password"},
+		"not_fqdn":  {"localhost", "192.168.1.1", "secret", "invalid FQDN"},
+		"missingip": {"test.example.com", "", "secret", "ip address is missing"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("hostname") == "localhost" {
+			w.Write([]byte("notfqdn"))
+			return
+		}
+		user, pass, ok := r.BasicAuth()
+		if r.URL.Path != "/nic/update" || !ok || user != "test.example.com" || pass != "secret" || q.Get("hostname") != user {
+			w.Write([]byte("badauth"))
+			return
+		}
+		if q.Get("myip") == "10.0.0.1" {
+			w.Write([]byte("nochg 10.0.0.1"))
+			return
+		}
+		w.Write([]byte("good " + q.Get("myip")))
+	}))
+	t.Cleanup(server.Close)
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.key); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
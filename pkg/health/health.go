@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health tracks the outcome of the update cycles of a long running
+// process and exposes it via the HTTP liveness (/healthz), readiness
+// (/readyz) and status (/status) endpoints.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureThreshold is the default number of consecutive failed
+	// cycles making the process not ready.
+	DefaultFailureThreshold = 3
+	// minGrace is the minimum delay of a cycle after its scheduled time
+	// before the process is considered stuck.
+	minGrace = time.Minute
+)
+
+// RecordStatus is the outcome of the last update of a record on a provider.
+type RecordStatus struct {
+	FQDN        string    `json:"fqdn"`
+	Provider    string    `json:"provider"`
+	IP          string    `json:"ip,omitempty"`
+	LastResult  string    `json:"last_result"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+}
+
+// Status is the state of the update loop.
+type Status struct {
+	Started             time.Time      `json:"started"`
+	LastIP              string         `json:"last_ip,omitempty"`
+	LastCycle           time.Time      `json:"last_cycle,omitzero"`
+	NextRun             time.Time      `json:"next_run,omitzero"`
+	Cycles              int            `json:"cycles"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	Healthy             bool           `json:"healthy"`
+	Ready               bool           `json:"ready"`
+	Records             []RecordStatus `json:"records"`
+}
+
+// Tracker collects the outcome of the update cycles. It is safe for
+// concurrent use.
+type Tracker struct {
+	threshold int
+
+	mu       sync.Mutex
+	started  time.Time
+	lastIP   string
+	last     time.Time
+	next     time.Time
+	interval time.Duration
+	cycles   int
+	failures int
+	records  map[string]*RecordStatus
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewTracker returns a Tracker reporting the process as not ready after
+// `threshold` consecutive failed cycles (DefaultFailureThreshold if not
+// positive).
+func NewTracker(threshold int) *Tracker {
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	return &Tracker{
+		threshold: threshold,
+		started:   time.Now(),
+		records:   make(map[string]*RecordStatus),
+		now:       time.Now,
+	}
+}
+
+// RecordUpdate records the outcome of the update of `fqdn` to `ip` on the
+// `provider`.
+func (t *Tracker) RecordUpdate(fqdn, provider, ip string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := fqdn + "\xff" + provider
+	r, ok := t.records[key]
+	if !ok {
+		r = &RecordStatus{FQDN: fqdn, Provider: provider}
+		t.records[key] = r
+	}
+	r.LastAttempt = t.now()
+	if err != nil {
+		r.LastResult, r.LastError = "failure", err.Error()
+		return
+	}
+	r.LastResult, r.LastError = "success", ""
+	r.LastSuccess, r.IP = r.LastAttempt, ip
+}
+
+// CycleDone records the end of an update cycle setting `ip`, failed if `err`
+// is not nil. The next cycle is expected after `interval`: zero means no
+// cycle is scheduled.
+func (t *Tracker) CycleDone(ip string, err error, interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cycles++
+	t.last = t.now()
+	t.interval = interval
+	t.next = time.Time{}
+	if interval > 0 {
+		t.next = t.last.Add(interval)
+	}
+	if err != nil {
+		t.failures++
+		return
+	}
+	t.failures = 0
+	t.lastIP = ip
+}
+
+// Healthy returns an error if the update loop looks stuck, i.e., the next
+// cycle is late by more than its interval (at least a minute).
+func (t *Tracker) Healthy() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.healthy()
+}
+
+func (t *Tracker) healthy() error {
+	if t.next.IsZero() {
+		return nil
+	}
+	grace := max(t.interval, minGrace)
+	if late := t.now().Sub(t.next); late > grace {
+		return fmt.Errorf("update cycle late by %s", late.Truncate(time.Second))
+	}
+	return nil
+}
+
+// Ready returns an error if no update cycle completed yet or the last
+// cycles failed.
+func (t *Tracker) Ready() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ready()
+}
+
+func (t *Tracker) ready() error {
+	if t.cycles == 0 {
+		return fmt.Errorf("no update cycle completed yet")
+	}
+	if t.failures >= t.threshold {
+		return fmt.Errorf("last %d update cycles failed", t.failures)
+	}
+	return nil
+}
+
+// Status returns the current status, with the records sorted by FQDN and
+// provider.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Status{
+		Started:             t.started,
+		LastIP:              t.lastIP,
+		LastCycle:           t.last,
+		NextRun:             t.next,
+		Cycles:              t.cycles,
+		ConsecutiveFailures: t.failures,
+		Healthy:             t.healthy() == nil,
+		Ready:               t.ready() == nil,
+		Records:             make([]RecordStatus, 0, len(t.records)),
+	}
+	for _, r := range t.records {
+		s.Records = append(s.Records, *r)
+	}
+	sort.Slice(s.Records, func(i, j int) bool {
+		if s.Records[i].FQDN != s.Records[j].FQDN {
+			return s.Records[i].FQDN < s.Records[j].FQDN
+		}
+		return s.Records[i].Provider < s.Records[j].Provider
+	})
+	return s
+}
+
+// Register adds the /healthz, /readyz and /status endpoints to `mux`.
+func (t *Tracker) Register(mux *http.ServeMux) {
+	mux.Handle("/healthz", probeHandler(t.Healthy))
+	mux.Handle("/readyz", probeHandler(t.Ready))
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(t.Status())
+	})
+}
+
+// probeHandler replies 200 if `check` succeeds, 503 with the error otherwise.
+func probeHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
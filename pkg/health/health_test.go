@@ -0,0 +1,132 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := NewTracker(2)
+	tr.now = func() time.Time { return now }
+
+	if err := tr.Ready(); err == nil {
+		t.Error("Expected not ready before the first cycle")
+	}
+	if err := tr.Healthy(); err != nil {
+		t.Errorf("Expected healthy before the first cycle, got %v", err)
+	}
+
+	tr.RecordUpdate("test.example.com", "cflare", "192.168.1.1", nil)
+	tr.RecordUpdate("test.example.com", "dyn", "192.168.1.1", errors.New("badauth"))
+	tr.CycleDone("192.168.1.1", nil, 5*time.Minute)
+	if err := tr.Ready(); err != nil {
+		t.Errorf("Expected ready, got %v", err)
+	}
+
+	s := tr.Status()
+	if s.LastIP != "192.168.1.1" || !s.NextRun.Equal(now.Add(5*time.Minute)) || s.Cycles != 1 {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if len(s.Records) != 2 || s.Records[0].Provider != "cflare" || s.Records[0].LastResult != "success" ||
+		s.Records[1].LastResult != "failure" || s.Records[1].LastError != "badauth" || !s.Records[1].LastSuccess.IsZero() {
+		t.Errorf("unexpected records %+v", s.Records)
+	}
+
+	// readiness fails after the threshold of consecutive failures
+	tr.CycleDone("", errors.New("timeout"), 5*time.Minute)
+	if err := tr.Ready(); err != nil {
+		t.Errorf("Expected ready after a single failure, got %v", err)
+	}
+	tr.CycleDone("", errors.New("timeout"), 5*time.Minute)
+	if err := tr.Ready(); err == nil || !strings.Contains(err.Error(), "last 2 update cycles failed") {
+		t.Errorf("Expected not ready error, got %v", err)
+	}
+	tr.CycleDone("10.0.0.1", nil, 5*time.Minute)
+	if err := tr.Ready(); err != nil {
+		t.Errorf("Expected ready after a success, got %v", err)
+	}
+	if s := tr.Status(); s.LastIP != "10.0.0.1" || s.ConsecutiveFailures != 0 {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	// liveness fails if the next cycle is late by more than the interval
+	now = now.Add(10 * time.Minute)
+	if err := tr.Healthy(); err != nil {
+		t.Errorf("Expected healthy, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := tr.Healthy(); err == nil || !strings.Contains(err.Error(), "late by 6m0s") {
+		t.Errorf("Expected unhealthy error, got %v", err)
+	}
+}
+
+func TestTracker_Register(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTracker(0)
+	mux := http.NewServeMux()
+	tr.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		res, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "no update cycle") {
+		t.Errorf("unexpected /readyz reply %d %q", code, body)
+	}
+	tr.RecordUpdate("test.example.com", "cflare", "192.168.1.1", nil)
+	tr.CycleDone("192.168.1.1", nil, 0)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code, body := get(path); code != http.StatusOK || body != "ok\n" {
+			t.Errorf("unexpected %s reply %d %q", path, code, body)
+		}
+	}
+
+	code, body := get("/status")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected /status reply code %d", code)
+	}
+	var s Status
+	if err := json.Unmarshal([]byte(body), &s); err != nil {
+		t.Fatalf("cannot decode /status reply: %v", err)
+	}
+	if !s.Ready || !s.Healthy || s.LastIP != "192.168.1.1" || len(s.Records) != 1 {
+		t.Errorf("unexpected status %+v", s)
+	}
+	if strings.Contains(body, "next_run") {
+		t.Errorf("Expected no next_run without interval: %s", body)
+	}
+}
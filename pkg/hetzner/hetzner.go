@@ -0,0 +1,237 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hetzner implements a DNSManager for the Hetzner DNS Console using
+// the API specified at https://dns.hetzner.com/api-docs .
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://dns.hetzner.com/api/v1"
+	defaultUserAgent = "ddflare-hetzner-"
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type record struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+// NewWithEndpoint initializes a new Hetzner DNS client which uses 'endpoint'
+// as API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the Hetzner DNS API
+// token passed as parameter.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize Hetzner DNS client: missing token")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"Auth-API-Token": {token}})
+	if err != nil {
+		return err
+	}
+	api.ErrorMessage = errorMessage
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may contain both an IPv4 and an IPv6 address, comma separated: the
+// A and AAAA records are updated, or created if missing.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	z, err := c.getZone(fqdn)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, z.Name)
+	if name == "" {
+		name = "@"
+	}
+	log.Debug("DNS zone found", "zone", z.Name, "zoneID", z.ID)
+
+	var recs struct {
+		Records []record `json:"records"`
+	}
+	if err = c.Do("GET", "/records?zone_id="+url.QueryEscape(z.ID), nil, &recs); err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot retrieve DNS records: %w", err)
+	}
+
+	return restapi.Records[record]{
+		Find: func(rType string) ([]record, error) {
+			var found []record
+			for _, r := range recs.Records {
+				if r.Name == name && r.Type == rType {
+					log.Debug("record found", "data", r)
+					found = append(found, r)
+				}
+			}
+			return found, nil
+		},
+		Create: func(rType string, addrs []string) error {
+			want := record{ZoneID: z.ID, Type: rType, Name: name, Value: addrs[0]}
+			if err := c.Do("POST", "/records", want, nil); err != nil {
+				return err
+			}
+			log.Debug("record created", "data", want)
+			return nil
+		},
+		Update: func(rType string, found []record, addrs []string) error {
+			want := record{ZoneID: z.ID, Type: rType, Name: name, Value: addrs[0], TTL: found[0].TTL}
+			if err := c.Do("PUT", "/records/"+found[0].ID, want, nil); err != nil {
+				return err
+			}
+			log.Debug("record updated", "data", want)
+			return nil
+		},
+		Single:    true,
+		Addresses: func(r record) []string { return []string{r.Value} },
+		Zone:      z.Name,
+	}, nil
+}
+
+// getZone returns the Hetzner DNS zone hosting `fqdn`.
+func (c *Client) getZone(fqdn string) (*zone, error) {
+	var found *zone
+	_, err := net.LookupZone(fqdn, func(name string) (bool, error) {
+		var zones struct {
+			Zones []zone `json:"zones"`
+		}
+		// The API replies 404 when no zone matches the name filter.
+		err := c.Do("GET", "/zones?name="+url.QueryEscape(name), nil, &zones)
+		if err != nil && !restapi.IsNotFound(err) {
+			return false, err
+		}
+		for i := range zones.Zones {
+			if zones.Zones[i].Name == name {
+				found = &zones.Zones[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return found, err
+}
+
+// errorMessage extracts the error message from the Hetzner DNS API error
+// reply, nested in the "error" object.
+func errorMessage(body []byte) string {
+	var reply struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &reply) != nil {
+		return ""
+	}
+	return reply.Error.Message
+}
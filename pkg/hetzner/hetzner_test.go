@@ -0,0 +1,268 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hetzner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty token")
+	}
+}
+
+func TestClient_UpdateUninitialized(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+type request struct {
+	method string
+	path   string
+	rec    record
+}
+
+// newHetznerStub returns a fake Hetzner DNS API server hosting the
+// "example.com" zone, which contains an A record for "test.example.com" and
+// two A records for "rr.example.com".
+func newHetznerStub(t *testing.T, reqs *[]request) *httptest.Server {
+	auth := restapitest.Auth{Header: "Auth-API-Token", Value: "secret", Reply: `{"message": "Invalid authentication credentials"}`}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, rec *record) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/zones":
+			if r.URL.Query().Get("name") == "example.com" {
+				w.Write([]byte(`{"zones": [{"id": "z1", "name": "example.com"}]}`))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"zones": [], "error": {"message": "zone not found", "code": 404}}`))
+		case r.Method == "GET" && r.URL.Path == "/records":
+			if r.URL.Query().Get("zone_id") != "z1" {
+				t.Errorf("unexpected zone_id %q", r.URL.Query().Get("zone_id"))
+			}
+			w.Write([]byte(`{"records": [
+				{"id": "r1", "zone_id": "z1", "type": "A", "name": "test", "value": "10.0.0.1", "ttl": 120},
+				{"id": "r2", "zone_id": "z1", "type": "A", "name": "rr", "value": "10.0.0.2"},
+				{"id": "r3", "zone_id": "z1", "type": "A", "name": "rr", "value": "10.0.0.3"}
+			]}`))
+		case r.Method == "PUT" || r.Method == "POST":
+			*reqs = append(*reqs, request{r.Method, r.URL.Path, *rec})
+			w.Write([]byte(`{"record": {}}`))
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		token    string
+		expected []request
+		errorMsg string
+	}{
+		"update": {
+			fqdn:  "test.example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"PUT", "/records/r1", record{ZoneID: "z1", Type: "A", Name: "test", Value: "192.168.1.1", TTL: 120}},
+			},
+		},
+		"update_and_create": {
+			fqdn:  "test.example.com",
+			ip:    "192.168.1.1,2001:db8::1",
+			token: "secret",
+			expected: []request{
+				{"PUT", "/records/r1", record{ZoneID: "z1", Type: "A", Name: "test", Value: "192.168.1.1", TTL: 120}},
+				{"POST", "/records", record{ZoneID: "z1", Type: "AAAA", Name: "test", Value: "2001:db8::1"}},
+			},
+		},
+		"apex": {
+			fqdn:  "example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"POST", "/records", record{ZoneID: "z1", Type: "A", Name: "@", Value: "192.168.1.1"}},
+			},
+		},
+		"deep_subdomain": {
+			fqdn:  "a.b.example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"POST", "/records", record{ZoneID: "z1", Type: "A", Name: "a.b", Value: "192.168.1.1"}},
+			},
+		},
+		"multiple_records": {
+			fqdn:     "rr.example.com",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "found 2 matching A records",
+		},
+		"multiple_addresses": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1,192.168.1.2",
+			token:    "secret",
+			errorMsg: "multiple addresses",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "no zone found",
+		},
+		"bad_token": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "wrong",
+			errorMsg: "Invalid authentication credentials",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var reqs []request
+			server := newHetznerStub(t, &reqs)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(reqs) != 0 {
+					t.Fatalf("Expected no updates, got %v", reqs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(reqs) != len(tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, reqs)
+			}
+			for i := range reqs {
+				if reqs[i] != tt.expected[i] {
+					t.Fatalf("Expected request %+v, got %+v", tt.expected[i], reqs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"multiple_records": {
+			fqdn:     "rr.example.com",
+			ip:       "192.168.1.1",
+			errorMsg: "found 2 matching A records",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var reqs []request
+			server := newHetznerStub(t, &reqs)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(reqs) != 0 {
+				t.Errorf("Expected no updates, got %+v", reqs)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hooks runs the user commands triggered by the DNS updates, e.g., to
+// reload firewall rules when the public address changes.
+//
+// The commands are run by the system shell, with the update details passed
+// in the DDFLARE_* environment variables.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/logging"
+)
+
+const (
+	EnvFQDN     = "DDFLARE_FQDN"
+	EnvOldIP    = "DDFLARE_OLD_IP"
+	EnvNewIP    = "DDFLARE_NEW_IP"
+	EnvProvider = "DDFLARE_PROVIDER"
+	EnvError    = "DDFLARE_ERROR"
+	EnvStage    = "DDFLARE_HOOK"
+
+	DefaultTimeout = 30 * time.Second
+
+	// waitDelay bounds the wait for the output of the processes spawned by
+	// the command after it is killed on timeout.
+	waitDelay = time.Second
+)
+
+// Stage identifies when a hook is run.
+type Stage string
+
+const (
+	PreUpdate  Stage = "pre-update"
+	PostUpdate Stage = "post-update"
+	OnFailure  Stage = "on-failure"
+)
+
+// Env holds the update details passed to the hook commands.
+type Env struct {
+	FQDN string
+	// OldIP is the address before the update, empty if unknown.
+	OldIP    string
+	NewIP    string
+	Provider string
+	// Error is the update error message, set for the OnFailure hooks.
+	Error string
+}
+
+func (e Env) environ(stage Stage) []string {
+	return append(os.Environ(),
+		EnvStage+"="+string(stage),
+		EnvFQDN+"="+e.FQDN,
+		EnvOldIP+"="+e.OldIP,
+		EnvNewIP+"="+e.NewIP,
+		EnvProvider+"="+e.Provider,
+		EnvError+"="+e.Error,
+	)
+}
+
+// Run runs the `command` hook for `stage` through the system shell, passing
+// the `env` details as environment variables. The command is killed if it
+// does not complete within `timeout`. It returns an error if the command
+// fails or times out.
+func Run(stage Stage, command string, env Env, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	log := slog.Default().With("hook", stage, "command", command)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Env = env.environ(stage)
+	cmd.WaitDelay = waitDelay
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+
+	start := time.Now()
+	err := cmd.Run()
+	out := strings.TrimSpace(output.String())
+	log.Debug("hook completed", logging.Duration, time.Since(start), "output", out)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s hook timed out after %s", stage, timeout)
+	}
+	if err != nil {
+		if out != "" {
+			return fmt.Errorf("%s hook failed: %w: %s", stage, err, out)
+		}
+		return fmt.Errorf("%s hook failed: %w", stage, err)
+	}
+	return nil
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
+
+// Set holds the hook commands of each stage: empty commands are not run.
+type Set struct {
+	PreUpdate  string
+	PostUpdate string
+	OnFailure  string
+	Timeout    time.Duration
+}
+
+// Run runs the hook command of `stage`, if any.
+func (s Set) Run(stage Stage, env Env) error {
+	var command string
+	switch stage {
+	case PreUpdate:
+		command = s.PreUpdate
+	case PostUpdate:
+		command = s.PostUpdate
+	case OnFailure:
+		command = s.OnFailure
+	default:
+		return fmt.Errorf("unknown hook stage %q", stage)
+	}
+	if command == "" {
+		return nil
+	}
+	return Run(stage, command, env, s.Timeout)
+}
+
+// Configured returns true if any hook command is set.
+func (s Set) Configured() bool {
+	return s.PreUpdate != "" || s.PostUpdate != "" || s.OnFailure != ""
+}
@@ -0,0 +1,119 @@
+//go:build !windows
+
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	env := Env{
+		FQDN:     "test.example.com",
+		OldIP:    "10.0.0.1",
+		NewIP:    "192.168.1.1",
+		Provider: "cflare",
+		Error:    "",
+	}
+
+	tests := map[string]struct {
+		command  string
+		timeout  time.Duration
+		expected string
+		errorMsg string
+	}{
+		"env": {
+			command:  `printf '%s %s %s %s %s' "$DDFLARE_HOOK" "$DDFLARE_FQDN" "$DDFLARE_OLD_IP" "$DDFLARE_NEW_IP" "$DDFLARE_PROVIDER" > "$OUT"`,
+			expected: "post-update test.example.com 10.0.0.1 192.168.1.1 cflare",
+		},
+		"failure": {
+			command:  "echo cannot reload >&2; exit 3",
+			errorMsg: "exit status 3: cannot reload",
+		},
+		"not_found": {
+			command:  "/nonexistent/ddflare-hook",
+			errorMsg: "post-update hook failed",
+		},
+		"timeout": {
+			command:  "sleep 5",
+			timeout:  100 * time.Millisecond,
+			errorMsg: "timed out after 100ms",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out := filepath.Join(t.TempDir(), "out")
+			command := strings.ReplaceAll(tt.command, "$OUT", out)
+			start := time.Now()
+			err := Run(PostUpdate, command, env, tt.timeout)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if d := time.Since(start); d > 3*time.Second {
+					t.Fatalf("hook took %s", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("cannot read hook output: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Fatalf("Expected hook output %q, got %q", tt.expected, data)
+			}
+		})
+	}
+}
+
+func TestSet_Run(t *testing.T) {
+	t.Parallel()
+
+	out := filepath.Join(t.TempDir(), "out")
+	hooks := Set{
+		OnFailure: `printf '%s' "$DDFLARE_ERROR" > ` + out,
+		PreUpdate: "exit 1",
+	}
+	if err := hooks.Run(PostUpdate, Env{}); err != nil {
+		t.Fatalf("Unexpected error running an empty hook: %v", err)
+	}
+	if err := hooks.Run(PreUpdate, Env{}); err == nil {
+		t.Fatal("Expected pre-update hook failure")
+	}
+	if err := hooks.Run(OnFailure, Env{Error: "update failed"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "update failed" {
+		t.Fatalf("Expected hook output %q, got %q", "update failed", data)
+	}
+	if err := hooks.Run("later", Env{}); err == nil {
+		t.Fatal("Expected unknown stage failure")
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package linode implements a DNSManager for the Linode DNS Manager using
+// the API specified at https://techdocs.akamai.com/linode-api/reference/api .
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://api.linode.com/v4"
+	defaultUserAgent = "ddflare-linode-"
+	pageSize         = 500
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type domain struct {
+	ID     int    `json:"id"`
+	Domain string `json:"domain"`
+}
+
+type record struct {
+	ID     int    `json:"id,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	TTL    int    `json:"ttl_sec,omitempty"`
+}
+
+// NewWithEndpoint initializes a new Linode client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the Linode personal
+// access token passed as parameter.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize Linode client: missing token")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		return err
+	}
+	api.ErrorMessage = errorMessage
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may contain both an IPv4 and an IPv6 address, comma separated: the
+// A and AAAA records are updated, or created if missing.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	d, err := c.getDomain(fqdn)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, d.Domain)
+	log.Debug("DNS zone found", "zone", d.Domain, "zoneID", d.ID)
+
+	recordsPath := "/domains/" + strconv.Itoa(d.ID) + "/records"
+	var recs []record
+	if err = listAll(c.API, recordsPath, &recs); err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot retrieve DNS records: %w", err)
+	}
+
+	return restapi.Records[record]{
+		Find: func(rType string) ([]record, error) {
+			var found []record
+			for _, r := range recs {
+				if r.Name == name && r.Type == rType {
+					log.Debug("record found", "data", r)
+					found = append(found, r)
+				}
+			}
+			return found, nil
+		},
+		Create: func(rType string, addrs []string) error {
+			want := record{Type: rType, Name: name, Target: addrs[0]}
+			if err := c.Do("POST", recordsPath, want, nil); err != nil {
+				return err
+			}
+			log.Debug("record created", "data", want)
+			return nil
+		},
+		Update: func(_ string, found []record, addrs []string) error {
+			want := record{Name: name, Target: addrs[0], TTL: found[0].TTL}
+			if err := c.Do("PUT", recordsPath+"/"+strconv.Itoa(found[0].ID), want, nil); err != nil {
+				return err
+			}
+			log.Debug("record updated", "data", want)
+			return nil
+		},
+		Single:    true,
+		Addresses: func(r record) []string { return []string{r.Target} },
+		Zone:      d.Domain,
+	}, nil
+}
+
+// getDomain returns the Linode domain hosting `fqdn`.
+func (c *Client) getDomain(fqdn string) (*domain, error) {
+	var domains []domain
+	if err := listAll(c.API, "/domains", &domains); err != nil {
+		return nil, err
+	}
+	var found *domain
+	_, err := net.LookupZone(fqdn, func(name string) (bool, error) {
+		for i := range domains {
+			if domains[i].Domain == name {
+				found = &domains[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return found, err
+}
+
+// listAll retrieves all the pages of the `path` collection in `items`.
+func listAll[T any](api *restapi.API, path string, items *[]T) error {
+	for page := 1; ; page++ {
+		var reply struct {
+			Data  []T `json:"data"`
+			Page  int `json:"page"`
+			Pages int `json:"pages"`
+		}
+		if err := api.Do("GET", path+"?page_size="+strconv.Itoa(pageSize)+"&page="+strconv.Itoa(page), nil, &reply); err != nil {
+			return err
+		}
+		*items = append(*items, reply.Data...)
+		if page >= reply.Pages {
+			return nil
+		}
+	}
+}
+
+// errorMessage extracts the error reasons from the Linode API error reply.
+func errorMessage(body []byte) string {
+	var reply struct {
+		Errors []struct {
+			Field  string `json:"field"`
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &reply) != nil {
+		return ""
+	}
+	var reasons []string
+	for _, e := range reply.Errors {
+		if e.Field != "" {
+			reasons = append(reasons, e.Field+": "+e.Reason)
+		} else {
+			reasons = append(reasons, e.Reason)
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,273 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty token")
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+type request struct {
+	method string
+	path   string
+	rec    record
+}
+
+// newLinodeStub returns a fake Linode API endpoint. The domains list is
+// split in two pages: "example.com" (id 1) is in the second one. The domain
+// records are split in two pages too: the second one contains the A record
+// 11 with TTL 300 for "test" and two AAAA records for "multi".
+func newLinodeStub(t *testing.T, requests *[]request) *httptest.Server {
+	auth := restapitest.Auth{Header: "Authorization", Value: "Bearer secret", Reply: `{"errors": [{"reason": "Invalid Token"}]}`}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, rec *record) {
+		page := r.URL.Query().Get("page")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/domains" && page == "1":
+			w.Write([]byte(`{"data": [{"id": 2, "domain": "example.net"}], "page": 1, "pages": 2, "results": 2}`))
+		case r.Method == "GET" && r.URL.Path == "/domains" && page == "2":
+			w.Write([]byte(`{"data": [{"id": 1, "domain": "example.com"}], "page": 2, "pages": 2, "results": 2}`))
+		case r.Method == "GET" && r.URL.Path == "/domains/1/records" && page == "1":
+			w.Write([]byte(`{"data": [{"id": 10, "type": "MX", "name": "", "target": "mail.example.com"}], "page": 1, "pages": 2}`))
+		case r.Method == "GET" && r.URL.Path == "/domains/1/records" && page == "2":
+			w.Write([]byte(`{"data": [{"id": 11, "type": "A", "name": "test", "target": "10.0.0.1", "ttl_sec": 300},
+				{"id": 12, "type": "AAAA", "name": "multi", "target": "2001:db8::1"},
+				{"id": 13, "type": "AAAA", "name": "multi", "target": "2001:db8::2"}], "page": 2, "pages": 2}`))
+		case r.Method == "POST" || r.Method == "PUT":
+			if rec.Target == "192.0.2.0" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors": [{"field": "target", "reason": "Invalid IPv4 address"}]}`))
+				return
+			}
+			*requests = append(*requests, request{r.Method, r.URL.Path, *rec})
+			w.Write([]byte(`{}`))
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		token    string
+		expected []request
+		errorMsg string
+	}{
+		"update": {
+			fqdn:  "test.example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"PUT", "/domains/1/records/11", record{Name: "test", Target: "192.168.1.1", TTL: 300}},
+			},
+		},
+		"update_and_create": {
+			fqdn:  "test.example.com.",
+			ip:    "192.168.1.1,2001:db8::1",
+			token: "secret",
+			expected: []request{
+				{"PUT", "/domains/1/records/11", record{Name: "test", Target: "192.168.1.1", TTL: 300}},
+				{"POST", "/domains/1/records", record{Type: "AAAA", Name: "test", Target: "2001:db8::1"}},
+			},
+		},
+		"apex": {
+			fqdn:  "example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"POST", "/domains/1/records", record{Type: "A", Target: "192.168.1.1"}},
+			},
+		},
+		"multiple_records": {
+			fqdn:     "multi.example.com",
+			ip:       "2001:db8::3",
+			token:    "secret",
+			errorMsg: "found 2 matching AAAA records",
+		},
+		"unknown_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "no zone found",
+		},
+		"invalid_target": {
+			fqdn:     "test.example.com",
+			ip:       "192.0.2.0",
+			token:    "secret",
+			errorMsg: "target: Invalid IPv4 address",
+		},
+		"bad_token": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "wrong",
+			errorMsg: "Invalid Token",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newLinodeStub(t, &requests)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(requests) != 0 {
+					t.Fatalf("Expected no updates, got %+v", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, requests)
+			}
+		})
+	}
+}
+
+func TestClient_SetUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewWithEndpoint(server.URL)
+	if err := client.Init("secret"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	client.SetUserAgent("custom-agent")
+	if err := client.Update("test.example.com", "192.168.1.1"); err == nil {
+		t.Fatal("Expected Update failure")
+	}
+	if len(agents) == 0 || agents[0] != "custom-agent" {
+		t.Errorf("Expected user agent %q, got %v", "custom-agent", agents)
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"multiple_records": {
+			fqdn:     "multi.example.com",
+			ip:       "2001:db8::3",
+			errorMsg: "found 2 matching AAAA records",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newLinodeStub(t, &requests)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(requests) != 0 {
+				t.Errorf("Expected no updates, got %+v", requests)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
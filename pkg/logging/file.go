@@ -0,0 +1,142 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File is a log file rotated when its size would exceed a maximum: the
+// current file is renamed with the ".1" suffix, the older ones are shifted
+// (".1" to ".2" and so on) and the exceeding ones are removed.
+// It is safe for concurrent use.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	closed bool
+	// rotateErr is the last rotation failure, reported once on stderr
+	rotateErr error
+}
+
+// OpenFile opens (or creates) the log file at `path` in append mode, rotating
+// it when it reaches `maxSize` bytes (0 disables the rotation) and keeping
+// `maxBackups` rotated files.
+func OpenFile(path string, maxSize int64, maxBackups int) (*File, error) {
+	lf := &File{path: path, maxSize: maxSize, maxBackups: max(maxBackups, 0)}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+	lf.f, lf.size = f, info.Size()
+	return nil
+}
+
+// Write writes `p` to the log file, rotating it first if `p` would make it
+// exceed the maximum size. Records bigger than the maximum size are written
+// to a file of their own. If the rotation fails the records are appended to
+// the current file, retrying the rotation at the next write.
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.closed {
+		return 0, os.ErrClosed
+	}
+	if lf.maxSize > 0 && lf.size > 0 && lf.size+int64(len(p)) > lf.maxSize {
+		err := lf.rotate()
+		if err != nil && lf.rotateErr == nil {
+			fmt.Fprintf(os.Stderr, "%v, appending to %s\n", err, lf.path)
+		}
+		lf.rotateErr = err
+	}
+	if lf.f == nil {
+		// reopen the original path after a failed rotation
+		if err := lf.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts the backups and reopens the file.
+// On failure the file may be left closed, to be reopened by the caller.
+func (lf *File) rotate() error {
+	err := lf.f.Close()
+	lf.f = nil
+	if err != nil {
+		return fmt.Errorf("cannot rotate log file: %w", err)
+	}
+
+	if lf.maxBackups == 0 {
+		if err := os.Remove(lf.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot rotate log file: %w", err)
+		}
+		return lf.open()
+	}
+	for i := lf.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(lf.backup(i), lf.backup(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(lf.path, lf.backup(1)); err != nil {
+		return fmt.Errorf("cannot rotate log file: %w", err)
+	}
+	return lf.open()
+}
+
+func (lf *File) backup(i int) string {
+	return fmt.Sprintf("%s.%d", lf.path, i)
+}
+
+// Close closes the log file.
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.closed {
+		return os.ErrClosed
+	}
+	lf.closed = true
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging sets up the ddflare structured logs and defines the
+// attribute keys shared by all the log records.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Attribute keys of the log records: the backends and the CLI use them for
+// the same data, so that the logs can be reliably parsed.
+const (
+	FQDN     = "fqdn"
+	Provider = "provider"
+	IP       = "ip"
+	OldIP    = "old_ip"
+	Duration = "duration"
+	Attempt  = "attempt"
+	Endpoint = "endpoint"
+	Error    = "error"
+)
+
+// Format is the log records encoding.
+type Format string
+
+const (
+	// Text encodes the records as logfmt key=value pairs.
+	Text Format = "text"
+	// JSON encodes the records as JSON objects, one per line.
+	JSON Format = "json"
+)
+
+// ParseFormat returns the Format named `name` ("text" or "json").
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case Text, JSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", name)
+}
+
+// NewHandler returns a slog.Handler writing the records at or above `level`
+// to `w`, encoded according to `format`.
+func NewHandler(w io.Writer, format Format, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == JSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		name     string
+		expected Format
+		errorMsg string
+	}{
+		"text":    {"text", Text, ""},
+		"json":    {"json", JSON, ""},
+		"unknown": {"yaml", "", `unknown log format "yaml"`},
+		"empty":   {"", "", `unknown log format ""`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := ParseFormat(tt.name)
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Fatalf("Expected error %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if f != tt.expected {
+				t.Errorf("Expected format %q, got %q", tt.expected, f)
+			}
+		})
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := slog.New(NewHandler(&buf, JSON, slog.LevelInfo))
+	log.Debug("dropped")
+	log.Info("record updated", FQDN, "test.example.com", IP, "192.168.1.1", Attempt, 2)
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if rec["msg"] != "record updated" || rec[FQDN] != "test.example.com" || rec[IP] != "192.168.1.1" || rec[Attempt] != 2.0 {
+		t.Errorf("unexpected record %v", rec)
+	}
+
+	buf.Reset()
+	log = slog.New(NewHandler(&buf, Text, slog.LevelInfo))
+	log.Info("record updated", FQDN, "test.example.com")
+	if !strings.Contains(buf.String(), `msg="record updated" fqdn=test.example.com`) {
+		t.Errorf("unexpected text record %q", buf.String())
+	}
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		maxSize    int64
+		maxBackups int
+		writes     []string
+		expected   []string
+	}{
+		"no_rotation": {
+			maxSize:  0,
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			expected: []string{"aaaa\nbbbb\ncccc\n"},
+		},
+		"rotation": {
+			maxSize:    10,
+			maxBackups: 2,
+			writes:     []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n"},
+			expected:   []string{"eeee\nffff\n", "cccc\ndddd\n", "aaaa\nbbbb\n"},
+		},
+		"drop_oldest": {
+			maxSize:    5,
+			maxBackups: 1,
+			writes:     []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			expected:   []string{"cccc\n", "bbbb\n"},
+		},
+		"no_backups": {
+			maxSize:  5,
+			writes:   []string{"aaaa\n", "bbbb\n"},
+			expected: []string{"bbbb\n"},
+		},
+		"big_record": {
+			maxSize:    4,
+			maxBackups: 1,
+			writes:     []string{"aaaaaaaa\n", "b\n"},
+			expected:   []string{"b\n", "aaaaaaaa\n"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "ddflare.log")
+			lf, err := OpenFile(path, tt.maxSize, tt.maxBackups)
+			if err != nil {
+				t.Fatalf("unexpected OpenFile failure: %v", err)
+			}
+			for _, w := range tt.writes {
+				if _, err := lf.Write([]byte(w)); err != nil {
+					t.Fatalf("unexpected Write failure: %v", err)
+				}
+			}
+			if err := lf.Close(); err != nil {
+				t.Fatalf("unexpected Close failure: %v", err)
+			}
+
+			for i, exp := range tt.expected {
+				p := path
+				if i > 0 {
+					p = lf.backup(i)
+				}
+				data, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatalf("cannot read %s: %v", p, err)
+				}
+				if string(data) != exp {
+					t.Errorf("Expected %s content %q, got %q", p, exp, data)
+				}
+			}
+			if _, err := os.Stat(lf.backup(len(tt.expected))); !os.IsNotExist(err) {
+				t.Errorf("Expected no backup #%d, got %v", len(tt.expected), err)
+			}
+		})
+	}
+}
+
+func TestFile_Append(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "ddflare.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lf, err := OpenFile(path, 8, 1)
+	if err != nil {
+		t.Fatalf("unexpected OpenFile failure: %v", err)
+	}
+	// the existing content counts for the rotation
+	lf.Write([]byte("new\n"))
+	lf.Write([]byte("next\n"))
+	lf.Close()
+	if _, err := lf.Write([]byte("closed\n")); err == nil {
+		t.Error("Expected Write failure after Close")
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "next\n" {
+		t.Errorf("unexpected log file content %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "old\nnew\n" {
+		t.Errorf("unexpected backup content %q", data)
+	}
+}
+
+func TestFile_RotateFailure(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "ddflare.log")
+	// a non empty directory in place of the backup makes the rotation fail,
+	// also when running as root (unlike a read-only directory)
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lf, err := OpenFile(path, 5, 1)
+	if err != nil {
+		t.Fatalf("unexpected OpenFile failure: %v", err)
+	}
+	defer lf.Close()
+
+	for _, w := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		if _, err := lf.Write([]byte(w)); err != nil {
+			t.Fatalf("unexpected Write failure: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "aaaa\nbbbb\ncccc\n" {
+		t.Errorf("unexpected log file content %q", data)
+	}
+
+	// the rotation is retried once possible
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lf.Write([]byte("dddd\n")); err != nil {
+		t.Fatalf("unexpected Write failure: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "dddd\n" {
+		t.Errorf("unexpected log file content %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "aaaa\nbbbb\ncccc\n" {
+		t.Errorf("unexpected backup content %q", data)
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package namecheap implements a DNSManager for the Namecheap dynamic DNS
+// service, as specified at https://www.namecheap.com/support/knowledgebase/article.aspx/29/11/how-to-dynamically-update-the-hosts-ip-with-an-http-request/ .
+package namecheap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager   = (*Client)(nil)
+	_ ddman.Configurable = (*Client)(nil)
+	_ ddman.Planner      = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://dynamicdns.park-your-domain.com"
+	defaultUserAgent = "ddflare-namecheap-"
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	domain    string
+	password  string
+}
+
+// response tracks the XML reply of the update endpoint.
+type response struct {
+	XMLName  xml.Name `xml:"interface-response"`
+	IP       string   `xml:"IP"`
+	ErrCount int      `xml:"ErrCount"`
+	Errors   struct {
+		Errs []string `xml:",any"`
+	} `xml:"errors"`
+	Done bool `xml:"Done"`
+}
+
+// NewWithEndpoint initializes a new Namecheap dynamic DNS client which uses
+// 'endpoint' as API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// SetOption sets the Namecheap specific options. The only option supported
+// is "domain", the registered domain the FQDN belongs to: when not set, the
+// last two labels of the FQDN are used.
+func (c *Client) SetOption(key, value string) error {
+	switch key {
+	case "domain":
+		if value == "" {
+			return fmt.Errorf("invalid empty %q option", key)
+		}
+		c.domain = strings.TrimSuffix(value, ".")
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Init stores the Dynamic DNS password of the domain.
+func (c *Client) Init(password string) error {
+	if password == "" {
+		return fmt.Errorf("cannot initialize Namecheap client: missing Dynamic DNS password")
+	}
+	c.password = password
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// Namecheap dynamic DNS supports IPv4 (A records) only.
+func (c *Client) Update(fqdn, ip string) error {
+	host, domain, addr, err := c.target(fqdn, ip)
+	if err != nil {
+		return err
+	}
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	q := url.Values{}
+	q.Set("host", host)
+	q.Set("domain", domain)
+	q.Set("password", c.password)
+	q.Set("ip", addr)
+	req, err := http.NewRequest("GET", c.endpoint+"/update?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", c.endpoint, err)
+	}
+	req.Header.Add("User-Agent", c.userAgent)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", c.endpoint, err)
+	}
+	defer res.Body.Close()
+
+	log.Debug("endpoint connected", "status", res.Status, "code", res.StatusCode)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("endpoint %q returned %d (%s) status", c.endpoint, res.StatusCode, res.Status)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failure reading endpoint %q reply: %w", c.endpoint, err)
+	}
+	log.Debug("parsing reply message", "body", string(body))
+
+	if err = parseResponse(body); err != nil {
+		return fmt.Errorf("namecheap update failed: %w", err)
+	}
+	return nil
+}
+
+// Plan checks the update of `fqdn` to `ip` as Update() does and returns the
+// change it would apply. The dynamic DNS endpoint does not expose the
+// records: the current address is resolved via DNS.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	host, domain, addr, err := c.target(fqdn, ip)
+	if err != nil {
+		return nil, err
+	}
+	fqdn = strings.TrimSuffix(fqdn, ".")
+
+	return ddman.ResolvePlan(fqdn, addr, map[string]string{"zone": domain, "host": host})
+}
+
+// target returns the host and the domain parts of `fqdn` and the IPv4
+// address of `ip` to update them to.
+func (c *Client) target(fqdn, ip string) (string, string, string, error) {
+	if c.password == "" {
+		return "", "", "", fmt.Errorf("not authorized")
+	}
+
+	v4, v6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(v4) != 1 || len(v6) != 0 {
+		return "", "", "", fmt.Errorf("a single IPv4 address is supported, got %q", ip)
+	}
+	host, domain, err := c.splitFQDN(strings.TrimSuffix(fqdn, "."))
+	if err != nil {
+		return "", "", "", err
+	}
+	return host, domain, v4[0], nil
+}
+
+// splitFQDN returns the host and the domain parts of `fqdn`.
+func (c *Client) splitFQDN(fqdn string) (string, string, error) {
+	domain := c.domain
+	if domain == "" {
+		domains := net.ParentDomains(fqdn)
+		if len(domains) == 0 {
+			return "", "", fmt.Errorf("%q is not a valid dns name", fqdn)
+		}
+		domain = domains[len(domains)-1]
+	}
+	if fqdn == domain {
+		return "@", domain, nil
+	}
+	host, found := strings.CutSuffix(fqdn, "."+domain)
+	if !found {
+		return "", "", fmt.Errorf("%q does not belong to domain %q", fqdn, domain)
+	}
+	return host, domain, nil
+}
+
+// parseResponse decodes the XML reply of the update endpoint and returns an
+// error reporting the errors listed in it, if any.
+func parseResponse(body []byte) error {
+	var resp response
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	// The endpoint declares an "utf-16" encoding but actually replies in
+	// plain ASCII: ignore the declared charset.
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := dec.Decode(&resp); err != nil {
+		return fmt.Errorf("protocol error: cannot decode reply: %w", err)
+	}
+	if resp.ErrCount > 0 || len(resp.Errors.Errs) > 0 {
+		if len(resp.Errors.Errs) == 0 {
+			return fmt.Errorf("%d errors reported", resp.ErrCount)
+		}
+		return errors.New(strings.Join(resp.Errors.Errs, "; "))
+	}
+	if !resp.Done {
+		return fmt.Errorf("protocol error: update not done")
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namecheap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+const (
+	replyGood = `<?xml version="1.0" encoding="utf-16"?>
+<interface-response><Command>SETDNSHOST</Command><Language>eng</Language><IP>192.168.1.1</IP><ErrCount>0</ErrCount><errors /><ResponseCount>0</ResponseCount><responses /><Done>true</Done><debug><![CDATA[]]></debug></interface-response>`
+	replyBadPassword = `<?xml version="1.0" encoding="utf-16"?>
+<interface-response><Command>SETDNSHOST</Command><Language>eng</Language><ErrCount>1</ErrCount><errors><Err1>Passwords do not match</Err1></errors><ResponseCount>1</ResponseCount><responses><response><ResponseNumber>304156</ResponseNumber><ResponseString>Validation error; invalid ; password</ResponseString></response></responses><Done>true</Done><debug><![CDATA[]]></debug></interface-response>`
+	replyMultipleErrors = `<?xml version="1.0"?>
+<interface-response><ErrCount>2</ErrCount><errors><Err1>Domain name not found</Err1><Err2>Invalid IP</Err2></errors><Done>true</Done></interface-response>`
+	replyCountOnly = `<?xml version="1.0"?>
+<interface-response><ErrCount>1</ErrCount><errors /><Done>true</Done></interface-response>`
+	replyNotDone = `<?xml version="1.0"?>
+<interface-response><ErrCount>0</ErrCount><errors /><Done>false</Done></interface-response>`
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty password")
+	}
+	if err := client.SetOption("host", "www"); err == nil {
+		t.Error("Expected SetOption failure with an unknown option")
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		reply    string
+		errorMsg string
+	}{
+		"good":            {replyGood, ""},
+		"bad_password":    {replyBadPassword, "Passwords do not match"},
+		"multiple_errors": {replyMultipleErrors, "Domain name not found; Invalid IP"},
+		"count_only":      {replyCountOnly, "1 errors reported"},
+		"not_done":        {replyNotDone, "update not done"},
+		"not_xml":         {"good 192.168.1.1", "cannot decode reply"},
+		"wrong_root":      {"<html><body>Error</body></html>", "cannot decode reply"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := parseResponse([]byte(tt.reply))
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		domain   string
+		password string
+		host     string
+		errorMsg string
+	}{
+		"host": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			password: "secret",
+			host:     "test",
+		},
+		"apex": {
+			fqdn:     "example.com",
+			ip:       "192.168.1.1",
+			password: "secret",
+			host:     "@",
+		},
+		"domain_option": {
+			fqdn:     "a.test.example.co.uk",
+			ip:       "192.168.1.1",
+			domain:   "example.co.uk",
+			password: "secret",
+			host:     "a.test",
+		},
+		"wrong_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			domain:   "example.com",
+			password: "secret",
+			errorMsg: "does not belong to domain",
+		},
+		"ipv6": {
+			fqdn:     "test.example.com",
+			ip:       "2001:db8::1",
+			password: "secret",
+			errorMsg: "a single IPv4 address is supported",
+		},
+		"bad_password": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			password: "wrong",
+			errorMsg: "Passwords do not match",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			updates := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "GET" || r.URL.Path != "/update" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				}
+				q := r.URL.Query()
+				if q.Get("password") != "secret" {
+					w.Write([]byte(replyBadPassword))
+					return
+				}
+				if q.Get("host") != tt.host || q.Get("ip") != tt.ip {
+					t.Errorf("unexpected host %q or ip %q", q.Get("host"), q.Get("ip"))
+				}
+				updates++
+				w.Write([]byte(replyGood))
+			}))
+			defer server.Close()
+
+			client := NewWithEndpoint(server.URL)
+			if tt.domain != "" {
+				if err := client.SetOption("domain", tt.domain); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+			if err := client.Init(tt.password); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if updates != 1 {
+				t.Fatalf("Expected a single update, got %d", updates)
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		domain   string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"resolved": {
+			fqdn:   "localhost",
+			ip:     "127.0.0.1",
+			domain: "localhost",
+			expected: []ddman.RecordChange{{Name: "localhost", Type: "A", Old: "127.0.0.1", New: "127.0.0.1",
+				Attributes: map[string]string{"zone": "localhost", "host": "@", "lookup": ddman.LookupDNS}}},
+		},
+		"not_existing": {
+			fqdn: "test.ddflare.invalid.",
+			ip:   "192.168.1.1",
+			expected: []ddman.RecordChange{{Name: "test.ddflare.invalid", Type: "A", New: "192.168.1.1",
+				Attributes: map[string]string{"zone": "ddflare.invalid", "host": "test", "lookup": ddman.LookupDNS}}},
+		},
+		"wrong_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			domain:   "example.com",
+			errorMsg: "does not belong to domain",
+		},
+		"ipv6": {
+			fqdn:     "test.example.com",
+			ip:       "2001:db8::1",
+			errorMsg: "a single IPv4 address is supported",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			}))
+			defer server.Close()
+
+			client := NewWithEndpoint(server.URL)
+			if tt.domain != "" {
+				if err := client.SetOption("domain", tt.domain); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
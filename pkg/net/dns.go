@@ -0,0 +1,180 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTimeout is the timeout of each DNS query.
+const dnsTimeout = 5 * time.Second
+
+// ednsSize is the UDP payload size advertised via EDNS0: the DNS flag day
+// 2020 default, large enough to avoid most TCP retries without risking IP
+// fragmentation.
+const ednsSize = 1232
+
+// Record is an address record of a DNS name.
+type Record struct {
+	// Type is the record type, "A" or "AAAA".
+	Type    string
+	Address string
+	// TTL is the record time to live in seconds.
+	TTL uint32
+}
+
+// LookupAddresses queries the name `server` ("host[:port]") for the A and
+// AAAA records of `fqdn`, returning the addresses found with their TTL.
+// CNAMEs are followed by the server.
+func LookupAddresses(fqdn, server string) ([]Record, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	name, err := dnsmessage.NewName(strings.TrimSuffix(fqdn, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %q: %w", fqdn, err)
+	}
+
+	var records []Record
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		msg, err := query(server, name, qtype)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %q: %w", fqdn, err)
+		}
+		if msg.RCode != dnsmessage.RCodeSuccess {
+			return nil, fmt.Errorf("cannot resolve %q: %s", fqdn, rcodeName(msg.RCode))
+		}
+		for _, a := range msg.Answers {
+			switch r := a.Body.(type) {
+			case *dnsmessage.AResource:
+				records = append(records, Record{"A", netip.AddrFrom4(r.A).String(), a.Header.TTL})
+			case *dnsmessage.AAAAResource:
+				records = append(records, Record{"AAAA", netip.AddrFrom16(r.AAAA).String(), a.Header.TTL})
+			}
+		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no address found for %q", fqdn)
+	}
+	return records, nil
+}
+
+// query sends the `qtype` question for `name` to `server` via UDP, retrying
+// via TCP if the reply is truncated.
+func query(server string, name dnsmessage.Name, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	id := uint16(rand.Uint32())
+	question := dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(ednsSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	req := dnsmessage.Message{
+		Header:      dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions:   []dnsmessage.Question{question},
+		Additionals: []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}},
+	}
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	isReply := func(msg *dnsmessage.Message) bool {
+		return msg.ID == id && msg.Response && len(msg.Questions) == 1 &&
+			msg.Questions[0].Type == qtype && strings.EqualFold(msg.Questions[0].Name.String(), name.String())
+	}
+	msg, err := exchange("udp", server, packed, isReply)
+	if err == nil && msg.Truncated {
+		msg, err = exchange("tcp", server, packed, isReply)
+	}
+	return msg, err
+}
+
+// exchange sends the `packed` query to `server` and returns the first reply
+// matching `isReply`. Over UDP the datagrams not matching, e.g., late replies
+// to previous queries or spoofing attempts, are dropped while waiting for
+// the reply until the query timeout.
+func exchange(network, server string, packed []byte, isReply func(*dnsmessage.Message) bool) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, server, dnsTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+
+	buf := make([]byte, 65535)
+	if network == "udp" {
+		if _, err = conn.Write(packed); err != nil {
+			return nil, err
+		}
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err == nil && isReply(&msg) {
+				return &msg, nil
+			}
+		}
+	}
+
+	// TCP messages are prefixed by their length
+	if _, err = conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(packed)))); err == nil {
+		_, err = conn.Write(packed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l [2]byte
+	if _, err = io.ReadFull(conn, l[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(l[:]))
+	if _, err = io.ReadFull(conn, buf[:n]); err != nil {
+		return nil, err
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf[:n]); err != nil {
+		return nil, fmt.Errorf("cannot decode DNS reply: %w", err)
+	}
+	if !isReply(&msg) {
+		return nil, fmt.Errorf("unexpected reply from %s", server)
+	}
+	return &msg, nil
+}
+
+func rcodeName(rc dnsmessage.RCode) string {
+	switch rc {
+	case dnsmessage.RCodeNameError:
+		return "no such host"
+	case dnsmessage.RCodeServerFailure:
+		return "server failure"
+	case dnsmessage.RCodeRefused:
+		return "query refused"
+	}
+	return rc.String()
+}
@@ -17,14 +17,19 @@ limitations under the License.
 package net
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strings"
 )
 
+// PublicIPService is the URL of the service returning the public IP address.
+const PublicIPService = "https://api.ipify.org"
+
 func GetMyPub() (string, error) {
-	res, err := http.Get("https://api.ipify.org")
+	res, err := http.Get(PublicIPService)
 	if err != nil {
 		return "", err
 	}
@@ -51,3 +56,80 @@ func Resolve(fqdn string) (string, error) {
 	}
 	return "", fmt.Errorf("no IPv4 address found for %q", fqdn)
 }
+
+// ResolveAll returns the IPv4 and the IPv6 addresses of `fqdn` using the
+// local resolver. A not existing `fqdn` has no addresses.
+func ResolveAll(fqdn string) ([]string, []string, error) {
+	ips, err := net.LookupIP(fqdn)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("cannot resolve %q: %w", fqdn, err)
+	}
+	var v4, v6 []string
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip.String())
+		} else {
+			v6 = append(v6, ip.String())
+		}
+	}
+	return v4, v6, nil
+}
+
+// SplitAddresses parses a comma separated list of IP addresses and returns
+// the IPv4 and the IPv6 addresses found in separate slices.
+func SplitAddresses(ips string) ([]string, []string, error) {
+	var v4, v6 []string
+	for _, a := range strings.Split(ips, ",") {
+		ip := net.ParseIP(strings.TrimSpace(a))
+		if ip == nil {
+			return nil, nil, fmt.Errorf("invalid IP address %q", a)
+		}
+		if ip.To4() != nil {
+			v4 = append(v4, ip.String())
+		} else {
+			v6 = append(v6, ip.String())
+		}
+	}
+	return v4, v6, nil
+}
+
+// ParentDomains returns the domain names `fqdn` belongs to, starting from
+// `fqdn` itself and ending with its second level domain. It can be used to
+// look for the DNS zone hosting `fqdn`, testing the longest names first.
+func ParentDomains(fqdn string) []string {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	var domains []string
+	for i := 0; i < len(labels)-1; i++ {
+		if labels[i] == "" {
+			return nil
+		}
+		domains = append(domains, strings.Join(labels[i:], "."))
+	}
+	return domains
+}
+
+// LookupZone returns the longest parent domain of `fqdn` for which `exists`
+// returns true.
+func LookupZone(fqdn string, exists func(name string) (bool, error)) (string, error) {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	for _, name := range ParentDomains(fqdn) {
+		found, err := exists(name)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no zone found for %q", fqdn)
+}
+
+// RecordName returns the name of `fqdn` relative to `zone`: the empty string
+// for the zone apex.
+func RecordName(fqdn, zone string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(fqdn, "."), zone), ".")
+}
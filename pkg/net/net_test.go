@@ -17,9 +17,17 @@ limitations under the License.
 package net
 
 import (
+	"encoding/binary"
+	"errors"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
 	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestGetMyPub(t *testing.T) {
@@ -84,3 +92,274 @@ func TestResolve(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitAddresses(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		ips   string
+		v4    []string
+		v6    []string
+		fails bool
+	}{
+		"ipv4":      {"10.0.0.1", []string{"10.0.0.1"}, nil, false},
+		"ipv6":      {"2001:db8::1", nil, []string{"2001:db8::1"}, false},
+		"mixed":     {"10.0.0.1, 2001:db8::1,10.0.0.2", []string{"10.0.0.1", "10.0.0.2"}, []string{"2001:db8::1"}, false},
+		"canonical": {"2001:DB8:0::1", nil, []string{"2001:db8::1"}, false},
+		"empty":     {"", nil, nil, true},
+		"invalid":   {"10.0.0.1,nothing", nil, nil, true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			v4, v6, err := SplitAddresses(test.ips)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("SplitAddresses(%q): expecting error, got %v %v", test.ips, v4, v6)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SplitAddresses(%q) error: %v", test.ips, err)
+			}
+			if !slices.Equal(v4, test.v4) || !slices.Equal(v6, test.v6) {
+				t.Fatalf("SplitAddresses(%q): expecting %v %v, got %v %v", test.ips, test.v4, test.v6, v4, v6)
+			}
+		})
+	}
+}
+
+func TestParentDomains(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn    string
+		domains []string
+	}{
+		"subdomain":    {"sub.example.com", []string{"sub.example.com", "example.com"}},
+		"trailing_dot": {"sub.example.com.", []string{"sub.example.com", "example.com"}},
+		"domain":       {"example.com", []string{"example.com"}},
+		"deep":         {"a.b.example.co.uk", []string{"a.b.example.co.uk", "b.example.co.uk", "example.co.uk", "co.uk"}},
+		"single_word":  {"localhost", nil},
+		"empty":        {"", nil},
+		"empty_label":  {"a..example.com", nil},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if res := ParentDomains(test.fqdn); !slices.Equal(res, test.domains) {
+				t.Fatalf("ParentDomains(%q): expecting %v, got %v", test.fqdn, test.domains, res)
+			}
+		})
+	}
+}
+
+func TestLookupZone(t *testing.T) {
+	t.Parallel()
+
+	zones := map[string]bool{"example.com": true, "sub.example.com": true}
+	exists := func(name string) (bool, error) {
+		if name == "fail.example.com" {
+			return false, errors.New("lookup failure")
+		}
+		return zones[name], nil
+	}
+
+	tests := map[string]struct {
+		fqdn     string
+		zone     string
+		errorMsg string
+	}{
+		"host":    {"test.example.com", "example.com", ""},
+		"apex":    {"example.com.", "example.com", ""},
+		"longest": {"a.sub.example.com", "sub.example.com", ""},
+		"missing": {"test.example.org", "", "no zone found"},
+		"failure": {"a.fail.example.com", "", "lookup failure"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			zone, err := LookupZone(tt.fqdn, exists)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil || zone != tt.zone {
+				t.Fatalf("Expected zone %q, got %q (%v)", tt.zone, zone, err)
+			}
+		})
+	}
+}
+
+func TestRecordName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fqdn, zone, name string
+	}{
+		{"test.example.com", "example.com", "test"},
+		{"a.b.example.com.", "example.com", "a.b"},
+		{"example.com", "example.com", ""},
+	}
+	for _, tt := range tests {
+		if name := RecordName(tt.fqdn, tt.zone); name != tt.name {
+			t.Errorf("RecordName(%q, %q): expected %q, got %q", tt.fqdn, tt.zone, tt.name, name)
+		}
+	}
+}
+
+// fakeDNS serves on UDP and TCP the A and AAAA records of "test.example.com",
+// "big.example.com", whose UDP replies are truncated, "spoofed.example.com",
+// whose UDP replies follow a garbage datagram and a reply with a wrong ID,
+// and "edns.example.com", answered only to EDNS0 queries advertising a 1232
+// bytes payload size.
+func fakeDNS(t *testing.T) string {
+	t.Helper()
+
+	reply := func(req []byte, udp bool) []byte {
+		var msg dnsmessage.Message
+		if err := msg.Unpack(req); err != nil {
+			return nil
+		}
+		q := msg.Questions[0]
+		msg.Response = true
+		edns := false
+		for _, r := range msg.Additionals {
+			edns = edns || r.Header.Type == dnsmessage.TypeOPT && r.Header.Class >= 1232
+		}
+		switch q.Name.String() {
+		case "edns.example.com.":
+			if !edns {
+				msg.RCode = dnsmessage.RCodeFormatError
+				break
+			}
+			fallthrough
+		case "test.example.com.", "big.example.com.", "spoofed.example.com.":
+			hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 300}
+			if q.Type == dnsmessage.TypeA {
+				msg.Answers = []dnsmessage.Resource{{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{192, 168, 1, 1}}}}
+			} else if q.Type == dnsmessage.TypeAAAA {
+				hdr.TTL = 60
+				msg.Answers = []dnsmessage.Resource{{Header: hdr, Body: &dnsmessage.AAAAResource{
+					AAAA: netip.MustParseAddr("2001:db8::1").As16()}}}
+			}
+			if udp && q.Name.String() == "big.example.com." {
+				msg.Answers, msg.Truncated = nil, true
+			}
+		case "refused.example.com.":
+			msg.RCode = dnsmessage.RCodeRefused
+		default:
+			msg.RCode = dnsmessage.RCodeNameError
+		}
+		packed, _ := msg.Pack()
+		return packed
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Skipf("cannot listen on TCP %s: %v", pc.LocalAddr(), err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := reply(buf[:n], true)
+			if strings.Contains(string(buf[:n]), "spoofed") {
+				var msg dnsmessage.Message
+				msg.Unpack(resp)
+				msg.ID++
+				spoofed, _ := msg.Pack()
+				pc.WriteTo([]byte{0xde, 0xad}, addr)
+				pc.WriteTo(spoofed, addr)
+			}
+			pc.WriteTo(resp, addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var size [2]byte
+			io.ReadFull(conn, size[:])
+			req := make([]byte, binary.BigEndian.Uint16(size[:]))
+			io.ReadFull(conn, req)
+			resp := reply(req, false)
+			conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			conn.Close()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestLookupAddresses(t *testing.T) {
+	t.Parallel()
+
+	server := fakeDNS(t)
+	tests := map[string]struct {
+		fqdn     string
+		records  []Record
+		errorMsg string
+	}{
+		"ok":           {"test.example.com", []Record{{"A", "192.168.1.1", 300}, {"AAAA", "2001:db8::1", 60}}, ""},
+		"trailing_dot": {"test.example.com.", []Record{{"A", "192.168.1.1", 300}, {"AAAA", "2001:db8::1", 60}}, ""},
+		"truncated":    {"big.example.com", []Record{{"A", "192.168.1.1", 300}, {"AAAA", "2001:db8::1", 60}}, ""},
+		"id_mismatch":  {"spoofed.example.com", []Record{{"A", "192.168.1.1", 300}, {"AAAA", "2001:db8::1", 60}}, ""},
+		"edns0":        {"edns.example.com", []Record{{"A", "192.168.1.1", 300}, {"AAAA", "2001:db8::1", 60}}, ""},
+		"nxdomain":     {"none.example.com", nil, `cannot resolve "none.example.com": no such host`},
+		"refused":      {"refused.example.com", nil, `cannot resolve "refused.example.com": query refused`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			records, err := LookupAddresses(tt.fqdn, server)
+			if tt.errorMsg != "" {
+				if err == nil || err.Error() != tt.errorMsg {
+					t.Fatalf("Expected error %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(records, tt.records) {
+				t.Fatalf("Expected records %v, got %v", tt.records, records)
+			}
+		})
+	}
+}
+
+func TestResolveAll(t *testing.T) {
+	t.Parallel()
+
+	v4, _, err := ResolveAll("localhost")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.Contains(v4, "127.0.0.1") {
+		t.Errorf("Expected 127.0.0.1 among the localhost addresses, got %v", v4)
+	}
+
+	// not existing names have no addresses
+	v4, v6, err := ResolveAll("ddflare.invalid")
+	if err != nil || len(v4) != 0 || len(v6) != 0 {
+		t.Errorf("Expected no addresses and no error, got %v, %v, %v", v4, v6, err)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netwatch notifies the changes of the local network configuration
+// (addresses and routes), allowing to update the DNS records as soon as the
+// public address may have changed.
+package netwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnsupported is returned by Watch on the platforms where the network
+// changes cannot be monitored.
+var ErrUnsupported = errors.New("network change monitoring is not supported on this platform")
+
+// EventType is the kind of network change.
+type EventType int
+
+const (
+	AddressAdded EventType = iota
+	AddressRemoved
+	RouteAdded
+	RouteRemoved
+)
+
+func (t EventType) String() string {
+	switch t {
+	case AddressAdded:
+		return "address-added"
+	case AddressRemoved:
+		return "address-removed"
+	case RouteAdded:
+		return "route-added"
+	case RouteRemoved:
+		return "route-removed"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a network configuration change.
+type Event struct {
+	Type EventType
+	// Index is the index of the network interface involved, 0 if unknown.
+	Index int
+}
+
+// Debounce forwards the last of the events received from `in` only after no
+// other event was received for the `delay` duration, so that a burst of
+// changes (e.g., a PPPoE reconnection) triggers a single notification.
+// The returned channel is closed when `in` is closed or `ctx` is done.
+func Debounce(ctx context.Context, in <-chan Event, delay time.Duration) <-chan Event {
+	out := make(chan Event)
+
+	go func() {
+		defer close(out)
+		var (
+			last    Event
+			pending bool
+			timer   = time.NewTimer(delay)
+		)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-in:
+				if !ok {
+					return
+				}
+				last, pending = ev, true
+				timer.Reset(delay)
+			case <-timer.C:
+				if !pending {
+					continue
+				}
+				pending = false
+				select {
+				case out <- last:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
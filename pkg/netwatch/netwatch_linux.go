@@ -0,0 +1,139 @@
+//go:build linux
+
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/ddflare/ddflare/pkg/logging"
+)
+
+// groups are the rtnetlink multicast groups of the address and route
+// changes.
+var groups = []uint32{
+	syscall.RTNLGRP_IPV4_IFADDR,
+	syscall.RTNLGRP_IPV6_IFADDR,
+	syscall.RTNLGRP_IPV4_ROUTE,
+	syscall.RTNLGRP_IPV6_ROUTE,
+}
+
+// readTimeout bounds the blocking reads, so that the context cancellation
+// is noticed.
+var readTimeout = syscall.Timeval{Sec: 1}
+
+// Watch subscribes to the rtnetlink address and route change notifications
+// (RTM_NEWADDR, RTM_DELADDR, RTM_NEWROUTE and RTM_DELROUTE) and sends them on
+// the returned channel, which is closed when `ctx` is done.
+func Watch(ctx context.Context) (<-chan Event, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open netlink socket: %w", os.NewSyscallError("socket", err))
+	}
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	for _, g := range groups {
+		sa.Groups |= 1 << (g - 1)
+	}
+	if err = syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("cannot bind netlink socket: %w", os.NewSyscallError("bind", err))
+	}
+	tv := readTimeout
+	if err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("cannot set netlink socket timeout: %w", os.NewSyscallError("setsockopt", err))
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer syscall.Close(fd)
+
+		buf := make([]byte, os.Getpagesize()*4)
+		for ctx.Err() == nil {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+					continue
+				}
+				if errors.Is(err, syscall.ENOBUFS) {
+					// the kernel dropped notifications: something changed
+					send(ctx, events, Event{Type: AddressAdded})
+					continue
+				}
+				slog.Error("netlink socket read failed", logging.Error, err)
+				return
+			}
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				slog.Debug("cannot parse netlink message", logging.Error, err)
+				continue
+			}
+			for _, m := range msgs {
+				ev, ok := parseMessage(m)
+				if !ok {
+					continue
+				}
+				slog.Debug("network change detected", "type", ev.Type, "index", ev.Index)
+				if !send(ctx, events, ev) {
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func send(ctx context.Context, events chan<- Event, ev Event) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseMessage returns the Event of a rtnetlink notification, and false if
+// the message is not an address or route change.
+func parseMessage(m syscall.NetlinkMessage) (Event, bool) {
+	var ev Event
+	switch m.Header.Type {
+	case syscall.RTM_NEWADDR:
+		ev.Type = AddressAdded
+	case syscall.RTM_DELADDR:
+		ev.Type = AddressRemoved
+	case syscall.RTM_NEWROUTE:
+		return Event{Type: RouteAdded}, true
+	case syscall.RTM_DELROUTE:
+		return Event{Type: RouteRemoved}, true
+	default:
+		return ev, false
+	}
+	if len(m.Data) >= syscall.SizeofIfAddrmsg {
+		ifa := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		ev.Index = int(ifa.Index)
+	}
+	return ev, true
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netwatch
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		bursts   [][]Event
+		expected []Event
+	}{
+		"single": {
+			bursts:   [][]Event{{{Type: AddressAdded, Index: 1}}},
+			expected: []Event{{Type: AddressAdded, Index: 1}},
+		},
+		"burst": {
+			bursts: [][]Event{{
+				{Type: AddressRemoved, Index: 2},
+				{Type: RouteRemoved},
+				{Type: AddressAdded, Index: 3},
+			}},
+			expected: []Event{{Type: AddressAdded, Index: 3}},
+		},
+		"two_bursts": {
+			bursts: [][]Event{
+				{{Type: AddressRemoved, Index: 2}, {Type: RouteRemoved}},
+				{{Type: RouteAdded}},
+			},
+			expected: []Event{{Type: RouteRemoved}, {Type: RouteAdded}},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			in := make(chan Event)
+			out := Debounce(ctx, in, 50*time.Millisecond)
+
+			var got []Event
+			for _, burst := range tt.bursts {
+				for _, ev := range burst {
+					in <- ev
+				}
+				select {
+				case ev := <-out:
+					got = append(got, ev)
+				case <-time.After(time.Second):
+					t.Fatal("debounced event not received")
+				}
+			}
+			close(in)
+			if _, ok := <-out; ok {
+				t.Fatal("unexpected extra event")
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected events %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("Expected events %v, got %v", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDebounce_Cancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := Debounce(ctx, make(chan Event), time.Hour)
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("unexpected event")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed on context cancellation")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := Watch(ctx)
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("Expected ErrUnsupported, got %v", err)
+		}
+		cancel()
+		return
+	}
+	if err != nil {
+		t.Skipf("netlink socket not available: %v", err)
+	}
+	cancel()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("events channel not closed on context cancellation")
+		}
+	}
+}
+
+func TestEventType_String(t *testing.T) {
+	t.Parallel()
+
+	if s := AddressAdded.String(); s != "address-added" {
+		t.Errorf("Expected %q, got %q", "address-added", s)
+	}
+	if s := EventType(42).String(); s != "EventType(42)" {
+		t.Errorf("Expected %q, got %q", "EventType(42)", s)
+	}
+}
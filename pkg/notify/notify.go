@@ -0,0 +1,251 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends notifications about the DNS updates (address changes,
+// failures and recoveries) to messaging services.
+//
+// The services are configured via URLs, where the scheme selects the service
+// (see Parse). The notification title and body are Go text/templates
+// executed with the Message fields.
+package notify
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/logging"
+)
+
+// Event is the kind of notified update outcome.
+type Event string
+
+const (
+	// AddressChange is notified when the FQDN is updated to a new address.
+	AddressChange Event = "change"
+	// Failure is notified when the update fails.
+	Failure Event = "failure"
+	// Recovery is notified when an update succeeds after a failure.
+	Recovery Event = "recovery"
+)
+
+// Events lists all the notified events.
+var Events = []Event{AddressChange, Failure, Recovery}
+
+// Message holds the details of a notified event, available to the templates.
+type Message struct {
+	Event    Event
+	FQDN     string
+	OldIP    string
+	NewIP    string
+	Provider string
+	Error    string
+	Time     time.Time
+}
+
+// Notification is the message rendered for a Sender.
+type Notification struct {
+	Message
+	Title string
+	Body  string
+}
+
+// Sender delivers the notifications to a messaging service.
+type Sender interface {
+	Send(n Notification) error
+}
+
+const (
+	DefaultTitle = `ddflare: {{.FQDN}} {{if eq .Event "failure"}}update failed{{else if eq .Event "recovery"}}update recovered{{else}}updated{{end}}`
+	DefaultBody  = `{{if eq .Event "failure"}}Update of {{.FQDN}} to {{.NewIP}} via {{.Provider}} failed: {{.Error}}` +
+		`{{else if eq .Event "recovery"}}Update of {{.FQDN}} to {{.NewIP}} via {{.Provider}} succeeded again` +
+		`{{else}}{{.FQDN}} updated{{with .OldIP}} from {{.}}{{end}} to {{.NewIP}} via {{.Provider}}{{end}}`
+)
+
+// Config holds the Dispatcher settings.
+type Config struct {
+	// Events are the events to notify, all if empty.
+	Events []Event
+	// Title and Body are the templates of the notifications, DefaultTitle
+	// and DefaultBody if empty.
+	Title string
+	Body  string
+	// RateLimit is the minimum interval between two notifications: of the
+	// notifications in between only the last one is sent, at the end of the
+	// interval, the others are dropped and just counted. Zero disables the
+	// rate limiting.
+	RateLimit time.Duration
+}
+
+// Dispatcher renders the messages and sends them to all the senders.
+type Dispatcher struct {
+	senders   []Sender
+	events    map[Event]bool
+	title     *template.Template
+	body      *template.Template
+	rateLimit time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+	// pending is the last message delayed by the rate limit, sent by timer;
+	// suppressed counts the ones it replaced.
+	pending    *Message
+	suppressed int
+	timer      *time.Timer
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewDispatcher returns a Dispatcher sending the notifications configured by
+// `cfg` to the `senders`.
+func NewDispatcher(cfg Config, senders ...Sender) (*Dispatcher, error) {
+	d := &Dispatcher{
+		senders:   senders,
+		events:    make(map[Event]bool),
+		rateLimit: cfg.RateLimit,
+		now:       time.Now,
+	}
+
+	events := cfg.Events
+	if len(events) == 0 {
+		events = Events
+	}
+	for _, e := range events {
+		if e != AddressChange && e != Failure && e != Recovery {
+			return nil, fmt.Errorf("unknown notification event %q", e)
+		}
+		d.events[e] = true
+	}
+
+	var err error
+	if d.title, err = parseTemplate("title", cfg.Title, DefaultTitle); err != nil {
+		return nil, err
+	}
+	if d.body, err = parseTemplate("body", cfg.Body, DefaultBody); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func parseTemplate(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// ParseEvents parses a comma separated list of events.
+func ParseEvents(list string) ([]Event, error) {
+	var events []Event
+	for _, e := range strings.Split(list, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		switch ev := Event(e); ev {
+		case AddressChange, Failure, Recovery:
+			events = append(events, ev)
+		default:
+			return nil, fmt.Errorf("unknown notification event %q", e)
+		}
+	}
+	return events, nil
+}
+
+// Notify sends `msg` to all the senders, if its event is enabled. When rate
+// limited, only the last message received within the RateLimit interval is
+// sent, at its end. Delivery failures are logged.
+func (d *Dispatcher) Notify(msg Message) {
+	if !d.events[msg.Event] {
+		return
+	}
+	if msg.Time.IsZero() {
+		msg.Time = d.now()
+	}
+
+	d.mu.Lock()
+	now := d.now()
+	if wait := d.last.Add(d.rateLimit).Sub(now); d.rateLimit > 0 && !d.last.IsZero() && wait > 0 {
+		if d.pending != nil {
+			d.suppressed++
+		}
+		d.pending = &msg
+		if d.timer == nil {
+			d.timer = time.AfterFunc(wait, d.flush)
+		}
+		d.mu.Unlock()
+		slog.Debug("notification delayed by rate limit", "event", msg.Event, logging.FQDN, msg.FQDN, "delay", wait)
+		return
+	}
+	d.last = now
+	d.mu.Unlock()
+
+	d.send(msg, 0)
+}
+
+// flush sends the last message delayed by the rate limit.
+func (d *Dispatcher) flush() {
+	d.mu.Lock()
+	msg, suppressed := d.pending, d.suppressed
+	d.pending, d.suppressed, d.timer = nil, 0, nil
+	d.last = d.now()
+	d.mu.Unlock()
+
+	if msg != nil {
+		d.send(*msg, suppressed)
+	}
+}
+
+func (d *Dispatcher) send(msg Message, suppressed int) {
+	log := slog.Default().With("event", msg.Event, logging.FQDN, msg.FQDN)
+	n, err := d.render(msg)
+	if err != nil {
+		log.Error("cannot render notification", logging.Error, err)
+		return
+	}
+	if suppressed > 0 {
+		n.Body += fmt.Sprintf("\n(%d previous notifications suppressed)", suppressed)
+	}
+	for _, s := range d.senders {
+		if err := s.Send(n); err != nil {
+			log.Error("notification failed", logging.Error, err)
+			continue
+		}
+		log.Debug("notification sent")
+	}
+}
+
+func (d *Dispatcher) render(msg Message) (Notification, error) {
+	n := Notification{Message: msg}
+	var buf strings.Builder
+	if err := d.title.Execute(&buf, msg); err != nil {
+		return n, fmt.Errorf("cannot render title template: %w", err)
+	}
+	n.Title = buf.String()
+	buf.Reset()
+	if err := d.body.Execute(&buf, msg); err != nil {
+		return n, fmt.Errorf("cannot render body template: %w", err)
+	}
+	n.Body = buf.String()
+	return n, nil
+}
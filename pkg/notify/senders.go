@@ -0,0 +1,218 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+const defaultUserAgent = "ddflare-notify-"
+
+// Parse returns the Sender configured by `rawURL`, where the scheme selects
+// the service:
+//   - "webhook://host/path": POSTs the message as a JSON object
+//   - "ntfy://[token@]host/topic": publishes to a ntfy topic
+//   - "gotify://host[/path]/apptoken": pushes a Gotify message
+//   - "slack://hooks.slack.com/services/...": posts to a Slack incoming webhook
+//   - "discord://discord.com/api/webhooks/...": posts to a Discord webhook
+//   - "smtp://[user:password@]host[:port]/?from=addr&to=addr[,addr]": sends an
+//     email, using STARTTLS when available ("smtps://" for implicit TLS)
+//
+// The HTTP based services are reached via HTTPS: the "+http" scheme suffix
+// (e.g., "ntfy+http://") selects plain HTTP.
+func Parse(rawURL string) (Sender, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification URL: %w", err)
+	}
+	service, transport, _ := strings.Cut(u.Scheme, "+")
+	if transport == "" {
+		transport = "https"
+	}
+	if transport != "https" && transport != "http" {
+		return nil, fmt.Errorf("invalid notification URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid notification URL: missing host")
+	}
+	endpoint := &url.URL{Scheme: transport, Host: u.Host, Path: u.Path, RawQuery: u.RawQuery}
+	client := httpClient{userAgent: defaultUserAgent + version.Version}
+
+	switch service {
+	case "webhook":
+		return &webhookSender{httpClient: client, endpoint: endpoint.String()}, nil
+	case "ntfy":
+		if strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("invalid ntfy URL: missing topic")
+		}
+		return &ntfySender{httpClient: client, endpoint: endpoint.String(), auth: u.User}, nil
+	case "gotify":
+		dir, token := splitLast(u.Path)
+		if token == "" {
+			return nil, fmt.Errorf("invalid gotify URL: missing application token")
+		}
+		endpoint.Path = dir + "/message"
+		endpoint.RawQuery = ""
+		return &gotifySender{httpClient: client, endpoint: endpoint.String(), token: token}, nil
+	case "slack":
+		return &chatSender{httpClient: client, endpoint: endpoint.String(), field: "text"}, nil
+	case "discord":
+		return &chatSender{httpClient: client, endpoint: endpoint.String(), field: "content"}, nil
+	case "smtp", "smtps":
+		if transport != "https" || strings.Contains(u.Scheme, "+") {
+			return nil, fmt.Errorf("invalid notification URL scheme %q", u.Scheme)
+		}
+		return newSMTPSender(u)
+	}
+	return nil, fmt.Errorf("unsupported notification service %q", service)
+}
+
+// splitLast splits the last element of the URL `path`.
+func splitLast(path string) (string, string) {
+	path = strings.TrimSuffix(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+1:]
+}
+
+type httpClient struct {
+	userAgent string
+}
+
+// post sends `body` to `endpoint` and checks the reply status.
+func (c httpClient) post(endpoint, contentType string, body []byte, header http.Header) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", c.userAgent)
+
+	hc := http.Client{Timeout: 30 * time.Second}
+	res, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("endpoint %q returned %d (%s) status: %s", req.URL.Host, res.StatusCode, res.Status, bytes.TrimSpace(reply))
+	}
+	return nil
+}
+
+func (c httpClient) postJSON(endpoint string, v any, header http.Header) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.post(endpoint, "application/json", body, header)
+}
+
+type webhookSender struct {
+	httpClient
+	endpoint string
+}
+
+func (s *webhookSender) Send(n Notification) error {
+	return s.postJSON(s.endpoint, struct {
+		Event    Event     `json:"event"`
+		FQDN     string    `json:"fqdn"`
+		OldIP    string    `json:"old_ip,omitempty"`
+		NewIP    string    `json:"new_ip,omitempty"`
+		Provider string    `json:"provider,omitempty"`
+		Error    string    `json:"error,omitempty"`
+		Time     time.Time `json:"time"`
+		Title    string    `json:"title"`
+		Message  string    `json:"message"`
+	}{n.Event, n.FQDN, n.OldIP, n.NewIP, n.Provider, n.Error, n.Time, n.Title, n.Body}, nil)
+}
+
+type ntfySender struct {
+	httpClient
+	endpoint string
+	auth     *url.Userinfo
+}
+
+func (s *ntfySender) Send(n Notification) error {
+	header := http.Header{}
+	header.Set("Title", n.Title)
+	if n.Event == Failure {
+		header.Set("Tags", "warning")
+		header.Set("Priority", "high")
+	}
+	if s.auth != nil {
+		if pass, ok := s.auth.Password(); ok {
+			header.Set("Authorization", "Basic "+basicAuth(s.auth.Username(), pass))
+		} else {
+			header.Set("Authorization", "Bearer "+s.auth.Username())
+		}
+	}
+	return s.post(s.endpoint, "text/plain; charset=utf-8", []byte(n.Body), header)
+}
+
+type gotifySender struct {
+	httpClient
+	endpoint string
+	token    string
+}
+
+func (s *gotifySender) Send(n Notification) error {
+	priority := 5
+	if n.Event == Failure {
+		priority = 8
+	}
+	header := http.Header{}
+	header.Set("X-Gotify-Key", s.token)
+	return s.postJSON(s.endpoint, map[string]any{
+		"title":    n.Title,
+		"message":  n.Body,
+		"priority": priority,
+	}, header)
+}
+
+// chatSender posts to the Slack and Discord incoming webhooks, which accept
+// a JSON object with the message in the `field` key.
+type chatSender struct {
+	httpClient
+	endpoint string
+	field    string
+}
+
+func (s *chatSender) Send(n Notification) error {
+	return s.postJSON(s.endpoint, map[string]string{s.field: n.Title + "\n" + n.Body}, nil)
+}
+
+func basicAuth(user, pass string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+}
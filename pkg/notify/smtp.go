@@ -0,0 +1,151 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds the whole SMTP session, from the connection to the
+// delivery of the message.
+const smtpTimeout = 30 * time.Second
+
+type smtpSender struct {
+	addr     string
+	host     string
+	implicit bool
+	auth     smtp.Auth
+	from     string
+	to       []string
+	timeout  time.Duration
+}
+
+func newSMTPSender(u *url.URL) (*smtpSender, error) {
+	s := &smtpSender{host: u.Hostname(), implicit: u.Scheme == "smtps", timeout: smtpTimeout}
+	port := u.Port()
+	if port == "" {
+		port = "587"
+		if s.implicit {
+			port = "465"
+		}
+	}
+	s.addr = net.JoinHostPort(s.host, port)
+
+	q := u.Query()
+	from, err := mail.ParseAddress(q.Get("from"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp URL 'from' address: %w", err)
+	}
+	s.from = from.Address
+	to, err := mail.ParseAddressList(q.Get("to"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp URL 'to' addresses: %w", err)
+	}
+	for _, a := range to {
+		s.to = append(s.to, a.Address)
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		s.auth = smtp.PlainAuth("", u.User.Username(), pass, s.host)
+	}
+	return s, nil
+}
+
+func (s *smtpSender) Send(n Notification) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	body := base64.StdEncoding.EncodeToString([]byte(n.Body))
+	for len(body) > 76 {
+		msg.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	msg.WriteString(body + "\r\n")
+
+	dialer := &net.Dialer{Timeout: s.timeout}
+	tlsConf := &tls.Config{ServerName: s.host}
+	var conn net.Conn
+	var err error
+	if s.implicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", s.addr, err)
+	}
+	if err = conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("connection to %s failed: %w", s.addr, err)
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("connection to %s failed: %w", s.addr, err)
+	}
+	defer c.Close()
+	if !s.implicit {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(tlsConf); err != nil {
+				return fmt.Errorf("connection to %s failed: %w", s.addr, err)
+			}
+		}
+	}
+	if err = s.deliver(c, msg.Bytes()); err != nil {
+		return fmt.Errorf("cannot send email via %s: %w", s.addr, err)
+	}
+	return c.Quit()
+}
+
+func (s *smtpSender) deliver(c *smtp.Client, msg []byte) error {
+	if s.auth != nil {
+		if err := c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,356 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ovh implements a DNSManager for OVHcloud DNS zones.
+//
+// Two modes are supported: "api" (the default) uses the OVHcloud API
+// specified at https://eu.api.ovh.com/console/ , authenticating with an
+// application key, an application secret and a consumer key; "dynhost"
+// uses the DynHost service, which speaks the DynDNS update protocol.
+package ovh
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/dyn"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/tracing"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager     = (*Client)(nil)
+	_ ddman.Configurable   = (*Client)(nil)
+	_ ddman.ContextUpdater = (*Client)(nil)
+	_ ddman.Planner        = (*Client)(nil)
+)
+
+const (
+	// ModeAPI selects the OVHcloud API to update the DNS zone records.
+	ModeAPI = "api"
+	// ModeDynHost selects the DynHost service (DynDNS update protocol).
+	ModeDynHost = "dynhost"
+	// DynHostEndpoint is the default endpoint of the DynHost service.
+	DynHostEndpoint = "https://www.ovh.com"
+
+	defaultAPIEP     = "https://eu.api.ovh.com/1.0"
+	defaultUserAgent = "ddflare-ovh-"
+)
+
+type Client struct {
+	// endpoint is the user configured endpoint: when empty the default
+	// endpoint of the selected mode is used.
+	endpoint  string
+	userAgent string
+	mode      string
+	appSecret string
+	consumer  string
+	// timeDelta is the difference between the API server and the local clock.
+	timeDelta  time.Duration
+	timeSynced bool
+	dynhost    *dyn.Client
+	// API sends the signed requests, unsigned the ones not requiring
+	// authentication (i.e., the server time retrieval).
+	*restapi.API
+	unsigned *restapi.API
+}
+
+type record struct {
+	ID        int64  `json:"id,omitempty"`
+	FieldType string `json:"fieldType,omitempty"`
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int    `json:"ttl"`
+}
+
+// NewWithEndpoint initializes a new OVHcloud client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+		mode:      ModeAPI,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint("")
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	switch {
+	case c.endpoint != "":
+		return c.endpoint
+	case c.mode == ModeDynHost:
+		return DynHostEndpoint
+	default:
+		return defaultAPIEP
+	}
+}
+
+// SetApiEndpoint sets the API EndPoint, also of the DynHost client.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+	if c.dynhost != nil {
+		c.dynhost.SetApiEndpoint(c.GetApiEndpoint())
+	}
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+		c.unsigned.SetUserAgent(ua)
+	}
+	if c.dynhost != nil {
+		c.dynhost.SetUserAgent(ua)
+	}
+}
+
+// SetOption sets the OVHcloud specific options. The only option supported
+// is "mode", either ModeAPI (the default) or ModeDynHost.
+func (c *Client) SetOption(key, value string) error {
+	switch key {
+	case "mode":
+		if value != ModeAPI && value != ModeDynHost {
+			return fmt.Errorf("invalid %q option %q: %q or %q expected", key, value, ModeAPI, ModeDynHost)
+		}
+		c.mode = value
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Init sets up the credentials used to authenticate the requests: in API
+// mode `auth` is "applicationKey:applicationSecret:consumerKey", in DynHost
+// mode it is the "login:password" pair of the DynHost identifier.
+func (c *Client) Init(auth string) error {
+	c.appSecret, c.consumer, c.dynhost, c.API, c.unsigned = "", "", nil, nil, nil
+	if c.mode == ModeDynHost {
+		client := dyn.NewWithEndpoint(c.GetApiEndpoint())
+		client.SetUserAgent(c.userAgent)
+		if err := client.Init(auth); err != nil {
+			return err
+		}
+		c.dynhost = client
+		return nil
+	}
+
+	parts := strings.Split(auth, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("cannot initialize OVHcloud client: 'applicationKey:applicationSecret:consumerKey' credentials expected")
+	}
+	api, err := restapi.New(c.GetApiEndpoint(), c.userAgent, http.Header{
+		"X-Ovh-Application": {parts[0]},
+		"X-Ovh-Consumer":    {parts[2]},
+	})
+	if err != nil {
+		return err
+	}
+	api.Authorize = c.sign
+	if c.unsigned, err = restapi.New(c.GetApiEndpoint(), c.userAgent, nil); err != nil {
+		return err
+	}
+	c.appSecret, c.consumer = parts[1], parts[2]
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// In API mode `ip` may contain both an IPv4 and an IPv6 address, comma
+// separated: the A and AAAA records are updated, or created if missing, and
+// the zone is refreshed to apply the changes.
+func (c *Client) Update(fqdn, ip string) error {
+	return c.UpdateContext(context.Background(), fqdn, ip)
+}
+
+// UpdateContext is Update(), tracing the DynHost request, or each API call,
+// as a child of the span in `ctx`.
+func (c *Client) UpdateContext(ctx context.Context, fqdn, ip string) error {
+	if c.dynhost != nil {
+		return c.dynhost.UpdateContext(ctx, fqdn, ip)
+	}
+	recs, err := c.records(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	if err = recs.Upsert(ip); err != nil {
+		return err
+	}
+
+	refreshCtx, span := tracing.Start(ctx, "ovh.zone_refresh", tracing.Zone.String(recs.Zone))
+	err = c.do(refreshCtx, "POST", "/domain/zone/"+url.PathEscape(recs.Zone)+"/refresh", nil, nil)
+	tracing.End(span, err)
+	if err != nil {
+		return fmt.Errorf("zone refresh failed: %w", err)
+	}
+	slog.Debug("zone refreshed", logging.Endpoint, c.GetApiEndpoint(), "zone", recs.Zone)
+	return nil
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records. The
+// DynHost endpoint does not expose the records: in DynHost mode the current
+// addresses are resolved via DNS.
+func (c *Client) Plan(ctx context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	if c.dynhost != nil {
+		return ddman.ResolvePlan(fqdn, ip, nil)
+	}
+	recs, err := c.records(ctx, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(fqdn, ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records,
+// tracing each API call as a child of the span in `ctx`.
+func (c *Client) records(ctx context.Context, fqdn string) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.GetApiEndpoint(), logging.FQDN, fqdn)
+
+	zone, err := c.getZone(ctx, fqdn)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	sub := net.RecordName(fqdn, zone)
+	log.Debug("DNS zone found", "zone", zone, "subdomain", sub)
+	zonePath := "/domain/zone/" + url.PathEscape(zone)
+
+	return restapi.Records[record]{
+		Find: func(rType string) (_ []record, err error) {
+			listCtx, span := tracing.Start(ctx, "ovh.record_list", tracing.FQDN.String(fqdn))
+			defer func() { tracing.End(span, err) }()
+			q := url.Values{}
+			q.Set("fieldType", rType)
+			q.Set("subDomain", sub)
+			var ids []int64
+			if err = c.do(listCtx, "GET", zonePath+"/record?"+q.Encode(), nil, &ids); err != nil {
+				return nil, err
+			}
+			found := make([]record, len(ids))
+			for i, id := range ids {
+				if err = c.do(listCtx, "GET", zonePath+"/record/"+strconv.FormatInt(id, 10), nil, &found[i]); err != nil {
+					return nil, err
+				}
+				log.Debug("record found", "data", found[i])
+			}
+			return found, nil
+		},
+		Create: func(rType string, addrs []string) (err error) {
+			createCtx, span := tracing.Start(ctx, "ovh.record_create", tracing.FQDN.String(fqdn), tracing.IP.String(addrs[0]))
+			defer func() { tracing.End(span, err) }()
+			want := record{FieldType: rType, SubDomain: sub, Target: addrs[0]}
+			if err = c.do(createCtx, "POST", zonePath+"/record", want, nil); err != nil {
+				return err
+			}
+			log.Debug("record created", "data", want)
+			return nil
+		},
+		Update: func(_ string, found []record, addrs []string) (err error) {
+			updateCtx, span := tracing.Start(ctx, "ovh.record_update", tracing.FQDN.String(fqdn), tracing.IP.String(addrs[0]))
+			defer func() { tracing.End(span, err) }()
+			want := record{SubDomain: sub, Target: addrs[0], TTL: found[0].TTL}
+			if err = c.do(updateCtx, "PUT", zonePath+"/record/"+strconv.FormatInt(found[0].ID, 10), want, nil); err != nil {
+				return err
+			}
+			log.Debug("record updated", "data", want)
+			return nil
+		},
+		Single:    true,
+		Addresses: func(r record) []string { return []string{r.Target} },
+		Zone:      zone,
+	}, nil
+}
+
+// getZone returns the OVHcloud DNS zone hosting `fqdn`.
+func (c *Client) getZone(ctx context.Context, fqdn string) (zone string, err error) {
+	ctx, span := tracing.Start(ctx, "ovh.zone_lookup", tracing.FQDN.String(fqdn))
+	defer func() {
+		span.SetAttributes(tracing.Zone.String(zone))
+		tracing.End(span, err)
+	}()
+	var zones []string
+	if err = c.do(ctx, "GET", "/domain/zone", nil, &zones); err != nil {
+		return "", err
+	}
+	return net.LookupZone(fqdn, func(name string) (bool, error) {
+		return slices.Contains(zones, name), nil
+	})
+}
+
+// syncTime retrieves the API server time to compute the timestamp of the
+// signed requests, as the local clock may drift.
+func (c *Client) syncTime(ctx context.Context) error {
+	if c.timeSynced {
+		return nil
+	}
+	var serverTime int64
+	if err := c.unsigned.DoContext(ctx, "GET", "/auth/time", nil, &serverTime); err != nil {
+		return fmt.Errorf("cannot retrieve API server time: %w", err)
+	}
+	c.timeDelta = time.Unix(serverTime, 0).Sub(time.Now())
+	c.timeSynced = true
+	return nil
+}
+
+// sign adds the timestamp and the signature headers to the API requests.
+func (c *Client) sign(req *http.Request, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Add(c.timeDelta).Unix(), 10)
+	sum := sha1.Sum([]byte(strings.Join([]string{c.appSecret, c.consumer, req.Method, req.URL.String(), string(body), timestamp}, "+")))
+	req.Header.Set("X-Ovh-Timestamp", timestamp)
+	req.Header.Set("X-Ovh-Signature", "$1$"+hex.EncodeToString(sum[:]))
+	return nil
+}
+
+// do sends the signed request to the `path` API (see restapi.API.DoContext()),
+// after retrieving the API server time if not done yet.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	if err := c.syncTime(ctx); err != nil {
+		return err
+	}
+	return c.DoContext(ctx, method, path, in, out)
+}
@@ -0,0 +1,449 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ovh
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/version"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+
+	if err := client.SetOption("mode", ModeDynHost); err != nil {
+		t.Fatalf("unexpected SetOption failure: %v", err)
+	}
+	if client.GetApiEndpoint() != DynHostEndpoint {
+		t.Errorf("Expected DynHost endpoint %q, got %q", DynHostEndpoint, client.GetApiEndpoint())
+	}
+	client.SetApiEndpoint("https://dns.eu.ovhapis.com")
+	if client.GetApiEndpoint() != "https://dns.eu.ovhapis.com" {
+		t.Errorf("Expected custom endpoint, got %q", client.GetApiEndpoint())
+	}
+
+	if err := client.SetOption("mode", "dyndns"); err == nil {
+		t.Error("Expected SetOption failure with an invalid mode")
+	}
+	if err := client.SetOption("region", "eu"); err == nil {
+		t.Error("Expected SetOption failure with an unknown option")
+	}
+}
+
+func TestClient_Init(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		auth  string
+		fails bool
+	}{
+		"valid":            {"ak:as:ck", false},
+		"empty":            {"", true},
+		"missing_consumer": {"ak:as", true},
+		"empty_consumer":   {"ak:as:", true},
+		"too_many_fields":  {"ak:as:ck:x", true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := New().Init(tt.auth)
+			if tt.fails != (err != nil) {
+				t.Fatalf("unexpected Init result with auth %q: %v", tt.auth, err)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateNotAuthorized(t *testing.T) {
+	t.Parallel()
+
+	err := New().Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+type request struct {
+	method string
+	path   string
+	rec    record
+}
+
+type ovhStub struct {
+	*httptest.Server
+	t        *testing.T
+	skew     time.Duration
+	requests []request
+}
+
+// newOVHStub returns a fake OVHcloud API endpoint whose clock is `skew`
+// ahead of the local one. The account owns the "example.com" and the empty
+// "example.net" zones: the first one contains the A record 1 with TTL 60 for
+// "test" and two AAAA records for "multi".
+func newOVHStub(t *testing.T, skew time.Duration) *ovhStub {
+	stub := &ovhStub{t: t, skew: skew}
+	stub.Server = httptest.NewServer(http.HandlerFunc(stub.serveHTTP))
+	return stub
+}
+
+func (s *ovhStub) reply(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"class": "Client::Error", "message": %q}`, msg)
+}
+
+func (s *ovhStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	t := s.t
+	now := time.Now().Add(s.skew).Unix()
+	if r.URL.Path == "/auth/time" {
+		fmt.Fprint(w, now)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	ts := r.Header.Get("X-Ovh-Timestamp")
+	sum := sha1.Sum([]byte("as+ck+" + r.Method + "+" + s.URL + r.URL.RequestURI() + "+" + string(body) + "+" + ts))
+	if r.Header.Get("X-Ovh-Application") != "ak" || r.Header.Get("X-Ovh-Consumer") != "ck" ||
+		r.Header.Get("X-Ovh-Signature") != "$1$"+hex.EncodeToString(sum[:]) {
+		s.reply(w, http.StatusBadRequest, "Invalid signature")
+		return
+	}
+	if reqTime, err := strconv.ParseInt(ts, 10, 64); err != nil || reqTime < now-5 || reqTime > now+5 {
+		s.reply(w, http.StatusBadRequest, "Query out of time")
+		return
+	}
+
+	q := r.URL.Query()
+	switch path := r.URL.Path; {
+	case r.Method == "GET" && path == "/domain/zone":
+		w.Write([]byte(`["example.com", "example.net"]`))
+	case r.Method == "GET" && strings.HasSuffix(path, "/record"):
+		switch q.Get("fieldType") + " " + q.Get("subDomain") {
+		case "A test":
+			w.Write([]byte(`[1]`))
+		case "AAAA multi":
+			w.Write([]byte(`[2, 3]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	case r.Method == "GET" && path == "/domain/zone/example.com/record/1":
+		w.Write([]byte(`{"id": 1, "zone": "example.com", "fieldType": "A", "subDomain": "test", "target": "10.0.0.1", "ttl": 60}`))
+	case r.Method == "GET" && (path == "/domain/zone/example.com/record/2" || path == "/domain/zone/example.com/record/3"):
+		id := strings.TrimPrefix(path, "/domain/zone/example.com/record/")
+		fmt.Fprintf(w, `{"id": %s, "zone": "example.com", "fieldType": "AAAA", "subDomain": "multi", "target": "2001:db8::%s", "ttl": 0}`, id, id)
+	case r.Method == "POST" && strings.HasSuffix(path, "/refresh"):
+		s.requests = append(s.requests, request{r.Method, path, record{}})
+		w.Write([]byte(`null`))
+	case r.Method == "POST" || r.Method == "PUT":
+		var rec record
+		if err := json.Unmarshal(body, &rec); err != nil {
+			t.Errorf("cannot decode %s body: %v", r.Method, err)
+		}
+		s.requests = append(s.requests, request{r.Method, path, rec})
+		w.Write([]byte(`null`))
+	default:
+		s.reply(w, http.StatusNotFound, "This call has not been granted")
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		auth     string
+		skew     time.Duration
+		expected []request
+		errorMsg string
+	}{
+		"update": {
+			fqdn: "test.example.com",
+			ip:   "192.168.1.1",
+			auth: "ak:as:ck",
+			expected: []request{
+				{"PUT", "/domain/zone/example.com/record/1", record{SubDomain: "test", Target: "192.168.1.1", TTL: 60}},
+				{"POST", "/domain/zone/example.com/refresh", record{}},
+			},
+		},
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			auth: "ak:as:ck",
+			skew: time.Hour,
+			expected: []request{
+				{"PUT", "/domain/zone/example.com/record/1", record{SubDomain: "test", Target: "192.168.1.1", TTL: 60}},
+				{"POST", "/domain/zone/example.com/record", record{FieldType: "AAAA", SubDomain: "test", Target: "2001:db8::1"}},
+				{"POST", "/domain/zone/example.com/refresh", record{}},
+			},
+		},
+		"apex": {
+			fqdn: "example.net",
+			ip:   "192.168.1.1",
+			auth: "ak:as:ck",
+			skew: -time.Hour,
+			expected: []request{
+				{"POST", "/domain/zone/example.net/record", record{FieldType: "A", Target: "192.168.1.1"}},
+				{"POST", "/domain/zone/example.net/refresh", record{}},
+			},
+		},
+		"multiple_records": {
+			fqdn:     "multi.example.com",
+			ip:       "2001:db8::1",
+			auth:     "ak:as:ck",
+			errorMsg: "found 2 matching AAAA records",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			auth:     "ak:as:ck",
+			errorMsg: "no zone found",
+		},
+		"bad_secret": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			auth:     "ak:wrong:ck",
+			errorMsg: "Invalid signature",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := newOVHStub(t, tt.skew)
+			defer stub.Close()
+
+			client := NewWithEndpoint(stub.URL)
+			if err := client.Init(tt.auth); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(stub.requests) != 0 {
+					t.Fatalf("Expected no updates, got %+v", stub.requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(stub.requests, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, stub.requests)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateContextTracing(t *testing.T) {
+	stub := newOVHStub(t, 0)
+	t.Cleanup(stub.Close)
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	client := NewWithEndpoint(stub.URL)
+	if err := client.Init("ak:as:ck"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	if err := client.UpdateContext(ctx, "test.example.com", "192.168.1.1"); err != nil {
+		t.Fatalf("unexpected UpdateContext failure: %v", err)
+	}
+	root.End()
+
+	// each step is a child of the root span, wrapping its API calls
+	expected := []string{"ovh.zone_lookup", "ovh.record_list", "ovh.record_update", "ovh.zone_refresh"}
+	var steps []string
+	for _, s := range exp.GetSpans() {
+		if strings.HasPrefix(s.Name, "ovh.") {
+			if s.Parent.SpanID() != root.SpanContext().SpanID() {
+				t.Errorf("Expected span %q to be child of the root span", s.Name)
+			}
+			steps = append(steps, s.Name)
+		}
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("Expected spans %v, got %v", expected, steps)
+	}
+	var calls int
+	for _, s := range exp.GetSpans() {
+		if s.Name == http.MethodGet || s.Name == http.MethodPut || s.Name == http.MethodPost {
+			calls++
+		}
+	}
+	if calls == 0 {
+		t.Error("Expected the API calls to be traced")
+	}
+}
+
+func TestClient_UpdateDynHost(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if r.URL.Path != "/nic/update" || !ok || user != "example.com-user" || pass != "secret" {
+			w.Write([]byte("badauth"))
+			return
+		}
+		w.Write([]byte("good " + r.URL.Query().Get("myip")))
+	}))
+	defer server.Close()
+
+	client := NewWithEndpoint(server.URL)
+	if err := client.SetOption("mode", ModeDynHost); err != nil {
+		t.Fatalf("unexpected SetOption failure: %v", err)
+	}
+	if err := client.Init("example.com-user:secret"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	if err := client.Update("test.example.com", "192.168.1.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the endpoint and user agent set after Init apply to the DynHost client
+	var agent string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.Header.Get("User-Agent")
+		w.Write([]byte("good " + r.URL.Query().Get("myip")))
+	}))
+	defer other.Close()
+	client.SetApiEndpoint(other.URL)
+	client.SetUserAgent("custom-agent")
+	if err := client.Update("test.example.com", "192.168.1.2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if agent != "custom-agent" {
+		t.Errorf("Expected user agent %q at the new endpoint, got %q", "custom-agent", agent)
+	}
+
+	client.SetApiEndpoint(server.URL)
+	if err := client.Init("example.com-user:wrong"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	if err := client.Update("test.example.com", "192.168.1.1"); err == nil {
+		t.Fatal("Expected update failure with wrong credentials")
+	}
+
+	// the DynHost endpoint is not queried by the plans
+	changes, err := client.Plan(context.Background(), "localhost", "127.0.0.1")
+	expected := []ddman.RecordChange{{Name: "localhost", Type: "A", Old: "127.0.0.1", New: "127.0.0.1",
+		Attributes: map[string]string{"lookup": ddman.LookupDNS}}}
+	if err != nil || !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %+v, got %+v (%v)", expected, changes, err)
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"multiple_records": {
+			fqdn:     "multi.example.com",
+			ip:       "2001:db8::3",
+			errorMsg: "found 2 matching AAAA records",
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stub := newOVHStub(t, 0)
+			defer stub.Close()
+
+			client := NewWithEndpoint(stub.URL)
+			if err := client.Init("ak:as:ck"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(stub.requests) != 0 {
+				t.Errorf("Expected no updates, got %+v", stub.requests)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements a DNSManager delegating the DNS operations to an
+// external executable, allowing to add DNS backends without changing ddflare.
+//
+// The executable is spawned for each operation: it receives a Request JSON
+// object on the standard input and must write a Response JSON object on the
+// standard output, then exit. The standard error is logged at debug level.
+// The supported actions are:
+//   - "capabilities": report the plugin Capabilities
+//   - "init": validate the auth credential and the options
+//   - "resolve": return the IP address of the FQDN (if supported)
+//   - "update": update the FQDN to the IP address
+//
+// Plugins must reply to unknown actions with an error.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager   = (*Client)(nil)
+	_ ddman.Configurable = (*Client)(nil)
+)
+
+const (
+	// ProtocolVersion is the version of the JSON protocol spoken with the
+	// plugins.
+	ProtocolVersion = 1
+
+	ActionCapabilities = "capabilities"
+	ActionInit         = "init"
+	ActionResolve      = "resolve"
+	ActionUpdate       = "update"
+
+	defaultUserAgent = "ddflare-plugin-"
+	defaultTimeout   = 30 * time.Second
+)
+
+// Request is the JSON message sent to the plugin standard input.
+type Request struct {
+	Version   int               `json:"version"`
+	Action    string            `json:"action"`
+	Auth      string            `json:"auth,omitempty"`
+	Options   map[string]string `json:"options,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	FQDN      string            `json:"fqdn,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+}
+
+// Response is the JSON message expected on the plugin standard output.
+type Response struct {
+	Version      int           `json:"version"`
+	OK           bool          `json:"ok"`
+	Error        string        `json:"error,omitempty"`
+	IP           string        `json:"ip,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// Capabilities describes the features supported by the plugin.
+type Capabilities struct {
+	// Resolve is true if the plugin implements the "resolve" action: if not,
+	// the local resolver is used.
+	Resolve bool `json:"resolve"`
+	// RecordTypes lists the supported record types ("A", "AAAA").
+	RecordTypes []string `json:"record_types"`
+	// MultipleAddresses is true if the plugin accepts comma separated lists
+	// of addresses.
+	MultipleAddresses bool `json:"multiple_addresses"`
+}
+
+type Client struct {
+	// endpoint is the path of the plugin executable.
+	endpoint  string
+	userAgent string
+	args      []string
+	timeout   time.Duration
+	options   map[string]string
+	auth      string
+	caps      *Capabilities
+}
+
+// NewWithEndpoint initializes a new plugin client which runs the 'endpoint'
+// executable.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+		timeout:   defaultTimeout,
+		options:   map[string]string{},
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint("")
+}
+
+// GetApiEndpoint returns the path of the plugin executable.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the path of the plugin executable.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// SetOption sets the plugin options:
+//   - "arg": a command line argument of the executable (can be repeated)
+//   - "timeout": the maximum duration of each plugin run (30s by default)
+//
+// Any other option is passed to the plugin in the requests.
+func (c *Client) SetOption(key, value string) error {
+	switch key {
+	case "arg":
+		c.args = append(c.args, value)
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid %q option %q: positive duration expected", key, value)
+		}
+		c.timeout = d
+	default:
+		c.options[key] = value
+	}
+	return nil
+}
+
+// Init retrieves the plugin capabilities and asks the plugin to validate the
+// auth credential and the options.
+func (c *Client) Init(auth string) error {
+	c.caps = nil
+	if c.endpoint == "" {
+		return fmt.Errorf("cannot initialize plugin client: missing executable endpoint")
+	}
+
+	resp, err := c.run(Request{Action: ActionCapabilities})
+	if err != nil {
+		return fmt.Errorf("cannot retrieve plugin capabilities: %w", err)
+	}
+	if resp.Capabilities == nil {
+		return fmt.Errorf("cannot retrieve plugin capabilities: missing capabilities in reply")
+	}
+	if _, err = c.run(Request{Action: ActionInit, Auth: auth}); err != nil {
+		return fmt.Errorf("plugin initialization failed: %w", err)
+	}
+	c.auth, c.caps = auth, resp.Capabilities
+	slog.Debug("plugin initialized", logging.Endpoint, c.endpoint, "capabilities", *c.caps)
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter, asking the plugin if it supports the "resolve" action.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	if c.caps == nil || !c.caps.Resolve {
+		return net.Resolve(fqdn)
+	}
+	resp, err := c.run(Request{Action: ActionResolve, Auth: c.auth, FQDN: fqdn})
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %q: %w", fqdn, err)
+	}
+	return resp.IP, nil
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter,
+// checking the address families and count against the plugin capabilities.
+func (c *Client) Update(fqdn, ip string) error {
+	if c.caps == nil {
+		return fmt.Errorf("not authorized")
+	}
+
+	v4, v6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return err
+	}
+	if !c.caps.MultipleAddresses && len(v4)+len(v6) > 1 {
+		return fmt.Errorf("plugin does not support multiple addresses")
+	}
+	for _, rType := range []string{"A", "AAAA"} {
+		addrs := v4
+		if rType == "AAAA" {
+			addrs = v6
+		}
+		if len(addrs) > 0 && !c.supports(rType) {
+			return fmt.Errorf("plugin does not support %s records", rType)
+		}
+	}
+
+	if _, err = c.run(Request{Action: ActionUpdate, Auth: c.auth, FQDN: fqdn, IP: ip}); err != nil {
+		return fmt.Errorf("plugin update failed: %w", err)
+	}
+	slog.Debug("record updated", logging.Endpoint, c.endpoint, logging.FQDN, fqdn, logging.IP, ip)
+	return nil
+}
+
+func (c *Client) supports(rType string) bool {
+	for _, t := range c.caps.RecordTypes {
+		if strings.EqualFold(t, rType) {
+			return true
+		}
+	}
+	return false
+}
+
+// run spawns the plugin, sends the request and decodes the reply.
+func (c *Client) run(req Request) (*Response, error) {
+	req.Version = ProtocolVersion
+	req.UserAgent = c.userAgent
+	if len(c.options) > 0 {
+		req.Options = c.options
+	}
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	log := slog.Default().With(logging.Endpoint, c.endpoint, "action", req.Action)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.endpoint, c.args...)
+	cmd.Stdin = bytes.NewReader(in)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err = cmd.Run()
+	if stderr.Len() > 0 {
+		log.Debug("plugin stderr", "output", strings.TrimSpace(stderr.String()))
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("plugin %q timed out after %s", c.endpoint, c.timeout)
+	}
+
+	var resp Response
+	if decErr := json.Unmarshal(stdout.Bytes(), &resp); decErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q failed: %w", c.endpoint, err)
+		}
+		return nil, fmt.Errorf("cannot decode plugin %q reply: %w", c.endpoint, decErr)
+	}
+	if resp.Version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported plugin protocol version %d (%d expected)", resp.Version, ProtocolVersion)
+	}
+	if !resp.OK {
+		if resp.Error == "" {
+			resp.Error = "unknown error"
+		}
+		return nil, fmt.Errorf("plugin error: %s", resp.Error)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plugin %q failed: %w", c.endpoint, err)
+	}
+	return &resp, nil
+}
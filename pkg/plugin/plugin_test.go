@@ -0,0 +1,230 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+const pluginEnv = "DDFLARE_TEST_PLUGIN"
+
+// TestMain runs the test binary as a plugin when pluginEnv is set: the plugin
+// behavior is selected by the "-mode" argument.
+func TestMain(m *testing.M) {
+	if os.Getenv(pluginEnv) != "" {
+		os.Exit(fakePlugin(os.Args[1:]))
+	}
+	os.Setenv(pluginEnv, "1")
+	os.Exit(m.Run())
+}
+
+func fakePlugin(args []string) int {
+	mode := "default"
+	for _, a := range args {
+		if m, ok := strings.CutPrefix(a, "-mode="); ok {
+			mode = m
+		}
+	}
+
+	var req Request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintln(os.Stderr, "bad request:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%s request\n", req.Action)
+
+	resp := Response{Version: ProtocolVersion, OK: true}
+	switch mode {
+	case "crash":
+		return 2
+	case "sleep":
+		time.Sleep(5 * time.Second)
+	case "version":
+		resp.Version = ProtocolVersion + 1
+	}
+
+	switch req.Action {
+	case ActionCapabilities:
+		resp.Capabilities = &Capabilities{RecordTypes: []string{"A"}}
+		if mode == "full" {
+			resp.Capabilities = &Capabilities{
+				Resolve:           true,
+				RecordTypes:       []string{"a", "aaaa"},
+				MultipleAddresses: true,
+			}
+		}
+	case ActionInit:
+		if req.Auth != "secret" {
+			resp.OK, resp.Error = false, "bad credentials"
+		}
+		if req.Options["zone"] == "invalid" {
+			resp.OK, resp.Error = false, "unknown zone"
+		}
+	case ActionResolve:
+		resp.IP = "10.0.0.1"
+	case ActionUpdate:
+		if req.FQDN != "test.example.com" {
+			resp.OK, resp.Error = false, "record not found"
+		}
+		if !strings.HasPrefix(req.UserAgent, defaultUserAgent) {
+			resp.OK, resp.Error = false, "unexpected user agent "+req.UserAgent
+		}
+	default:
+		resp.OK, resp.Error = false, "unknown action"
+	}
+	json.NewEncoder(os.Stdout).Encode(resp)
+	return 0
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != "" {
+		t.Errorf("Expected empty default endpoint, got %q", client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init("secret"); err == nil {
+		t.Error("Expected Init failure without executable")
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+	if err := client.SetOption("timeout", "soon"); err == nil {
+		t.Error("Expected SetOption failure with an invalid timeout")
+	}
+}
+
+func TestClient_Init(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		mode     string
+		auth     string
+		options  [][2]string
+		errorMsg string
+	}{
+		"ok":        {"default", "secret", nil, ""},
+		"bad_auth":  {"default", "wrong", nil, "bad credentials"},
+		"bad_opt":   {"default", "secret", [][2]string{{"zone", "invalid"}}, "unknown zone"},
+		"crash":     {"crash", "secret", nil, "exit status 2"},
+		"version":   {"version", "secret", nil, "unsupported plugin protocol version 2"},
+		"timeout":   {"sleep", "secret", [][2]string{{"timeout", "100ms"}}, "timed out after 100ms"},
+		"not_found": {"", "secret", nil, "plugin"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ep := os.Args[0]
+			if tt.mode == "" {
+				ep = "/nonexistent/ddflare-plugin"
+			}
+			client := NewWithEndpoint(ep)
+			for _, opt := range append([][2]string{{"arg", "-mode=" + tt.mode}}, tt.options...) {
+				if err := client.SetOption(opt[0], opt[1]); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+			err := client.Init(tt.auth)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		mode     string
+		fqdn     string
+		ip       string
+		errorMsg string
+	}{
+		"ok":            {"default", "test.example.com", "192.168.1.1", ""},
+		"plugin_error":  {"default", "other.example.com", "192.168.1.1", "record not found"},
+		"no_aaaa":       {"default", "test.example.com", "2001:db8::1", "does not support AAAA records"},
+		"no_multiple":   {"default", "test.example.com", "192.168.1.1,192.168.1.2", "does not support multiple addresses"},
+		"dual_stack":    {"full", "test.example.com", "192.168.1.1,2001:db8::1", ""},
+		"invalid_ip":    {"full", "test.example.com", "192.168.1", "192.168.1"},
+		"full_no_match": {"full", "other.example.com", "2001:db8::1", "record not found"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := NewWithEndpoint(os.Args[0])
+			if err := client.SetOption("arg", "-mode="+tt.mode); err != nil {
+				t.Fatalf("unexpected SetOption failure: %v", err)
+			}
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_Resolve(t *testing.T) {
+	t.Parallel()
+
+	client := NewWithEndpoint(os.Args[0])
+	if err := client.SetOption("arg", "-mode=full"); err != nil {
+		t.Fatalf("unexpected SetOption failure: %v", err)
+	}
+	if err := client.Init("secret"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	ip, err := client.Resolve("test.example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ip != "10.0.0.1" {
+		t.Fatalf("Expected resolved IP %q, got %q", "10.0.0.1", ip)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package porkbun implements a DNSManager for the Porkbun registrar DNS
+// service using the v3 JSON API specified at https://porkbun.com/api/json/v3/documentation .
+package porkbun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://api.porkbun.com/api/json/v3"
+	defaultUserAgent = "ddflare-porkbun-"
+	// pageSize is the number of domains returned by each listAll call.
+	pageSize = 1000
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	// the API keys are sent in the body of the requests
+	apiKey       string
+	secretAPIKey string
+	*restapi.API
+}
+
+type record struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	TTL     string `json:"ttl"`
+}
+
+// NewWithEndpoint initializes a new Porkbun client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the API keys passed in
+// the "apikey:secretapikey" form.
+func (c *Client) Init(auth string) error {
+	apiKey, secret, _ := strings.Cut(auth, ":")
+	if apiKey == "" || secret == "" {
+		return fmt.Errorf("cannot initialize Porkbun client: 'apikey:secretapikey' credentials expected")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, nil)
+	if err != nil {
+		return err
+	}
+	c.apiKey, c.secretAPIKey = apiKey, secret
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may contain both an IPv4 and an IPv6 address, comma separated: the
+// A and AAAA records are updated, or created if missing.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	domain, err := c.getDomain(fqdn)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	sub := net.RecordName(fqdn, domain)
+	log.Debug("DNS zone found", "zone", domain, "subdomain", sub)
+
+	nameType := func(rType string) string {
+		if sub == "" {
+			return url.PathEscape(domain) + "/" + rType
+		}
+		return url.PathEscape(domain) + "/" + rType + "/" + url.PathEscape(sub)
+	}
+	return restapi.Records[record]{
+		Find: func(rType string) ([]record, error) {
+			var current struct {
+				Records []record `json:"records"`
+			}
+			if err := c.do("/dns/retrieveByNameType/"+nameType(rType), nil, &current); err != nil {
+				return nil, err
+			}
+			for _, r := range current.Records {
+				log.Debug("record found", "data", r)
+			}
+			return current.Records, nil
+		},
+		Create: func(rType string, addrs []string) error {
+			req := map[string]string{"name": sub, "type": rType, "content": addrs[0]}
+			if err := c.do("/dns/create/"+url.PathEscape(domain), req, nil); err != nil {
+				return err
+			}
+			log.Debug("record created", "type", rType, "content", addrs[0])
+			return nil
+		},
+		Update: func(rType string, found []record, addrs []string) error {
+			req := map[string]string{"content": addrs[0], "ttl": found[0].TTL}
+			if err := c.do("/dns/editByNameType/"+nameType(rType), req, nil); err != nil {
+				return err
+			}
+			log.Debug("record updated", "type", rType, "content", addrs[0])
+			return nil
+		},
+		Single:    true,
+		Addresses: func(r record) []string { return []string{r.Content} },
+		Zone:      domain,
+	}, nil
+}
+
+// getDomain returns the domain of the account hosting `fqdn`.
+func (c *Client) getDomain(fqdn string) (string, error) {
+	domains := map[string]bool{}
+	for start := 0; ; start += pageSize {
+		var reply struct {
+			Domains []struct {
+				Domain string `json:"domain"`
+			} `json:"domains"`
+		}
+		if err := c.do("/domain/listAll", map[string]string{"start": strconv.Itoa(start)}, &reply); err != nil {
+			return "", err
+		}
+		for _, d := range reply.Domains {
+			domains[d.Domain] = true
+		}
+		if len(reply.Domains) < pageSize {
+			break
+		}
+	}
+	return net.LookupZone(fqdn, func(name string) (bool, error) {
+		return domains[name], nil
+	})
+}
+
+// do sends a POST request to the `path` API with the API keys and the `in`
+// fields in the JSON body, and decodes the JSON reply in `out` (if not nil).
+func (c *Client) do(path string, in map[string]string, out any) error {
+	payload := map[string]string{"apikey": c.apiKey, "secretapikey": c.secretAPIKey}
+	maps.Copy(payload, in)
+
+	var reply json.RawMessage
+	if err := c.Do("POST", path, payload, &reply); err != nil {
+		return err
+	}
+	var status struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(reply, &status); err != nil {
+		return fmt.Errorf("cannot decode endpoint %q reply: %w", c.endpoint, err)
+	}
+	if status.Status != "SUCCESS" {
+		return fmt.Errorf("API returned %s: %s", status.Status, status.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(reply, out); err != nil {
+		return fmt.Errorf("cannot decode endpoint %q reply: %w", c.endpoint, err)
+	}
+	return nil
+}
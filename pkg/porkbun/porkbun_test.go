@@ -0,0 +1,270 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package porkbun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+}
+
+func TestClient_Init(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		auth  string
+		fails bool
+	}{
+		"valid":          {"pk1_key:sk1_secret", false},
+		"empty":          {"", true},
+		"missing_secret": {"pk1_key", true},
+		"empty_secret":   {"pk1_key:", true},
+		"empty_key":      {":sk1_secret", true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := New().Init(tt.auth)
+			if tt.fails != (err != nil) {
+				t.Fatalf("unexpected Init result with auth %q: %v", tt.auth, err)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateNotAuthorized(t *testing.T) {
+	t.Parallel()
+
+	err := New().Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+type request struct {
+	path string
+	body map[string]string
+}
+
+// newPorkbunStub returns a fake Porkbun API endpoint. The account owns the
+// "example.com" domain, which has an A record with TTL 600 for "test".
+func newPorkbunStub(t *testing.T, requests *[]request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("cannot decode request body: %v", err)
+		}
+		if body["apikey"] != "pk1_key" || body["secretapikey"] != "sk1_secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": "ERROR", "message": "Invalid API key. (002)"}`))
+			return
+		}
+		delete(body, "apikey")
+		delete(body, "secretapikey")
+
+		switch path := r.URL.Path; {
+		case path == "/domain/listAll":
+			w.Write([]byte(`{"status": "SUCCESS", "domains": [{"domain": "example.com"}, {"domain": "example.net"}]}`))
+		case path == "/dns/retrieveByNameType/example.com/A/test":
+			w.Write([]byte(`{"status": "SUCCESS", "records": [{"id": "1", "name": "test.example.com", "type": "A", "content": "10.0.0.1", "ttl": "600"}]}`))
+		case strings.HasPrefix(path, "/dns/retrieveByNameType/"):
+			w.Write([]byte(`{"status": "SUCCESS", "records": []}`))
+		case strings.HasPrefix(path, "/dns/create/"), strings.HasPrefix(path, "/dns/editByNameType/"):
+			*requests = append(*requests, request{path, body})
+			w.Write([]byte(`{"status": "SUCCESS"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status": "ERROR", "message": "Invalid endpoint."}`))
+		}
+	}))
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		auth     string
+		expected []request
+		errorMsg string
+	}{
+		"edit": {
+			fqdn: "test.example.com",
+			ip:   "192.168.1.1",
+			auth: "pk1_key:sk1_secret",
+			expected: []request{
+				{"/dns/editByNameType/example.com/A/test", map[string]string{"content": "192.168.1.1", "ttl": "600"}},
+			},
+		},
+		"edit_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			auth: "pk1_key:sk1_secret",
+			expected: []request{
+				{"/dns/editByNameType/example.com/A/test", map[string]string{"content": "192.168.1.1", "ttl": "600"}},
+				{"/dns/create/example.com", map[string]string{"content": "2001:db8::1", "name": "test", "type": "AAAA"}},
+			},
+		},
+		"apex": {
+			fqdn: "example.net",
+			ip:   "192.168.1.1",
+			auth: "pk1_key:sk1_secret",
+			expected: []request{
+				{"/dns/create/example.net", map[string]string{"content": "192.168.1.1", "name": "", "type": "A"}},
+			},
+		},
+		"unknown_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			auth:     "pk1_key:sk1_secret",
+			errorMsg: "no zone found",
+		},
+		"multiple_addresses": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1,192.168.1.2",
+			auth:     "pk1_key:sk1_secret",
+			errorMsg: "multiple addresses",
+		},
+		"bad_key": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			auth:     "pk1_key:wrong",
+			errorMsg: "Invalid API key",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newPorkbunStub(t, &requests)
+			defer server.Close()
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.auth); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(requests) != 0 {
+					t.Fatalf("Expected no updates, got %+v", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, requests)
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newPorkbunStub(t, &requests)
+			defer server.Close()
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("pk1_key:sk1_secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(requests) != 0 {
+				t.Errorf("Expected no updates, got %+v", requests)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package powerdns implements a DNSManager for the PowerDNS Authoritative
+// server using the HTTP API specified at https://doc.powerdns.com/authoritative/http-api/ .
+package powerdns
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager   = (*Client)(nil)
+	_ ddman.Configurable = (*Client)(nil)
+	_ ddman.Planner      = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "http://localhost:8081"
+	defaultUserAgent = "ddflare-powerdns-"
+	defaultServer    = "localhost"
+	defaultTTL       = 3600
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	server    string
+	*restapi.API
+}
+
+type zone struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	RRsets []rrset `json:"rrsets,omitempty"`
+}
+
+type rrset struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	TTL        int      `json:"ttl"`
+	ChangeType string   `json:"changetype,omitempty"`
+	Records    []record `json:"records"`
+}
+
+type record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+// NewWithEndpoint initializes a new PowerDNS client which uses 'endpoint' as
+// API endpoint, i.e., the base URL of the PowerDNS webserver.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+		server:    defaultServer,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// SetOption sets the PowerDNS specific options. The only option supported is
+// "server", the server id ("localhost" by default), to be set before .Init().
+func (c *Client) SetOption(key, value string) error {
+	switch key {
+	case "server":
+		if value == "" {
+			return fmt.Errorf("invalid empty %q option", key)
+		}
+		c.server = value
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Init sets up the connection to the API of the configured server,
+// authenticated with the API key passed as parameter.
+func (c *Client) Init(apiKey string) error {
+	if apiKey == "" {
+		return fmt.Errorf("cannot initialize PowerDNS client: missing API key")
+	}
+	api, err := restapi.New(c.endpoint+"/api/v1/servers/"+url.PathEscape(c.server), c.userAgent, http.Header{"X-API-Key": {apiKey}})
+	if err != nil {
+		return err
+	}
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: the A and
+// AAAA RRsets are replaced in a single request, keeping their TTL.
+func (c *Client) Update(fqdn, ip string) error {
+	var changes []rrset
+	recs, zonePath, err := c.records(fqdn, &changes)
+	if err != nil {
+		return err
+	}
+	if err = recs.Upsert(ip); err != nil {
+		return err
+	}
+
+	if err = c.Do("PATCH", zonePath, map[string][]rrset{"rrsets": changes}, nil); err != nil {
+		return fmt.Errorf("RRsets update failed: %w", err)
+	}
+	slog.Debug("RRsets updated", logging.Endpoint, c.endpoint, logging.FQDN, fqdn, "data", changes)
+
+	return nil
+}
+
+// Plan looks up the DNS zone and the RRsets of `fqdn` and returns the changes
+// an update to `ip` would apply, without updating the RRsets.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, _, err := c.records(fqdn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA RRsets
+// and the API path of the zone: their updates are appended to `changes`.
+func (c *Client) records(fqdn string, changes *[]rrset) (restapi.Records[rrset], string, error) {
+	if c.API == nil {
+		return restapi.Records[rrset]{}, "", fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".") + "."
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	z, err := c.getZone(fqdn)
+	if err != nil {
+		return restapi.Records[rrset]{}, "", fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	log.Debug("DNS zone found", "zone", z.Name, "zoneID", z.ID)
+
+	zonePath := "/zones/" + url.PathEscape(z.ID)
+	q := url.Values{}
+	q.Set("rrset_name", fqdn)
+	if err = c.Do("GET", zonePath+"?"+q.Encode(), nil, z); err != nil {
+		return restapi.Records[rrset]{}, "", fmt.Errorf("cannot retrieve RRsets: %w", err)
+	}
+	return restapi.Records[rrset]{
+		Find: func(rType string) ([]rrset, error) {
+			var found []rrset
+			for _, rs := range z.RRsets {
+				if rs.Name == fqdn && rs.Type == rType {
+					log.Debug("RRset found", "data", rs)
+					found = append(found, rs)
+				}
+			}
+			return found, nil
+		},
+		Update: func(rType string, found []rrset, addrs []string) error {
+			rs := rrset{Name: fqdn, Type: rType, TTL: defaultTTL, ChangeType: "REPLACE"}
+			if len(found) > 0 && found[0].TTL != 0 {
+				rs.TTL = found[0].TTL
+			}
+			for _, a := range addrs {
+				rs.Records = append(rs.Records, record{Content: a})
+			}
+			*changes = append(*changes, rs)
+			return nil
+		},
+		Addresses: func(rs rrset) []string {
+			var addrs []string
+			for _, r := range rs.Records {
+				addrs = append(addrs, r.Content)
+			}
+			return addrs
+		},
+		Zone: strings.TrimSuffix(z.Name, "."),
+	}, zonePath, nil
+}
+
+// getZone returns the PowerDNS zone hosting `fqdn`.
+func (c *Client) getZone(fqdn string) (*zone, error) {
+	var found *zone
+	_, err := net.LookupZone(fqdn, func(name string) (bool, error) {
+		var zones []zone
+		if err := c.Do("GET", "/zones?zone="+url.QueryEscape(name+"."), nil, &zones); err != nil {
+			return false, err
+		}
+		for i := range zones {
+			if zones[i].Name == name+"." {
+				found = &zones[i]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return found, err
+}
@@ -0,0 +1,285 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package powerdns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if client.server != defaultServer {
+		t.Errorf("Expected default server %q, got %q", defaultServer, client.server)
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty API key")
+	}
+}
+
+func TestClient_SetOption(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		key   string
+		value string
+		fails bool
+	}{
+		"server":       {"server", "ns1", false},
+		"empty_server": {"server", "", true},
+		"unknown":      {"zone", "example.com", true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := New()
+			err := client.SetOption(tt.key, tt.value)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected failure setting %q to %q", tt.key, tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected failure: %v", err)
+			}
+			if client.server != tt.value {
+				t.Fatalf("expected server %q, got %q", tt.value, client.server)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateUninitialized(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+// newPowerDNSStub returns a fake PowerDNS server with id "ns1", hosting the
+// "example.com." zone, which contains an A RRset with TTL 60 for
+// "test.example.com.".
+func newPowerDNSStub(t *testing.T, patches *[][]rrset) *httptest.Server {
+	const prefix = "/api/v1/servers/ns1"
+	auth := restapitest.Auth{Header: "X-API-Key", Value: "secret", Reply: "Unauthorized"}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, req *map[string][]rrset) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == prefix+"/zones":
+			if r.URL.Query().Get("zone") == "example.com." {
+				w.Write([]byte(`[{"id": "example.com.", "name": "example.com.", "kind": "Native"}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		case r.Method == "GET" && r.URL.Path == prefix+"/zones/example.com.":
+			w.Write([]byte(`{"id": "example.com.", "name": "example.com.", "rrsets": [
+				{"name": "example.com.", "type": "SOA", "ttl": 3600, "records": [{"content": "a.misconfigured.dns.server.invalid. hostmaster.example.com. 1 10800 3600 604800 3600", "disabled": false}]},
+				{"name": "test.example.com.", "type": "A", "ttl": 60, "records": [{"content": "10.0.0.1", "disabled": false}]}
+			]}`))
+		case r.Method == "PATCH" && r.URL.Path == prefix+"/zones/example.com.":
+			for _, rs := range (*req)["rrsets"] {
+				if !strings.HasSuffix(rs.Name, ".example.com.") && rs.Name != "example.com." {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					w.Write([]byte(`{"error": "RRset ` + rs.Name + ` IN ` + rs.Type + `: Name is out of zone"}`))
+					return
+				}
+			}
+			*patches = append(*patches, (*req)["rrsets"])
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		apiKey   string
+		expected []rrset
+		errorMsg string
+	}{
+		"keep_ttl": {
+			fqdn:   "test.example.com",
+			ip:     "192.168.1.1",
+			apiKey: "secret",
+			expected: []rrset{
+				{Name: "test.example.com.", Type: "A", TTL: 60, ChangeType: "REPLACE", Records: []record{{Content: "192.168.1.1"}}},
+			},
+		},
+		"ipv4_and_ipv6": {
+			fqdn:   "test.example.com.",
+			ip:     "192.168.1.1,2001:db8::1,192.168.1.2",
+			apiKey: "secret",
+			expected: []rrset{
+				{Name: "test.example.com.", Type: "A", TTL: 60, ChangeType: "REPLACE", Records: []record{{Content: "192.168.1.1"}, {Content: "192.168.1.2"}}},
+				{Name: "test.example.com.", Type: "AAAA", TTL: defaultTTL, ChangeType: "REPLACE", Records: []record{{Content: "2001:db8::1"}}},
+			},
+		},
+		"new_rrset": {
+			fqdn:   "new.example.com",
+			ip:     "192.168.1.1",
+			apiKey: "secret",
+			expected: []rrset{
+				{Name: "new.example.com.", Type: "A", TTL: defaultTTL, ChangeType: "REPLACE", Records: []record{{Content: "192.168.1.1"}}},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			apiKey:   "secret",
+			errorMsg: "no zone found",
+		},
+		"bad_api_key": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			apiKey:   "wrong",
+			errorMsg: "returned 401",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var patches [][]rrset
+			server := newPowerDNSStub(t, &patches)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.SetOption("server", "ns1"); err != nil {
+				t.Fatalf("unexpected SetOption failure: %v", err)
+			}
+			if err := client.Init(tt.apiKey); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(patches) != 0 {
+					t.Fatalf("Expected no updates, got %v", patches)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(patches) != 1 {
+				t.Fatalf("Expected a single PATCH request, got %d", len(patches))
+			}
+			if !slices.EqualFunc(patches[0], tt.expected, func(a, b rrset) bool {
+				return a.Name == b.Name && a.Type == b.Type && a.TTL == b.TTL &&
+					a.ChangeType == b.ChangeType && slices.Equal(a.Records, b.Records)
+			}) {
+				t.Fatalf("Expected RRsets %+v, got %+v", tt.expected, patches[0])
+			}
+		})
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var patches [][]rrset
+			server := newPowerDNSStub(t, &patches)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.SetOption("server", "ns1"); err != nil {
+				t.Fatalf("unexpected SetOption failure: %v", err)
+			}
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(patches) != 0 {
+				t.Errorf("Expected no updates, got %+v", patches)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
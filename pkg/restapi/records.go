@@ -0,0 +1,137 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restapi
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/net"
+)
+
+// Records reads and writes, via the callbacks, the A and AAAA records of an
+// FQDN. R is the record type returned by the DNS provider API.
+type Records[R any] struct {
+	// Find returns the current records of type `rType` ("A" or "AAAA").
+	Find func(rType string) ([]R, error)
+	// Create creates the `rType` records set to `addrs`: it is called when
+	// Find returned no record. When nil, Update is called instead.
+	Create func(rType string, addrs []string) error
+	// Update sets the `found` records of type `rType` to `addrs`.
+	Update func(rType string, found []R, addrs []string) error
+	// Single is true if the API holds one address per record and the records
+	// are updated one by one: more than one address per family, or more than
+	// one record found, are rejected.
+	Single bool
+	// Addresses returns the addresses held by a record found: it is only
+	// required by Plan.
+	Addresses func(rec R) []string
+	// Zone is the DNS zone of the records, reported by Plan.
+	Zone string
+}
+
+// family holds the addresses of `ip` of the record type rType.
+type family struct {
+	rType string
+	addrs []string
+}
+
+// families splits the comma separated list of addresses `ip` in the A and
+// AAAA record families to set.
+func (r Records[R]) families(ip string) ([]family, error) {
+	v4, v6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return nil, err
+	}
+	if r.Single && (len(v4) > 1 || len(v6) > 1) {
+		return nil, fmt.Errorf("multiple addresses of the same family are not supported")
+	}
+	var fams []family
+	if len(v4) > 0 {
+		fams = append(fams, family{"A", v4})
+	}
+	if len(v6) > 0 {
+		fams = append(fams, family{"AAAA", v6})
+	}
+	return fams, nil
+}
+
+// Upsert sets the records of each address family of the comma separated list
+// of addresses `ip`, creating the missing ones. The records of the other
+// address family are left untouched.
+func (r Records[R]) Upsert(ip string) error {
+	fams, err := r.families(ip)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fams {
+		found, err := r.Find(f.rType)
+		if err != nil {
+			return fmt.Errorf("cannot retrieve %s records: %w", f.rType, err)
+		}
+		switch {
+		case len(found) == 0 && r.Create != nil:
+			if err = r.Create(f.rType, f.addrs); err != nil {
+				return fmt.Errorf("%s record creation failed: %w", f.rType, err)
+			}
+		case r.Single && len(found) > 1:
+			return fmt.Errorf("found %d matching %s records", len(found), f.rType)
+		default:
+			if err = r.Update(f.rType, found, f.addrs); err != nil {
+				return fmt.Errorf("%s record update failed: %w", f.rType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Plan returns the changes Upsert(ip) would apply to the records of `fqdn`,
+// without calling Create or Update.
+func (r Records[R]) Plan(fqdn, ip string) ([]ddman.RecordChange, error) {
+	fams, err := r.families(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ddman.RecordChange
+	for _, f := range fams {
+		found, err := r.Find(f.rType)
+		if err != nil {
+			return nil, fmt.Errorf("cannot retrieve %s records: %w", f.rType, err)
+		}
+		if r.Single && len(found) > 1 {
+			return nil, fmt.Errorf("found %d matching %s records", len(found), f.rType)
+		}
+		var cur []string
+		for _, rec := range found {
+			cur = append(cur, r.Addresses(rec)...)
+		}
+		slices.Sort(cur)
+		addrs := slices.Sorted(slices.Values(f.addrs))
+		changes = append(changes, ddman.RecordChange{
+			Name:       fqdn,
+			Type:       f.rType,
+			Old:        strings.Join(cur, ","),
+			New:        strings.Join(addrs, ","),
+			Attributes: map[string]string{"zone": r.Zone},
+		})
+	}
+	return changes, nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package restapi implements the plumbing shared by the DNS backends talking
+// to JSON REST APIs: request encoding, authentication headers, error replies
+// decoding and resources existence checks.
+package restapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ddflare/ddflare/pkg/tracing"
+)
+
+type API struct {
+	endpoint  string
+	userAgent string
+	header    http.Header
+	// ErrorMessage extracts the error message from the body of a failed
+	// request reply. When nil, or when returning an empty string, the
+	// "message" and "error" JSON fields are looked up.
+	ErrorMessage func(body []byte) string
+	// Authorize, when not nil, is called on each request before sending it,
+	// with the JSON encoded payload (nil if none), to add the authentication
+	// details which cannot be fixed in the header passed to New(), e.g.,
+	// expiring tokens or request signatures.
+	Authorize func(req *http.Request, body []byte) error
+}
+
+// Error is returned when the API replies with a non 2xx status code.
+type Error struct {
+	Status  int
+	Message string
+	// Body is the raw reply, to decode the API specific error details.
+	Body []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("API returned %d: %s", e.Status, e.Message)
+}
+
+// IsNotFound returns true if `err` reports a 404 (Not Found) API reply.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// New initializes a new REST API connection to 'endpoint', identifying the
+// client via the 'useragent' string and adding 'header' (e.g., the
+// authorization one) to all the requests.
+func New(endpoint, useragent string, header http.Header) (*API, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("cannot instantiate new REST API: missing endpoint")
+	}
+	if useragent == "" {
+		return nil, fmt.Errorf("cannot instantiate new REST API: missing useragent")
+	}
+	return &API{
+		endpoint:  endpoint,
+		userAgent: useragent,
+		header:    header,
+	}, nil
+}
+
+// SetUserAgent sets the user agent string identifying the client in the
+// following requests.
+func (a *API) SetUserAgent(ua string) {
+	a.userAgent = ua
+}
+
+// Do sends the `in` payload (if not nil) JSON encoded to the `path` API and
+// decodes the JSON reply in `out` (if not nil).
+func (a *API) Do(method, path string, in, out any) error {
+	return a.DoContext(context.Background(), method, path, in, out)
+}
+
+// DoContext is Do(), sending the request with `ctx` and tracing it as a
+// child of the span in `ctx`.
+func (a *API) DoContext(ctx context.Context, method, path string, in, out any) (err error) {
+	var (
+		payload []byte
+		body    io.Reader
+	)
+	ctx, span := tracing.Start(ctx, method, tracing.HTTPMethod.String(method), tracing.URLPath.String(path))
+	defer func() { tracing.End(span, err) }()
+	if in != nil {
+		if payload, err = json.Marshal(in); err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.endpoint+path, body)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", a.endpoint, err)
+	}
+	for k, v := range a.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", a.userAgent)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.Authorize != nil {
+		if err = a.Authorize(req, payload); err != nil {
+			return err
+		}
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", a.endpoint, err)
+	}
+	defer res.Body.Close()
+	span.SetAttributes(tracing.HTTPStatus.Int(res.StatusCode))
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failure reading endpoint %q reply: %w", a.endpoint, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &Error{Status: res.StatusCode, Message: a.errorMessage(res.Status, data), Body: data}
+	}
+	if out == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("cannot decode endpoint %q reply: %w", a.endpoint, err)
+	}
+	return nil
+}
+
+func (a *API) errorMessage(status string, data []byte) string {
+	if a.ErrorMessage != nil {
+		if msg := a.ErrorMessage(data); msg != "" {
+			return msg
+		}
+	}
+	var reply struct {
+		Message string `json:"message"`
+		Error   any    `json:"error"`
+	}
+	if json.Unmarshal(data, &reply) != nil {
+		return status
+	}
+	if reply.Message != "" {
+		return reply.Message
+	}
+	if msg, ok := reply.Error.(string); ok && msg != "" {
+		return msg
+	}
+	return status
+}
+
+// Exists converts the outcome of a request probing a resource to the
+// LookupZone() callback result: a 404 (Not Found) reply means the resource
+// does not exist.
+func Exists(err error) (bool, error) {
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
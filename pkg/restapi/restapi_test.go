@@ -0,0 +1,419 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	if _, err := New("", "ua", nil); err == nil {
+		t.Error("Expected failure with an empty endpoint")
+	}
+	if _, err := New("https://api.example.com", "", nil); err == nil {
+		t.Error("Expected failure with an empty user agent")
+	}
+}
+
+func TestAPI_Do(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("User-Agent") != "ddflare-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "Invalid API token."}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/echo":
+			if r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("unexpected Content-Type %q", r.Header.Get("Content-Type"))
+			}
+			var in map[string]string
+			json.NewDecoder(r.Body).Decode(&in)
+			json.NewEncoder(w).Encode(in)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/message":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message": "invalid record"}`))
+		case "/custom":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": [{"reason": "custom reason"}]}`))
+		case "/text":
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`bad gateway`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "Not found", "status": 404}`))
+		}
+	}))
+	defer server.Close()
+
+	api, err := New(server.URL, "ddflare-test", http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatalf("unexpected New failure: %v", err)
+	}
+	api.ErrorMessage = func(body []byte) string {
+		var reply struct {
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(body, &reply) != nil || len(reply.Errors) == 0 {
+			return ""
+		}
+		return reply.Errors[0].Reason
+	}
+
+	var out map[string]string
+	if err = api.Do("POST", "/echo", map[string]string{"key": "value"}, &out); err != nil || out["key"] != "value" {
+		t.Errorf("unexpected echo reply %v: %v", out, err)
+	}
+	if err = api.Do("PATCH", "/empty", map[string]string{}, &out); err != nil {
+		t.Errorf("unexpected failure with empty reply: %v", err)
+	}
+
+	tests := map[string]struct {
+		path     string
+		status   int
+		errorMsg string
+	}{
+		"message":   {"/message", http.StatusBadRequest, "invalid record"},
+		"custom":    {"/custom", http.StatusBadRequest, "custom reason"},
+		"not_json":  {"/text", http.StatusBadGateway, "502 Bad Gateway"},
+		"not_found": {"/missing", http.StatusNotFound, "Not found"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := api.Do("GET", tt.path, nil, nil)
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.Status != tt.status || !strings.Contains(apiErr.Message, tt.errorMsg) {
+				t.Fatalf("Expected %d error containing %q, got %v", tt.status, tt.errorMsg, err)
+			}
+			if IsNotFound(err) != (tt.status == http.StatusNotFound) {
+				t.Fatalf("Unexpected IsNotFound result for %v", err)
+			}
+		})
+	}
+
+	api, _ = New(server.URL, "ddflare-test", nil)
+	if err = api.Do("GET", "/echo", nil, nil); err == nil || !strings.Contains(err.Error(), "Invalid API token") {
+		t.Errorf("Expected authorization failure, got %v", err)
+	}
+
+	var payload string
+	api.Authorize = func(req *http.Request, body []byte) error {
+		payload = string(body)
+		req.Header.Set("Authorization", "Bearer secret")
+		return nil
+	}
+	if err = api.Do("POST", "/echo", map[string]string{"key": "value"}, &out); err != nil || out["key"] != "value" {
+		t.Errorf("unexpected echo reply %v: %v", out, err)
+	}
+	if payload != `{"key":"value"}` {
+		t.Errorf("unexpected payload passed to Authorize: %q", payload)
+	}
+	api.Authorize = func(*http.Request, []byte) error { return errors.New("token expired") }
+	if err = api.Do("GET", "/echo", nil, nil); err == nil || err.Error() != "token expired" {
+		t.Errorf("Expected Authorize failure, got %v", err)
+	}
+}
+
+func TestAPI_DoContextTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/records" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	api, err := New(server.URL, "ddflare-test", nil)
+	if err != nil {
+		t.Fatalf("unexpected New failure: %v", err)
+	}
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	if err := api.DoContext(ctx, http.MethodGet, "/records", nil, nil); err != nil {
+		t.Errorf("unexpected DoContext failure: %v", err)
+	}
+	if err := api.DoContext(ctx, http.MethodPut, "/missing", map[string]string{}, nil); err == nil {
+		t.Error("Expected DoContext failure on a missing path")
+	}
+	root.End()
+
+	// the request is canceled with the context
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := api.DoContext(cancelled, http.MethodGet, "/records", nil, nil); err == nil {
+		t.Error("Expected DoContext failure on canceled context")
+	}
+
+	expected := []struct {
+		method string
+		path   string
+		status int
+		code   codes.Code
+	}{
+		{http.MethodGet, "/records", http.StatusOK, codes.Unset},
+		{http.MethodPut, "/missing", http.StatusNotFound, codes.Error},
+		{http.MethodGet, "/records", 0, codes.Error},
+	}
+	var spans []tracetest.SpanStub
+	for _, s := range exp.GetSpans() {
+		if s.Name != "root" {
+			spans = append(spans, s)
+		}
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("Expected %d request spans, got %d", len(expected), len(spans))
+	}
+	for i, e := range expected {
+		s := spans[i]
+		if s.Name != e.method {
+			t.Errorf("Expected span #%d named %q, got %q", i, e.method, s.Name)
+		}
+		if s.Status.Code != e.code {
+			t.Errorf("Expected span #%d with status %v, got %v", i, e.code, s.Status.Code)
+		}
+		if s.Parent.SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("Expected span #%d to be child of the root span", i)
+		}
+		if !slices.Contains(s.Attributes, tracing.HTTPMethod.String(e.method)) ||
+			!slices.Contains(s.Attributes, tracing.URLPath.String(e.path)) {
+			t.Errorf("Expected method %q and path %q among the span #%d attributes %v", e.method, e.path, i, s.Attributes)
+		}
+		if e.status != 0 && !slices.Contains(s.Attributes, tracing.HTTPStatus.Int(e.status)) {
+			t.Errorf("Expected status %d among the span #%d attributes %v", e.status, i, s.Attributes)
+		}
+	}
+}
+
+func TestExists(t *testing.T) {
+	t.Parallel()
+
+	failure := errors.New("connection refused")
+	tests := map[string]struct {
+		err    error
+		exists bool
+		fails  bool
+	}{
+		"found":     {exists: true},
+		"not_found": {err: &Error{Status: http.StatusNotFound}},
+		"forbidden": {err: &Error{Status: http.StatusForbidden}, fails: true},
+		"failure":   {err: failure, fails: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			exists, err := Exists(tt.err)
+			if (err != nil) != tt.fails {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if exists != tt.exists {
+				t.Fatalf("Expected exists %t, got %t", tt.exists, exists)
+			}
+		})
+	}
+}
+
+func TestRecords_Upsert(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		ip       string
+		records  map[string][]string
+		single   bool
+		expected []string
+		errorMsg string
+	}{
+		"update": {
+			ip:       "192.168.1.1",
+			records:  map[string][]string{"A": {"10.0.0.1"}, "AAAA": {"2001:db8::2"}},
+			expected: []string{"update A 10.0.0.1 -> 192.168.1.1"},
+		},
+		"update_and_create": {
+			ip:       "192.168.1.1,2001:db8::1",
+			records:  map[string][]string{"A": {"10.0.0.1"}},
+			expected: []string{"update A 10.0.0.1 -> 192.168.1.1", "create AAAA 2001:db8::1"},
+		},
+		"multiple_addresses": {
+			ip:       "192.168.1.1,192.168.1.2",
+			records:  map[string][]string{"A": {"10.0.0.1", "10.0.0.2"}},
+			expected: []string{"update A 10.0.0.1,10.0.0.2 -> 192.168.1.1,192.168.1.2"},
+		},
+		"single_multiple_addresses": {
+			ip:       "192.168.1.1,192.168.1.2",
+			single:   true,
+			errorMsg: "multiple addresses",
+		},
+		"single_multiple_records": {
+			ip:       "192.168.1.1",
+			records:  map[string][]string{"A": {"10.0.0.1", "10.0.0.2"}},
+			single:   true,
+			errorMsg: "found 2 matching A records",
+		},
+		"find_failure": {
+			ip:       "2001:db8::1",
+			records:  map[string][]string{"AAAA": nil},
+			errorMsg: "cannot retrieve AAAA records: connection refused",
+		},
+		"invalid_address": {
+			ip:       "192.168.1",
+			errorMsg: "invalid IP address",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls []string
+			err := Records[string]{
+				Find: func(rType string) ([]string, error) {
+					if recs, ok := tt.records[rType]; ok && recs == nil {
+						return nil, errors.New("connection refused")
+					}
+					return tt.records[rType], nil
+				},
+				Create: func(rType string, addrs []string) error {
+					calls = append(calls, "create "+rType+" "+strings.Join(addrs, ","))
+					return nil
+				},
+				Update: func(rType string, found, addrs []string) error {
+					calls = append(calls, "update "+rType+" "+strings.Join(found, ",")+" -> "+strings.Join(addrs, ","))
+					return nil
+				},
+				Single: tt.single,
+			}.Upsert(tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(calls, tt.expected) {
+				t.Fatalf("Expected calls %q, got %q", tt.expected, calls)
+			}
+		})
+	}
+}
+
+func TestRecords_Plan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		ip       string
+		records  map[string][]string
+		single   bool
+		expected []string
+		errorMsg string
+	}{
+		"update": {
+			ip:       "192.168.1.1",
+			records:  map[string][]string{"A": {"10.0.0.1"}, "AAAA": {"2001:db8::2"}},
+			expected: []string{"A 10.0.0.1 -> 192.168.1.1"},
+		},
+		"update_and_create": {
+			ip:       "192.168.1.1,2001:db8::1",
+			records:  map[string][]string{"A": {"192.168.1.1"}},
+			expected: []string{"A 192.168.1.1 -> 192.168.1.1", "AAAA  -> 2001:db8::1"},
+		},
+		"sorted_addresses": {
+			ip:       "192.168.1.2,192.168.1.1",
+			records:  map[string][]string{"A": {"10.0.0.2", "10.0.0.1"}},
+			expected: []string{"A 10.0.0.1,10.0.0.2 -> 192.168.1.1,192.168.1.2"},
+		},
+		"single_multiple_records": {
+			ip:       "192.168.1.1",
+			records:  map[string][]string{"A": {"10.0.0.1", "10.0.0.2"}},
+			single:   true,
+			errorMsg: "found 2 matching A records",
+		},
+		"find_failure": {
+			ip:       "2001:db8::1",
+			records:  map[string][]string{"AAAA": nil},
+			errorMsg: "cannot retrieve AAAA records: connection refused",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			changes, err := Records[string]{
+				Find: func(rType string) ([]string, error) {
+					if recs, ok := tt.records[rType]; ok && recs == nil {
+						return nil, errors.New("connection refused")
+					}
+					return tt.records[rType], nil
+				},
+				Update: func(string, []string, []string) error {
+					t.Error("unexpected Update call")
+					return nil
+				},
+				Single:    tt.single,
+				Addresses: func(rec string) []string { return []string{rec} },
+				Zone:      "example.com",
+			}.Plan("test.example.com", tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var got []string
+			for _, c := range changes {
+				if c.Name != "test.example.com" || c.Attributes["zone"] != "example.com" {
+					t.Errorf("Unexpected name or zone in change %+v", c)
+				}
+				got = append(got, c.Type+" "+c.Old+" -> "+c.New)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Fatalf("Expected changes %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package restapitest implements a fake REST API endpoint for the tests of the
+// DNS backends using the restapi package.
+package restapitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Auth is the authentication expected by a Server: the requests without the
+// Header set to Value are rejected with Status (401 if zero) and the Reply
+// body.
+type Auth struct {
+	Header string
+	Value  string
+	Status int
+	Reply  string
+}
+
+// Handler replies to the authenticated requests. The JSON body of the write
+// requests (POST, PUT and PATCH) is decoded in `body`, nil for the other
+// methods.
+type Handler[B any] func(w http.ResponseWriter, r *http.Request, body *B)
+
+// NewServer starts a fake REST API endpoint checking `auth` and replying via
+// `handler`. It is closed at the end of the test.
+func NewServer[B any](t *testing.T, auth Auth, handler Handler[B]) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(auth.Header) != auth.Value {
+			status := auth.Status
+			if status == 0 {
+				status = http.StatusUnauthorized
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(auth.Reply))
+			return
+		}
+		switch r.Method {
+		case "POST", "PUT", "PATCH":
+			body := new(B)
+			if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+				t.Errorf("cannot decode %s body: %v", r.Method, err)
+			}
+			handler(w, r, body)
+		default:
+			handler(w, r, nil)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Unexpected fails the test `t` and replies with 404 to the unexpected
+// request `r`.
+func Unexpected(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	w.WriteHeader(http.StatusNotFound)
+}
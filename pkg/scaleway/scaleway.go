@@ -0,0 +1,238 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scaleway implements a DNSManager for Scaleway Domains and DNS
+// using the API specified at https://www.scaleway.com/en/developers/api/domains-and-dns/ .
+package scaleway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://api.scaleway.com/domain/v2beta1"
+	defaultUserAgent = "ddflare-scaleway-"
+	defaultTTL       = 3600
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type record struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+// change is a "set" change of the records PATCH API, which replaces all the
+// records matching the id fields.
+type change struct {
+	Set struct {
+		IDFields struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"id_fields"`
+		Records []record `json:"records"`
+	} `json:"set"`
+}
+
+// NewWithEndpoint initializes a new Scaleway client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the Scaleway API secret
+// key passed as parameter.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize Scaleway client: missing secret key")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"X-Auth-Token": {token}})
+	if err != nil {
+		return err
+	}
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: the A and
+// AAAA records are replaced with all the addresses of the matching family,
+// keeping their TTL, with a single PATCH request.
+func (c *Client) Update(fqdn, ip string) error {
+	var changes []change
+	recs, err := c.records(fqdn, &changes)
+	if err != nil {
+		return err
+	}
+	if err = recs.Upsert(ip); err != nil {
+		return err
+	}
+
+	req := struct {
+		Changes          []change `json:"changes"`
+		ReturnAllRecords bool     `json:"return_all_records"`
+	}{Changes: changes}
+	if err = c.Do("PATCH", recordsPath(recs.Zone), req, nil); err != nil {
+		return fmt.Errorf("records update failed: %w", err)
+	}
+	slog.Debug("record updated", logging.Endpoint, c.endpoint, logging.FQDN, fqdn, "data", changes)
+	return nil
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records:
+// their updates are appended to `changes`.
+func (c *Client) records(fqdn string, changes *[]change) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	zone, err := net.LookupZone(fqdn, c.zoneExists)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, zone)
+	log.Debug("DNS zone found", "zone", zone)
+
+	return restapi.Records[record]{
+		Find: func(rType string) ([]record, error) {
+			q := url.Values{}
+			q.Set("name", name)
+			q.Set("type", rType)
+			var current struct {
+				Records []record `json:"records"`
+			}
+			if err := c.Do("GET", recordsPath(zone)+"?"+q.Encode(), nil, &current); err != nil {
+				return nil, err
+			}
+			for _, r := range current.Records {
+				log.Debug("record found", "data", r)
+			}
+			return current.Records, nil
+		},
+		Update: func(rType string, found []record, addrs []string) error {
+			ttl := defaultTTL
+			for _, r := range found {
+				ttl = r.TTL
+			}
+			var ch change
+			ch.Set.IDFields.Name, ch.Set.IDFields.Type = name, rType
+			for _, a := range addrs {
+				ch.Set.Records = append(ch.Set.Records, record{Name: name, Type: rType, Data: a, TTL: ttl})
+			}
+			*changes = append(*changes, ch)
+			return nil
+		},
+		Addresses: func(r record) []string { return []string{r.Data} },
+		Zone:      zone,
+	}, nil
+}
+
+// recordsPath returns the API path of the records of the DNS zone `zone`.
+func recordsPath(zone string) string {
+	return "/dns-zones/" + url.PathEscape(zone) + "/records"
+}
+
+// zoneExists returns true if the Scaleway DNS zone `name` exists.
+func (c *Client) zoneExists(name string) (bool, error) {
+	var reply struct {
+		DNSZones []struct {
+			Domain    string `json:"domain"`
+			Subdomain string `json:"subdomain"`
+		} `json:"dns_zones"`
+	}
+	if err := c.Do("GET", "/dns-zones?dns_zone="+url.QueryEscape(name), nil, &reply); err != nil {
+		return false, err
+	}
+	for _, z := range reply.DNSZones {
+		zone := z.Domain
+		if z.Subdomain != "" {
+			zone = z.Subdomain + "." + z.Domain
+		}
+		if zone == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
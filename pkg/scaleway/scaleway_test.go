@@ -0,0 +1,267 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scaleway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty secret key")
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+type request struct {
+	path    string
+	changes []change
+}
+
+// patch is the body of the records PATCH requests.
+type patch struct {
+	Changes []change `json:"changes"`
+}
+
+// newScalewayStub returns a fake Scaleway Domains API endpoint. The account
+// owns the "example.com" DNS zone and its "sub" subzone: the first one
+// contains the A record with TTL 300 for "test".
+func newScalewayStub(t *testing.T, requests *[]request) *httptest.Server {
+	auth := restapitest.Auth{Header: "X-Auth-Token", Value: "secret",
+		Reply: `{"message": "authentication is denied", "method": "api_key", "type": "denied_authentication"}`}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, req *patch) {
+		q := r.URL.Query()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/dns-zones":
+			switch q.Get("dns_zone") {
+			case "example.com":
+				w.Write([]byte(`{"dns_zones": [{"domain": "example.com", "subdomain": ""}], "total_count": 1}`))
+			case "sub.example.com":
+				w.Write([]byte(`{"dns_zones": [{"domain": "example.com", "subdomain": "sub"}], "total_count": 1}`))
+			default:
+				w.Write([]byte(`{"dns_zones": [], "total_count": 0}`))
+			}
+		case r.Method == "GET" && r.URL.Path == "/dns-zones/example.com/records" && q.Get("name") == "test" && q.Get("type") == "A":
+			w.Write([]byte(`{"records": [{"id": "1", "data": "10.0.0.1", "name": "test", "ttl": 300, "type": "A"}], "total_count": 1}`))
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/records"):
+			w.Write([]byte(`{"records": [], "total_count": 0}`))
+		case r.Method == "PATCH" && strings.HasSuffix(r.URL.Path, "/records"):
+			*requests = append(*requests, request{r.URL.Path, req.Changes})
+			w.Write([]byte(`{"records": []}`))
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func set(name, rType string, recs ...record) change {
+	var ch change
+	ch.Set.IDFields.Name, ch.Set.IDFields.Type = name, rType
+	ch.Set.Records = recs
+	return ch
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		token    string
+		expected []request
+		errorMsg string
+	}{
+		"update": {
+			fqdn:  "test.example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"/dns-zones/example.com/records", []change{set("test", "A", record{"test", "A", "192.168.1.1", 300})}},
+			},
+		},
+		"dual_stack": {
+			fqdn:  "test.example.com.",
+			ip:    "192.168.1.1,2001:db8::1,2001:db8::2",
+			token: "secret",
+			expected: []request{
+				{"/dns-zones/example.com/records", []change{
+					set("test", "A", record{"test", "A", "192.168.1.1", 300}),
+					set("test", "AAAA", record{"test", "AAAA", "2001:db8::1", defaultTTL}, record{"test", "AAAA", "2001:db8::2", defaultTTL}),
+				}},
+			},
+		},
+		"subzone_apex": {
+			fqdn:  "sub.example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"/dns-zones/sub.example.com/records", []change{set("", "A", record{"", "A", "192.168.1.1", defaultTTL})}},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "no zone found",
+		},
+		"bad_token": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "wrong",
+			errorMsg: "authentication is denied",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newScalewayStub(t, &requests)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(requests) != 0 {
+					t.Fatalf("Expected no updates, got %+v", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, requests)
+			}
+		})
+	}
+}
+
+func TestClient_SetUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewWithEndpoint(server.URL)
+	if err := client.Init("secret"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	client.SetUserAgent("custom-agent")
+	if err := client.Update("test.example.com", "192.168.1.1"); err == nil {
+		t.Fatal("Expected Update failure")
+	}
+	if len(agents) == 0 || agents[0] != "custom-agent" {
+		t.Errorf("Expected user agent %q, got %v", "custom-agent", agents)
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newScalewayStub(t, &requests)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(requests) != 0 {
+				t.Errorf("Expected no updates, got %+v", requests)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing sets up the optional OpenTelemetry tracing of the DDNS
+// updates and provides the helpers to create the spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+// Name is the instrumentation scope of the ddflare spans.
+const Name = "github.com/ddflare/ddflare"
+
+// Span attribute keys.
+const (
+	FQDN     = attribute.Key("ddflare.fqdn")
+	IP       = attribute.Key("ddflare.ip")
+	Provider = attribute.Key("ddflare.provider")
+	Zone     = attribute.Key("ddflare.zone")
+	Result   = attribute.Key("ddflare.result")
+	// ReturnCode is the DynDNS update protocol return code (e.g., "good").
+	ReturnCode = attribute.Key("ddflare.return_code")
+	// Instrumented reports whether the provider traces its API calls in
+	// child spans of the update one.
+	Instrumented = attribute.Key("ddflare.instrumented")
+
+	// HTTP client attributes of the provider API calls, as per the
+	// OpenTelemetry semantic conventions.
+	HTTPMethod = attribute.Key("http.request.method")
+	HTTPStatus = attribute.Key("http.response.status_code")
+	URLPath    = attribute.Key("url.path")
+)
+
+// Start starts the span `name`, child of the span in `ctx` if any, using the
+// global TracerProvider: spans are dropped unless Setup() was called.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(Name).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the `span`, marking it as failed if `err` is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Setup exports the spans via OTLP over HTTP to the `endpoint` URL (e.g.,
+// "http://localhost:4318/v1/traces"), setting the global TracerProvider.
+// The standard OTEL_EXPORTER_OTLP_* env vars (e.g., the headers) and
+// OTEL_RESOURCE_ATTRIBUTES are honored.
+// The returned function flushes the pending spans and stops the exporter.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create OTLP exporter: %w", err)
+	}
+	tp, err := NewTracerProvider(ctx, sdktrace.WithBatcher(exp))
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// NewTracerProvider returns a TracerProvider identifying the spans as
+// produced by the ddflare service, configured with `opts` (e.g., the
+// exporter).
+func NewTracerProvider(ctx context.Context, opts ...sdktrace.TracerProviderOption) (*sdktrace.TracerProvider, error) {
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			attribute.String("service.name", "ddflare"),
+			attribute.String("service.version", version.Version),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create tracing resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)...), nil
+}
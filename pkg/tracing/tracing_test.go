@@ -0,0 +1,111 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartEnd(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp, err := NewTracerProvider(context.Background(), sdktrace.WithSyncer(exp))
+	if err != nil {
+		t.Fatalf("unexpected NewTracerProvider failure: %v", err)
+	}
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	ctx, root := Start(context.Background(), "root", FQDN.String("test.example.com"))
+	_, child := Start(ctx, "child")
+	End(child, errors.New("update failed"))
+	End(root, nil)
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.Name != "child" || r.Name != "root" {
+		t.Fatalf("unexpected spans %q, %q", c.Name, r.Name)
+	}
+	if c.Parent.SpanID() != r.SpanContext.SpanID() {
+		t.Error("Expected child span to be child of root")
+	}
+	if c.Status.Code != codes.Error || c.Status.Description != "update failed" || len(c.Events) != 1 {
+		t.Errorf("Expected failed child span, got status %+v and %d events", c.Status, len(c.Events))
+	}
+	if r.Status.Code != codes.Unset {
+		t.Errorf("Expected unset root span status, got %+v", r.Status)
+	}
+	if len(r.Attributes) != 1 || r.Attributes[0].Key != FQDN || r.Attributes[0].Value.AsString() != "test.example.com" {
+		t.Errorf("unexpected root span attributes %v", r.Attributes)
+	}
+	if name, ok := r.Resource.Set().Value("service.name"); !ok || name.AsString() != "ddflare" {
+		t.Errorf("Expected service.name 'ddflare', got %q", name.AsString())
+	}
+}
+
+func TestSetup(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+		ctype    string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			requests++
+			ctype = r.Header.Get("Content-Type")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	shutdown, err := Setup(context.Background(), server.URL+"/v1/traces")
+	if err != nil {
+		t.Fatalf("unexpected Setup failure: %v", err)
+	}
+	_, span := Start(context.Background(), "ddflare.cycle")
+	End(span, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected shutdown failure: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 1 {
+		t.Fatalf("Expected 1 export request, got %d", requests)
+	}
+	if ctype != "application/x-protobuf" {
+		t.Errorf("Expected protobuf export, got %q", ctype)
+	}
+}
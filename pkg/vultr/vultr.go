@@ -0,0 +1,217 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vultr implements a DNSManager for the Vultr DNS using the API
+// specified at https://www.vultr.com/api/#tag/dns .
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/restapi"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager = (*Client)(nil)
+	_ ddman.Planner    = (*Client)(nil)
+)
+
+const (
+	defaultAPIEP     = "https://api.vultr.com/v2"
+	defaultUserAgent = "ddflare-vultr-"
+	pageSize         = 500
+)
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	*restapi.API
+}
+
+type record struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+// NewWithEndpoint initializes a new Vultr client which uses 'endpoint' as
+// API endpoint.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint(defaultAPIEP)
+}
+
+// GetApiEndpoint returns the current API EndPoint.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the API EndPoint.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+	if c.API != nil {
+		c.API.SetUserAgent(ua)
+	}
+}
+
+// Init sets up the API connection authenticated with the Vultr API key
+// passed as parameter.
+func (c *Client) Init(token string) error {
+	if token == "" {
+		return fmt.Errorf("cannot initialize Vultr client: missing API key")
+	}
+	api, err := restapi.New(c.endpoint, c.userAgent, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		return err
+	}
+	c.API = api
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may contain both an IPv4 and an IPv6 address, comma separated: the
+// A and AAAA records are updated, or created if missing.
+func (c *Client) Update(fqdn, ip string) error {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return err
+	}
+	return recs.Upsert(ip)
+}
+
+// Plan looks up the DNS zone and the records of `fqdn` and returns the
+// changes an update to `ip` would apply, without updating the records.
+func (c *Client) Plan(_ context.Context, fqdn, ip string) ([]ddman.RecordChange, error) {
+	recs, err := c.records(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return recs.Plan(strings.TrimSuffix(fqdn, "."), ip)
+}
+
+// records looks up the DNS zone of `fqdn` and returns its A and AAAA records.
+func (c *Client) records(fqdn string) (restapi.Records[record], error) {
+	if c.API == nil {
+		return restapi.Records[record]{}, fmt.Errorf("not authorized")
+	}
+
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	domain, err := net.LookupZone(fqdn, func(name string) (bool, error) {
+		return restapi.Exists(c.Do("GET", "/domains/"+url.PathEscape(name), nil, nil))
+	})
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot identify DNS zone: %w", err)
+	}
+	name := net.RecordName(fqdn, domain)
+	log.Debug("DNS zone found", "zone", domain)
+
+	recordsPath := "/domains/" + url.PathEscape(domain) + "/records"
+	recs, err := c.getRecords(recordsPath)
+	if err != nil {
+		return restapi.Records[record]{}, fmt.Errorf("cannot retrieve DNS records: %w", err)
+	}
+
+	return restapi.Records[record]{
+		Find: func(rType string) ([]record, error) {
+			var found []record
+			for _, r := range recs {
+				if r.Name == name && r.Type == rType {
+					log.Debug("record found", "data", r)
+					found = append(found, r)
+				}
+			}
+			return found, nil
+		},
+		Create: func(rType string, addrs []string) error {
+			want := record{Type: rType, Name: name, Data: addrs[0]}
+			if err := c.Do("POST", recordsPath, want, nil); err != nil {
+				return err
+			}
+			log.Debug("record created", "data", want)
+			return nil
+		},
+		Update: func(_ string, found []record, addrs []string) error {
+			want := record{Name: name, Data: addrs[0], TTL: found[0].TTL}
+			if err := c.Do("PATCH", recordsPath+"/"+url.PathEscape(found[0].ID), want, nil); err != nil {
+				return err
+			}
+			log.Debug("record updated", "data", want)
+			return nil
+		},
+		Single:    true,
+		Addresses: func(r record) []string { return []string{r.Data} },
+		Zone:      domain,
+	}, nil
+}
+
+// getRecords retrieves all the records of the domain following the
+// pagination cursor.
+func (c *Client) getRecords(path string) ([]record, error) {
+	var recs []record
+	q := url.Values{}
+	q.Set("per_page", fmt.Sprint(pageSize))
+	for {
+		var reply struct {
+			Records []record `json:"records"`
+			Meta    struct {
+				Links struct {
+					Next string `json:"next"`
+				} `json:"links"`
+			} `json:"meta"`
+		}
+		if err := c.Do("GET", path+"?"+q.Encode(), nil, &reply); err != nil {
+			return nil, err
+		}
+		recs = append(recs, reply.Records...)
+		if reply.Meta.Links.Next == "" {
+			return recs, nil
+		}
+		q.Set("cursor", reply.Meta.Links.Next)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/restapi/restapitest"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != defaultAPIEP {
+		t.Errorf("Expected default endpoint %q, got %q", defaultAPIEP, client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init(""); err == nil {
+		t.Error("Expected Init failure with an empty API key")
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+}
+
+type request struct {
+	method string
+	path   string
+	rec    record
+}
+
+// newVultrStub returns a fake Vultr API endpoint. The account owns the
+// "example.com" and "sub.example.com" domains. The "example.com" records are
+// split in two pages: the second one contains the A record "r1" with TTL 300
+// for "test".
+func newVultrStub(t *testing.T, requests *[]request) *httptest.Server {
+	auth := restapitest.Auth{Header: "Authorization", Value: "Bearer secret", Reply: `{"error": "Invalid API token.", "status": 401}`}
+	return restapitest.NewServer(t, auth, func(w http.ResponseWriter, r *http.Request, rec *record) {
+		cursor := r.URL.Query().Get("cursor")
+		switch {
+		case r.Method == "GET" && (r.URL.Path == "/domains/example.com" || r.URL.Path == "/domains/sub.example.com"):
+			w.Write([]byte(`{"domain": {"domain": "` + strings.TrimPrefix(r.URL.Path, "/domains/") + `"}}`))
+		case r.Method == "GET" && r.URL.Path == "/domains/example.com/records" && cursor == "":
+			w.Write([]byte(`{"records": [{"id": "r0", "type": "MX", "name": "", "data": "mail.example.com", "ttl": 300}],
+				"meta": {"total": 2, "links": {"next": "bmV4dA==", "prev": ""}}}`))
+		case r.Method == "GET" && r.URL.Path == "/domains/example.com/records" && cursor == "bmV4dA==":
+			w.Write([]byte(`{"records": [{"id": "r1", "type": "A", "name": "test", "data": "10.0.0.1", "ttl": 300}],
+				"meta": {"total": 2, "links": {"next": "", "prev": ""}}}`))
+		case r.Method == "GET" && r.URL.Path == "/domains/sub.example.com/records":
+			w.Write([]byte(`{"records": [], "meta": {"total": 0, "links": {"next": "", "prev": ""}}}`))
+		case r.Method == "POST" || r.Method == "PATCH":
+			*requests = append(*requests, request{r.Method, r.URL.Path, *rec})
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "GET":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "Domain not found.", "status": 404}`))
+		default:
+			restapitest.Unexpected(t, w, r)
+		}
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		token    string
+		expected []request
+		errorMsg string
+	}{
+		"update": {
+			fqdn:  "test.example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"PATCH", "/domains/example.com/records/r1", record{Name: "test", Data: "192.168.1.1", TTL: 300}},
+			},
+		},
+		"update_and_create": {
+			fqdn:  "test.example.com.",
+			ip:    "192.168.1.1,2001:db8::1",
+			token: "secret",
+			expected: []request{
+				{"PATCH", "/domains/example.com/records/r1", record{Name: "test", Data: "192.168.1.1", TTL: 300}},
+				{"POST", "/domains/example.com/records", record{Type: "AAAA", Name: "test", Data: "2001:db8::1"}},
+			},
+		},
+		"longest_domain": {
+			fqdn:  "sub.example.com",
+			ip:    "192.168.1.1",
+			token: "secret",
+			expected: []request{
+				{"POST", "/domains/sub.example.com/records", record{Type: "A", Data: "192.168.1.1"}},
+			},
+		},
+		"multiple_addresses": {
+			fqdn:     "test.example.com",
+			ip:       "2001:db8::1,2001:db8::2",
+			token:    "secret",
+			errorMsg: "multiple addresses",
+		},
+		"unknown_domain": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			token:    "secret",
+			errorMsg: "no zone found",
+		},
+		"bad_token": {
+			fqdn:     "test.example.com",
+			ip:       "192.168.1.1",
+			token:    "wrong",
+			errorMsg: "Invalid API token",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newVultrStub(t, &requests)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init(tt.token); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update(tt.fqdn, tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if len(requests) != 0 {
+					t.Fatalf("Expected no updates, got %+v", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, requests)
+			}
+		})
+	}
+}
+
+func TestClient_SetUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewWithEndpoint(server.URL)
+	if err := client.Init("secret"); err != nil {
+		t.Fatalf("unexpected Init failure: %v", err)
+	}
+	client.SetUserAgent("custom-agent")
+	if err := client.Update("test.example.com", "192.168.1.1"); err == nil {
+		t.Fatal("Expected Update failure")
+	}
+	if len(agents) == 0 || agents[0] != "custom-agent" {
+		t.Errorf("Expected user agent %q, got %v", "custom-agent", agents)
+	}
+}
+
+func TestClient_Plan(t *testing.T) {
+	t.Parallel()
+
+	zone := map[string]string{"zone": "example.com"}
+	tests := map[string]struct {
+		fqdn     string
+		ip       string
+		expected []ddman.RecordChange
+		errorMsg string
+	}{
+		"update_and_create": {
+			fqdn: "test.example.com.",
+			ip:   "192.168.1.1,2001:db8::1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "192.168.1.1", Attributes: zone},
+				{Name: "test.example.com", Type: "AAAA", New: "2001:db8::1", Attributes: zone},
+			},
+		},
+		"up_to_date": {
+			fqdn: "test.example.com",
+			ip:   "10.0.0.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.example.com", Type: "A", Old: "10.0.0.1", New: "10.0.0.1", Attributes: zone},
+			},
+		},
+		"nested_zone": {
+			fqdn: "test.sub.example.com",
+			ip:   "192.168.1.1",
+			expected: []ddman.RecordChange{
+				{Name: "test.sub.example.com", Type: "A", New: "192.168.1.1", Attributes: map[string]string{"zone": "sub.example.com"}},
+			},
+		},
+		"unknown_zone": {
+			fqdn:     "test.example.org",
+			ip:       "192.168.1.1",
+			errorMsg: "no zone found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := newVultrStub(t, &requests)
+
+			client := NewWithEndpoint(server.URL)
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			changes, err := client.Plan(context.Background(), tt.fqdn, tt.ip)
+			if len(requests) != 0 {
+				t.Errorf("Expected no updates, got %+v", requests)
+			}
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected changes %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook implements a generic DNSManager for the DNS providers
+// exposing an HTTP update API, configured with templates instead of code.
+//
+// The API endpoint is a Go text/template rendering the request URL. The
+// request method, headers and body, and the matchers deciding if the update
+// succeeded, are set via options. Templates are executed with the TemplateData
+// fields: an update request is sent for each address to update.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/logging"
+	"github.com/ddflare/ddflare/pkg/net"
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+var (
+	_ ddman.DNSManager   = (*Client)(nil)
+	_ ddman.Configurable = (*Client)(nil)
+)
+
+const defaultUserAgent = "ddflare-webhook-"
+
+// TemplateData holds the values available to the URL, header and body
+// templates.
+type TemplateData struct {
+	FQDN  string
+	IP    string
+	Type  string // "A" or "AAAA", according to the IP address family
+	Token string // the auth credential passed to Init()
+}
+
+type header struct {
+	name  string
+	value *template.Template
+}
+
+// jsonMatcher matches the value at a path of the JSON reply.
+type jsonMatcher struct {
+	path  []string
+	value string
+	// any is true when just the presence of a non null value is checked.
+	any bool
+}
+
+type Client struct {
+	endpoint  string
+	userAgent string
+	method    string
+	headers   []header
+	body      *template.Template
+	// statuses are the reply status codes considered successful: if empty
+	// any 2xx code is.
+	statuses []int
+	regex    *regexp.Regexp
+	json     *jsonMatcher
+	token    string
+	// url is the parsed endpoint template, set by Init().
+	url *template.Template
+}
+
+var funcs = template.FuncMap{
+	// json returns the JSON encoding of the argument, e.g., a quoted string.
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// NewWithEndpoint initializes a new webhook client which uses the 'endpoint'
+// template as URL.
+func NewWithEndpoint(ep string) *Client {
+	return &Client{
+		endpoint:  ep,
+		userAgent: defaultUserAgent + version.Version,
+		method:    "GET",
+	}
+}
+
+func New() *Client {
+	return NewWithEndpoint("")
+}
+
+// GetApiEndpoint returns the current URL template.
+func (c *Client) GetApiEndpoint() string {
+	return c.endpoint
+}
+
+// SetApiEndpoint sets the URL template.
+func (c *Client) SetApiEndpoint(ep string) {
+	c.endpoint = ep
+}
+
+func (c *Client) GetUserAgent() string {
+	return c.userAgent
+}
+
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// SetOption sets the webhook options:
+//   - "method": the HTTP method (GET by default)
+//   - "header": a "Name: value" request header, the value is a template
+//     (can be repeated)
+//   - "body": the request body template
+//   - "success-status": comma separated list of the reply status codes
+//     considered successful (any 2xx code by default)
+//   - "success-regex": a regular expression the reply body must match
+//   - "success-json": a "path" or "path=value" expression: the reply JSON
+//     value at the dot separated path (array items are selected by index)
+//     must exist or be equal to the value
+func (c *Client) SetOption(key, value string) error {
+	switch key {
+	case "method":
+		if value == "" {
+			return fmt.Errorf("invalid empty %q option", key)
+		}
+		c.method = strings.ToUpper(value)
+	case "header":
+		name, val, found := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return fmt.Errorf("invalid %q option %q: 'Name: value' format expected", key, value)
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Parse(strings.TrimSpace(val))
+		if err != nil {
+			return fmt.Errorf("invalid %q option template: %w", key, err)
+		}
+		c.headers = append(c.headers, header{name: name, value: tmpl})
+	case "body":
+		tmpl, err := template.New("body").Funcs(funcs).Parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid %q option template: %w", key, err)
+		}
+		c.body = tmpl
+	case "success-status":
+		c.statuses = nil
+		for _, s := range strings.Split(value, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || code < 100 || code > 599 {
+				return fmt.Errorf("invalid %q option %q: HTTP status codes expected", key, value)
+			}
+			c.statuses = append(c.statuses, code)
+		}
+	case "success-regex":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("invalid %q option: %w", key, err)
+		}
+		c.regex = re
+	case "success-json":
+		path, val, found := strings.Cut(value, "=")
+		if path == "" {
+			return fmt.Errorf("invalid %q option %q: 'path' or 'path=value' format expected", key, value)
+		}
+		c.json = &jsonMatcher{path: strings.Split(path, "."), value: val, any: !found}
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Init stores the auth credential, available to the templates as .Token,
+// and validates the URL template.
+func (c *Client) Init(token string) error {
+	if c.endpoint == "" {
+		return fmt.Errorf("cannot initialize webhook client: missing URL template endpoint")
+	}
+	tmpl, err := template.New("url").Funcs(funcs).Parse(c.endpoint)
+	if err != nil {
+		return fmt.Errorf("cannot initialize webhook client: invalid URL template: %w", err)
+	}
+	c.url, c.token = tmpl, token
+	return nil
+}
+
+// Resolve returns the current IP address assigned to the FQDN passed as
+// parameter.
+func (c *Client) Resolve(fqdn string) (string, error) {
+	return net.Resolve(fqdn)
+}
+
+// Update updates the `fqdn` to the `ip` address passed as parameter.
+// `ip` may be a comma separated list of IPv4 and IPv6 addresses: a request
+// is sent for each address.
+func (c *Client) Update(fqdn, ip string) error {
+	if c.url == nil {
+		return fmt.Errorf("not authorized")
+	}
+
+	v4, v6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return err
+	}
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	log := slog.Default().With(logging.Endpoint, c.endpoint, logging.FQDN, fqdn)
+
+	for _, rType := range []string{"A", "AAAA"} {
+		addrs := v4
+		if rType == "AAAA" {
+			addrs = v6
+		}
+		for _, a := range addrs {
+			data := TemplateData{FQDN: fqdn, IP: a, Type: rType, Token: c.token}
+			if err = c.send(log, data); err != nil {
+				return fmt.Errorf("webhook update of %s record failed: %w", rType, err)
+			}
+			log.Debug("record updated", "type", rType, logging.IP, a)
+		}
+	}
+	return nil
+}
+
+func render(tmpl *template.Template, data TemplateData) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("cannot render %q template: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// send performs the request rendered from `data` and checks the reply
+// against the success matchers.
+func (c *Client) send(log *slog.Logger, data TemplateData) error {
+	reqURL, err := render(c.url, data)
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if c.body != nil {
+		b, err := render(c.body, data)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(b)
+	}
+
+	req, err := http.NewRequest(c.method, reqURL, body)
+	if err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	for _, h := range c.headers {
+		value, err := render(h.value, data)
+		if err != nil {
+			return err
+		}
+		req.Header.Add(h.name, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("connection to %s failed: %w", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+
+	log.Debug("endpoint connected", "status", res.Status, "code", res.StatusCode)
+	reply, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failure reading endpoint %q reply: %w", req.URL.Host, err)
+	}
+	log.Debug("parsing reply message", "body", string(reply))
+
+	return c.match(res.StatusCode, res.Status, reply)
+}
+
+// match checks the reply status code and body against the success matchers.
+func (c *Client) match(status int, statusText string, body []byte) error {
+	if len(c.statuses) == 0 {
+		if status < 200 || status >= 300 {
+			return fmt.Errorf("endpoint returned %d (%s) status", status, statusText)
+		}
+	} else {
+		found := false
+		for _, s := range c.statuses {
+			found = found || s == status
+		}
+		if !found {
+			return fmt.Errorf("endpoint returned unexpected %d (%s) status", status, statusText)
+		}
+	}
+
+	if c.regex != nil && !c.regex.Match(body) {
+		return fmt.Errorf("reply %q does not match %q", bytes.TrimSpace(body), c.regex)
+	}
+
+	if c.json != nil {
+		var reply any
+		if err := json.Unmarshal(body, &reply); err != nil {
+			return fmt.Errorf("cannot decode JSON reply: %w", err)
+		}
+		path := strings.Join(c.json.path, ".")
+		value, found := lookup(reply, c.json.path)
+		if !found || value == nil {
+			return fmt.Errorf("JSON reply has no %q value", path)
+		}
+		if !c.json.any {
+			if s := jsonString(value); s != c.json.value {
+				return fmt.Errorf("JSON reply %q value is %q, %q expected", path, s, c.json.value)
+			}
+		}
+	}
+	return nil
+}
+
+// lookup returns the value at `path` in the decoded JSON `v`.
+func lookup(v any, path []string) (any, bool) {
+	for _, p := range path {
+		switch node := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = node[p]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonString returns the string representation of a decoded JSON value:
+// strings are returned as is, other values JSON encoded.
+func jsonString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
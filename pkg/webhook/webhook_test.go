@@ -0,0 +1,262 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddflare/ddflare/pkg/version"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+
+	if client.GetApiEndpoint() != "" {
+		t.Errorf("Expected empty default endpoint, got %q", client.GetApiEndpoint())
+	}
+	expectedUserAgent := defaultUserAgent + version.Version
+	if client.GetUserAgent() != expectedUserAgent {
+		t.Errorf("Expected default user agent %q, got %q", expectedUserAgent, client.GetUserAgent())
+	}
+	if err := client.Init("token"); err == nil {
+		t.Error("Expected Init failure without URL template")
+	}
+	err := client.Update("test.example.com", "192.168.1.1")
+	if err == nil || err.Error() != "not authorized" {
+		t.Errorf("Expected 'not authorized' error, got %v", err)
+	}
+	client.SetApiEndpoint("https://example.com/{{.FQDN")
+	if err := client.Init("token"); err == nil {
+		t.Error("Expected Init failure with an invalid URL template")
+	}
+}
+
+func TestClient_SetOption(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		key   string
+		value string
+		fails bool
+	}{
+		"method":           {"method", "post", false},
+		"empty_method":     {"method", "", true},
+		"header":           {"header", "Authorization: Bearer {{.Token}}", false},
+		"header_no_colon":  {"header", "Authorization", true},
+		"header_bad_tmpl":  {"header", "X-Host: {{.FQDN", true},
+		"body":             {"body", `{"ip": {{json .IP}}}`, false},
+		"body_bad_tmpl":    {"body", "{{.IP", true},
+		"status":           {"success-status", "200, 204", false},
+		"status_invalid":   {"success-status", "ok", true},
+		"status_range":     {"success-status", "42", true},
+		"regex":            {"success-regex", "^(good|nochg)", false},
+		"regex_invalid":    {"success-regex", "(good", true},
+		"json_value":       {"success-json", "result.status=ok", false},
+		"json_presence":    {"success-json", "result.id", false},
+		"json_empty_path":  {"success-json", "=ok", true},
+		"unknown":          {"timeout", "10s", true},
+		"header_name_only": {"header", " : value", true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := New().SetOption(tt.key, tt.value)
+			if tt.fails != (err != nil) {
+				t.Fatalf("unexpected SetOption(%q, %q) result: %v", tt.key, tt.value, err)
+			}
+		})
+	}
+}
+
+type request struct {
+	method string
+	uri    string
+	header string
+	body   string
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		url      string
+		options  [][2]string
+		ip       string
+		reply    string
+		status   int
+		expected []request
+		errorMsg string
+	}{
+		"get": {
+			url:   "/update?host={{.FQDN | urlquery}}&ip={{.IP}}&type={{.Type}}",
+			ip:    "192.168.1.1",
+			reply: "ok",
+			expected: []request{
+				{"GET", "/update?host=test.example.com&ip=192.168.1.1&type=A", "", ""},
+			},
+		},
+		"post_dual_stack": {
+			url: "/zones/{{.FQDN}}",
+			options: [][2]string{
+				{"method", "post"},
+				{"header", "Authorization: Bearer {{.Token}}"},
+				{"body", `{"type": {{json .Type}}, "content": {{json .IP}}}`},
+				{"success-status", "201"},
+			},
+			ip:     "192.168.1.1,2001:db8::1",
+			status: http.StatusCreated,
+			expected: []request{
+				{"POST", "/zones/test.example.com", "Bearer secret", `{"type": "A", "content": "192.168.1.1"}`},
+				{"POST", "/zones/test.example.com", "Bearer secret", `{"type": "AAAA", "content": "2001:db8::1"}`},
+			},
+		},
+		"unexpected_status": {
+			url:      "/update",
+			options:  [][2]string{{"success-status", "201"}},
+			ip:       "192.168.1.1",
+			errorMsg: "unexpected 200",
+		},
+		"error_status": {
+			url:      "/update",
+			ip:       "192.168.1.1",
+			status:   http.StatusForbidden,
+			errorMsg: "returned 403",
+		},
+		"regex_match": {
+			url:     "/nic/update",
+			options: [][2]string{{"success-regex", `^(good|nochg)\b`}},
+			ip:      "192.168.1.1",
+			reply:   "nochg 192.168.1.1",
+			expected: []request{
+				{"GET", "/nic/update", "", ""},
+			},
+		},
+		"regex_mismatch": {
+			url:      "/nic/update",
+			options:  [][2]string{{"success-regex", `^(good|nochg)\b`}},
+			ip:       "192.168.1.1",
+			reply:    "badauth",
+			errorMsg: "does not match",
+		},
+		"json_match": {
+			url:     "/api",
+			options: [][2]string{{"success-json", "result.0.success=true"}},
+			ip:      "192.168.1.1",
+			reply:   `{"result": [{"success": true}]}`,
+			expected: []request{
+				{"GET", "/api", "", ""},
+			},
+		},
+		"json_string_match": {
+			url:     "/api",
+			options: [][2]string{{"success-json", "status=SUCCESS"}},
+			ip:      "192.168.1.1",
+			reply:   `{"status": "SUCCESS"}`,
+			expected: []request{
+				{"GET", "/api", "", ""},
+			},
+		},
+		"json_presence": {
+			url:     "/api",
+			options: [][2]string{{"success-json", "record.id"}},
+			ip:      "192.168.1.1",
+			reply:   `{"record": {"id": 12}}`,
+			expected: []request{
+				{"GET", "/api", "", ""},
+			},
+		},
+		"json_mismatch": {
+			url:      "/api",
+			options:  [][2]string{{"success-json", "status=SUCCESS"}},
+			ip:       "192.168.1.1",
+			reply:    `{"status": "ERROR", "message": "Invalid API key"}`,
+			errorMsg: `"status" value is "ERROR"`,
+		},
+		"json_missing": {
+			url:      "/api",
+			options:  [][2]string{{"success-json", "record.id"}},
+			ip:       "192.168.1.1",
+			reply:    `{"record": null}`,
+			errorMsg: `no "record.id" value`,
+		},
+		"json_invalid": {
+			url:      "/api",
+			options:  [][2]string{{"success-json", "status"}},
+			ip:       "192.168.1.1",
+			reply:    `OK`,
+			errorMsg: "cannot decode JSON reply",
+		},
+		"template_error": {
+			url:      "/update?ip={{.Address}}",
+			ip:       "192.168.1.1",
+			errorMsg: "cannot render",
+		},
+		"invalid_ip": {
+			url:      "/update",
+			ip:       "192.168.1",
+			errorMsg: "192.168.1",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests []request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				requests = append(requests, request{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(body)})
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(tt.reply))
+			}))
+			defer server.Close()
+
+			client := NewWithEndpoint(server.URL + tt.url)
+			for _, opt := range tt.options {
+				if err := client.SetOption(opt[0], opt[1]); err != nil {
+					t.Fatalf("unexpected SetOption failure: %v", err)
+				}
+			}
+			if err := client.Init("secret"); err != nil {
+				t.Fatalf("unexpected Init failure: %v", err)
+			}
+			err := client.Update("test.example.com.", tt.ip)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tt.expected) {
+				t.Fatalf("Expected requests %+v, got %+v", tt.expected, requests)
+			}
+		})
+	}
+}
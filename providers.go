@@ -0,0 +1,230 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ddflare
+
+import (
+	"github.com/ddflare/ddflare/pkg/azure"
+	"github.com/ddflare/ddflare/pkg/cflare"
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/desec"
+	"github.com/ddflare/ddflare/pkg/digitalocean"
+	"github.com/ddflare/ddflare/pkg/dyn"
+	"github.com/ddflare/ddflare/pkg/dynv6"
+	"github.com/ddflare/ddflare/pkg/freedns"
+	"github.com/ddflare/ddflare/pkg/gandi"
+	"github.com/ddflare/ddflare/pkg/gcloud"
+	"github.com/ddflare/ddflare/pkg/godaddy"
+	"github.com/ddflare/ddflare/pkg/he"
+	"github.com/ddflare/ddflare/pkg/hetzner"
+	"github.com/ddflare/ddflare/pkg/linode"
+	"github.com/ddflare/ddflare/pkg/namecheap"
+	"github.com/ddflare/ddflare/pkg/ovh"
+	"github.com/ddflare/ddflare/pkg/plugin"
+	"github.com/ddflare/ddflare/pkg/porkbun"
+	"github.com/ddflare/ddflare/pkg/powerdns"
+	"github.com/ddflare/ddflare/pkg/scaleway"
+	"github.com/ddflare/ddflare/pkg/vultr"
+	"github.com/ddflare/ddflare/pkg/webhook"
+)
+
+// DDNSEndpoint is the update endpoint of the DDNS backend.
+const DDNSEndpoint = "https://update.ddns.org"
+
+var (
+	typeA       = []string{"A"}
+	typeAnyAddr = []string{"A", "AAAA"}
+)
+
+// dynPreset returns a Factory of DynDNS protocol clients for `endpoint`.
+func dynPreset(endpoint string) Factory {
+	return func() ddman.DNSManager { return dyn.NewWithEndpoint(endpoint) }
+}
+
+// typeNames maps the DNSManagerType values to the built-in backend names.
+var typeNames = map[DNSManagerType]string{
+	Cloudflare:        "cflare",
+	Dyn:               "dyn",
+	DDNS:              "ddns",
+	NoIP:              "noip",
+	DeSEC:             "desec",
+	DeSECDyn:          "desec-dyn",
+	Hetzner:           "hetzner",
+	DigitalOcean:      "digitalocean",
+	Gandi:             "gandi",
+	PowerDNS:          "powerdns",
+	GoogleCloud:       "gcloud",
+	Azure:             "azure",
+	Porkbun:           "porkbun",
+	Namecheap:         "namecheap",
+	OVH:               "ovh",
+	GoDaddy:           "godaddy",
+	Linode:            "linode",
+	Vultr:             "vultr",
+	Scaleway:          "scaleway",
+	HurricaneElectric: "he",
+	FreeDNS:           "freedns",
+	Dynv6:             "dynv6",
+	Webhook:           "webhook",
+	Plugin:            "exec",
+}
+
+func init() {
+	Register("cflare", func() ddman.DNSManager { return cflare.New() }, ProviderInfo{
+		Description: "Cloudflare API",
+		Credentials: "api-token",
+		RecordTypes: typeA,
+	})
+	Register("dyn", func() ddman.DNSManager { return dyn.New() }, ProviderInfo{
+		Description: "Dyn (DynDNS protocol)",
+		Credentials: "user:password",
+		RecordTypes: typeAnyAddr,
+	})
+	Register("ddns", dynPreset(DDNSEndpoint), ProviderInfo{
+		Description: "DDNS.org (DynDNS protocol)",
+		Credentials: "user:password",
+		RecordTypes: typeAnyAddr,
+	})
+	Register("noip", dynPreset("https://dynupdate.no-ip.com"), ProviderInfo{
+		Description: "No-IP (DynDNS protocol)",
+		Credentials: "user:password",
+		RecordTypes: typeAnyAddr,
+	})
+	Register("desec", func() ddman.DNSManager { return desec.New() }, ProviderInfo{
+		Description:       "deSEC.io API",
+		Credentials:       "api-token",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("desec-dyn", dynPreset(desec.DynEndpoint), ProviderInfo{
+		Description: "deSEC.io (DynDNS protocol)",
+		Credentials: "domain:api-token",
+		RecordTypes: typeAnyAddr,
+	})
+	Register("hetzner", func() ddman.DNSManager { return hetzner.New() }, ProviderInfo{
+		Description:       "Hetzner DNS API",
+		Credentials:       "api-token",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("digitalocean", func() ddman.DNSManager { return digitalocean.New() }, ProviderInfo{
+		Description:       "DigitalOcean DNS API",
+		Credentials:       "api-token",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("gandi", func() ddman.DNSManager { return gandi.New() }, ProviderInfo{
+		Description:       "Gandi LiveDNS API",
+		Credentials:       "api-token",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("powerdns", func() ddman.DNSManager { return powerdns.New() }, ProviderInfo{
+		Description:       "PowerDNS Authoritative HTTP API",
+		Credentials:       "api-key",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+		Configurable:      true,
+	})
+	Register("gcloud", func() ddman.DNSManager { return gcloud.New() }, ProviderInfo{
+		Description:       "Google Cloud DNS API",
+		Credentials:       "service-account-key|" + gcloud.MetadataAuth,
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+		Configurable:      true,
+	})
+	Register("azure", func() ddman.DNSManager { return azure.New() }, ProviderInfo{
+		Description:       "Azure DNS API",
+		Credentials:       "tenant:client-id:client-secret|" + azure.ManagedIdentityAuth + "[:client-id]",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+		Configurable:      true,
+	})
+	Register("porkbun", func() ddman.DNSManager { return porkbun.New() }, ProviderInfo{
+		Description:       "Porkbun API",
+		Credentials:       "api-key:secret-api-key",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("namecheap", func() ddman.DNSManager { return namecheap.New() }, ProviderInfo{
+		Description:  "Namecheap Dynamic DNS",
+		Credentials:  "ddns-password",
+		RecordTypes:  typeA,
+		Configurable: true,
+	})
+	Register("ovh", func() ddman.DNSManager { return ovh.New() }, ProviderInfo{
+		Description:       "OVHcloud API or DynHost",
+		Credentials:       "app-key:app-secret:consumer-key|login:password",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+		Configurable:      true,
+	})
+	Register("godaddy", func() ddman.DNSManager { return godaddy.New() }, ProviderInfo{
+		Description:       "GoDaddy API",
+		Credentials:       "key:secret",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("linode", func() ddman.DNSManager { return linode.New() }, ProviderInfo{
+		Description:       "Linode DNS Manager API",
+		Credentials:       "api-token",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("vultr", func() ddman.DNSManager { return vultr.New() }, ProviderInfo{
+		Description:       "Vultr DNS API",
+		Credentials:       "api-key",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("scaleway", func() ddman.DNSManager { return scaleway.New() }, ProviderInfo{
+		Description:       "Scaleway Domains and DNS API",
+		Credentials:       "secret-key",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+	})
+	Register("he", func() ddman.DNSManager { return he.New() }, ProviderInfo{
+		Description: "Hurricane Electric Free DNS",
+		Credentials: "ddns-key",
+		RecordTypes: typeAnyAddr,
+	})
+	Register("freedns", func() ddman.DNSManager { return freedns.New() }, ProviderInfo{
+		Description: "FreeDNS (afraid.org)",
+		Credentials: "update-token",
+		RecordTypes: typeAnyAddr,
+	})
+	Register("dynv6", func() ddman.DNSManager { return dynv6.New() }, ProviderInfo{
+		Description:       "dynv6 update API",
+		Credentials:       "zone-token",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+		Configurable:      true,
+	})
+	Register("webhook", func() ddman.DNSManager { return webhook.New() }, ProviderInfo{
+		Description:       "templated HTTP webhook (endpoint is the URL template)",
+		Credentials:       "token",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+		Configurable:      true,
+	})
+	Register("exec", func() ddman.DNSManager { return plugin.New() }, ProviderInfo{
+		Description:       "external plugin (endpoint is the executable path)",
+		Credentials:       "plugin specific",
+		RecordTypes:       typeAnyAddr,
+		MultipleAddresses: true,
+		Configurable:      true,
+	})
+}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2024 Francesco Giudici <dev@foggy.day>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ddflare
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/ddflare/ddflare/pkg/ddman"
+	"github.com/ddflare/ddflare/pkg/net"
+)
+
+// Factory returns a new, not initialized, instance of a DNS backend.
+type Factory func() ddman.DNSManager
+
+// ProviderInfo describes the features of a DNS backend.
+type ProviderInfo struct {
+	// Description is a short human readable description of the backend.
+	Description string
+	// Credentials describes the format of the auth credential expected by
+	// Init(), e.g., "api-token" or "user:password".
+	Credentials string
+	// RecordTypes lists the supported record types ("A", "AAAA").
+	RecordTypes []string
+	// MultipleAddresses is true if Update() accepts comma separated lists of
+	// addresses.
+	MultipleAddresses bool
+	// Configurable is true if the backend accepts options (see
+	// DNSManager.SetOption()).
+	Configurable bool
+}
+
+// CheckAddresses returns an error if the comma separated list of addresses
+// `ip` contains address families or more addresses than the backend supports.
+func (i ProviderInfo) CheckAddresses(ip string) error {
+	v4, v6, err := net.SplitAddresses(ip)
+	if err != nil {
+		return err
+	}
+	if !i.MultipleAddresses && len(v4)+len(v6) > 1 {
+		return fmt.Errorf("multiple addresses not supported")
+	}
+	for _, r := range []struct {
+		typ   string
+		addrs []string
+	}{{"A", v4}, {"AAAA", v6}} {
+		if len(r.addrs) > 0 && !slices.Contains(i.RecordTypes, r.typ) {
+			return fmt.Errorf("%s records not supported", r.typ)
+		}
+	}
+	return nil
+}
+
+// Provider is a DNS backend registered by name.
+type Provider struct {
+	Name string
+	ProviderInfo
+
+	factory Factory
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]*Provider)
+)
+
+// Register makes a DNS backend available by `name` to NewDNSManagerByName().
+// Third party packages can add backends calling Register from their init()
+// function. It panics if `name` is empty or already registered, or if
+// `factory` is nil.
+func Register(name string, factory Factory, info ProviderInfo) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if name == "" {
+		panic("ddflare: Register with an empty provider name")
+	}
+	if factory == nil {
+		panic("ddflare: Register factory is nil for provider " + name)
+	}
+	if _, dup := providers[name]; dup {
+		panic("ddflare: Register called twice for provider " + name)
+	}
+	providers[name] = &Provider{
+		Name:         name,
+		ProviderInfo: info,
+		factory:      factory,
+	}
+}
+
+// Providers returns the registered DNS backends sorted by name.
+func Providers() []Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	list := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// LookupProvider returns the DNS backend registered as `name`.
+func LookupProvider(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	p, ok := providers[name]
+	if !ok {
+		return Provider{}, false
+	}
+	return *p, true
+}
+
+// NewDNSManagerByName returns a new DNSManager using the DNS backend
+// registered as `name`.
+func NewDNSManagerByName(name string) (*DNSManager, error) {
+	p, ok := LookupProvider(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS manager backend %q", name)
+	}
+	return &DNSManager{
+		DNSManager:       p.factory(),
+		name:             name,
+		lastSetAddresses: make(map[string]string),
+	}, nil
+}